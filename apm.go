@@ -0,0 +1,82 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+	pathpkg "path"
+)
+
+const (
+	apmEntrySize   = 512
+	apmStatus      = 0x33 // valid, allocated, readable and writable
+	apmPayloadType = "Apple_HFS"
+)
+
+// WithAPM records an Apple partition map in the system area, with an
+// Apple_HFS partition covering each of the given files of the image, such as
+// an HFS+ or EFI boot image, so that older Macs can boot or mount the image.
+// Partitions have the block size of the image, 2048 bytes.  The driver
+// descriptor record overwrites the first 8 bytes of MBR boot code, so boot
+// code given to WithHybridMBR must be a variant that allows for it, like
+// syslinux' isohdppx.bin.  An Apple partition map can't be combined with
+// WithHybridGPT.
+func WithAPM(paths ...string) Option {
+	return func(o *options) {
+		o.apmPaths = append(o.apmPaths, paths...)
+	}
+}
+
+// apmFiles resolves the files WithAPM covers.
+func (iw *ImageWriter) apmFiles() ([]*FileEntry, error) {
+	if len(iw.apmPaths) == 0 {
+		return nil, nil
+	} else if iw.hybridGPT {
+		return nil, fmt.Errorf("an Apple partition map can't be combined with a GPT")
+	} else if len(iw.apmPaths)+2 > int(systemAreaSize/SectorSize) {
+		// the driver descriptor record and the map itself take a block
+		// each
+		return nil, fmt.Errorf("too many Apple partitions")
+	}
+	var files []*FileEntry
+	for _, p := range iw.apmPaths {
+		f := iw.lookupFile(p)
+		if f == nil {
+			return nil, fmt.Errorf("Apple partition %s is not in the image", p)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// writeAPM records the driver descriptor record and the Apple partition map
+// in area.
+func (iw *ImageWriter) writeAPM(area []byte, l *imageLayout) error {
+	files, err := iw.apmFiles()
+	if err != nil || files == nil {
+		return err
+	}
+	copy(area, "ER")
+	binary.BigEndian.PutUint16(area[2:], uint16(SectorSize))
+	binary.BigEndian.PutUint32(area[4:], l.numSectors)
+
+	numEntries := uint32(len(files) + 1)
+	writeAPMEntry(area[SectorSize:], numEntries, 1, numEntries, "Apple", "Apple_partition_map")
+	for i, f := range files {
+		start := f.sector + f.xarSectors()
+		count := uint32(numDataSectors(f.Size))
+		name := pathpkg.Base(iw.apmPaths[i])
+		writeAPMEntry(area[uint32(i+2)*SectorSize:], numEntries, start, count, name, apmPayloadType)
+	}
+	return nil
+}
+
+func writeAPMEntry(b []byte, numEntries, start, count uint32, name, typ string) {
+	copy(b, "PM")
+	binary.BigEndian.PutUint32(b[4:], numEntries)
+	binary.BigEndian.PutUint32(b[8:], start)
+	binary.BigEndian.PutUint32(b[12:], count)
+	copy(b[16:48], name)
+	copy(b[48:80], typ)
+	binary.BigEndian.PutUint32(b[84:], count) // data area
+	binary.BigEndian.PutUint32(b[88:], apmStatus)
+}
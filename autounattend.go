@@ -0,0 +1,70 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+const (
+	// autounattendName is the answer file Windows Setup searches for in the
+	// root directory of removable media.
+	autounattendName   = "autounattend.xml"
+	autounattendVolume = "AUTOUNATTEND"
+	oemDirName         = "$OEM$"
+)
+
+// WriteAutounattend writes an image holding the Windows Setup answer file
+// answerFile as autounattend.xml in its root directory to w, ready to be
+// attached to a virtual machine installing Windows.  answerFile must be a
+// well-formed XML document with an unattend root element.  Unless oem is
+// nil, its contents are added under $OEM$, such as $OEM$/$1 for files to
+// copy to the system drive.  opts apply on top of the settings the image
+// needs.
+func WriteAutounattend(w io.Writer, answerFile []byte, oem fs.FS, opts ...Option) error {
+	if err := checkAnswerFile(answerFile); err != nil {
+		return err
+	}
+	// Windows matches names without regard to case, but "$" is not a
+	// d-character
+	iw := NewImageWriter(append([]Option{
+		WithVolumeID(autounattendVolume),
+		WithRelaxedNames(),
+	}, opts...)...)
+	if err := iw.AddBytes(autounattendName, answerFile); err != nil {
+		return err
+	}
+	if oem != nil {
+		if err := iw.AddDir(oemDirName); err != nil {
+			return err
+		}
+		if err := iw.addFS(oem, oemDirName, "", 0); err != nil {
+			return err
+		}
+	}
+	return iw.Finalize(w)
+}
+
+// checkAnswerFile checks that answerFile is a well-formed unattend
+// document.
+func checkAnswerFile(answerFile []byte) error {
+	d := xml.NewDecoder(bytes.NewReader(answerFile))
+	root := ""
+	for {
+		t, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid answer file: %w", err)
+		}
+		if e, ok := t.(xml.StartElement); ok && root == "" {
+			root = e.Name.Local
+		}
+	}
+	if root != "unattend" {
+		return fmt.Errorf("answer file has root element %q instead of unattend", root)
+	}
+	return nil
+}
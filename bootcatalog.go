@@ -0,0 +1,137 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// BootImage describes an entry of the El Torito boot catalog of an image
+// read with a Reader.
+type BootImage struct {
+	Platform BootPlatform
+	Media    BootMedia
+	// Bootable is false for entries that were recorded but are not meant
+	// to be booted from.
+	Bootable    bool
+	LoadSegment uint16
+	// LoadSize is the number of 512 byte sectors that are loaded.
+	LoadSize uint16
+	// LBA is the sector the boot image starts at.
+	LBA uint32
+	// SystemType is the partition type of a hard disk image.
+	SystemType byte
+}
+
+// BootImages returns the entries of the El Torito boot catalog, starting
+// with the default entry, or nothing if the image is not bootable.  At
+// most 16 sectors of the catalog are read, and no more than the memory
+// limit of the Reader.
+func (ir *Reader) BootImages() ([]BootImage, error) {
+	catalog, ok, err := ir.bootCatalogSector()
+	if err != nil || !ok {
+		return nil, err
+	}
+	offset := int64(catalog) * int64(SectorSize)
+	if offset >= ir.size {
+		return nil, fmt.Errorf("boot catalog at sector %d exceeds the image", catalog)
+	}
+	size := ir.size - offset
+	if size > maxBootCatalogSize {
+		size = maxBootCatalogSize
+	}
+	if size > ir.memoryLimit {
+		return nil, fmt.Errorf("%w: boot catalog of up to %d bytes exceeds the memory limit of %d bytes", ErrLimitExceeded, size, ir.memoryLimit)
+	}
+	data := make([]byte, size)
+	if _, err := ir.r.ReadAt(data, offset); err != nil {
+		return nil, fmt.Errorf("reading boot catalog: %w", err)
+	}
+	var e []byte
+	next := func() error {
+		if len(data) < bootCatalogEntrySize {
+			return fmt.Errorf("boot catalog at sector %d is truncated", catalog)
+		}
+		e, data = data[:bootCatalogEntrySize], data[bootCatalogEntrySize:]
+		return nil
+	}
+
+	if err := next(); err != nil {
+		return nil, err
+	}
+	var sum uint16
+	for i := 0; i < len(e); i += 2 {
+		sum += binary.LittleEndian.Uint16(e[i:])
+	}
+	if e[0] != 1 || e[30] != 0x55 || e[31] != 0xAA || sum != 0 {
+		return nil, fmt.Errorf("invalid boot catalog validation entry")
+	}
+	platform := BootPlatform(e[1])
+	if err := next(); err != nil {
+		return nil, err
+	}
+	images := []BootImage{parseBootCatalogEntry(e, platform)}
+
+	for final := false; !final; {
+		if err := next(); err != nil {
+			return nil, err
+		}
+		if e[0] != 0x90 && e[0] != 0x91 {
+			// no (further) section headers
+			break
+		}
+		final = e[0] == 0x91
+		platform := BootPlatform(e[1])
+		entries := int(binary.LittleEndian.Uint16(e[2:]))
+		if entries*bootCatalogEntrySize > len(data) {
+			return nil, fmt.Errorf("boot catalog section of %d entries exceeds the catalog", entries)
+		}
+		for i := 0; i < entries; i++ {
+			if err := next(); err != nil {
+				return nil, err
+			}
+			images = append(images, parseBootCatalogEntry(e, platform))
+			// extension entries continue the selection criteria
+			for e[1]&0x20 != 0 {
+				if err := next(); err != nil {
+					return nil, err
+				}
+				if e[0] != 0x44 {
+					return nil, fmt.Errorf("invalid boot catalog extension entry")
+				}
+			}
+		}
+	}
+	return images, nil
+}
+
+// bootCatalogSector returns the sector of the boot catalog that the boot
+// record volume descriptor names, and whether there is one.
+func (ir *Reader) bootCatalogSector() (uint32, bool, error) {
+	sector := make([]byte, SectorSize)
+	for n := int64(ir.session) + int64(primaryVolumeSectorNum); ; n++ {
+		if _, err := ir.r.ReadAt(sector, n*int64(SectorSize)); err != nil {
+			return 0, false, fmt.Errorf("reading volume descriptor %d: %w", n, err)
+		}
+		if string(sector[1:6]) != standardIdentifier || sector[0] == 255 {
+			return 0, false, nil
+		}
+		if sector[0] == 0 && strings.TrimRight(string(sector[7:39]), "\x00") == bootSystemID {
+			return binary.LittleEndian.Uint32(sector[71:]), true, nil
+		}
+	}
+}
+
+// parseBootCatalogEntry parses the initial or section entry e of a boot
+// image for platform.
+func parseBootCatalogEntry(e []byte, platform BootPlatform) BootImage {
+	return BootImage{
+		Platform:    platform,
+		Media:       BootMedia(e[1] & 0x0F),
+		Bootable:    e[0] == 0x88,
+		LoadSegment: binary.LittleEndian.Uint16(e[2:]),
+		SystemType:  e[4],
+		LoadSize:    binary.LittleEndian.Uint16(e[6:]),
+		LBA:         binary.LittleEndian.Uint32(e[8:]),
+	}
+}
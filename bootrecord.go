@@ -0,0 +1,66 @@
+package iso9660wrap
+
+import "fmt"
+
+// bootRecordUseSize is the size of the boot system use field of a boot
+// record, which takes the rest of the descriptor after its identifiers.
+const bootRecordUseSize = SectorSize - 71
+
+// BootRecord describes a boot record volume descriptor for a boot scheme
+// other than El Torito, whose boot system reads the descriptor for the
+// location of whatever it boots.
+type BootRecord struct {
+	// SystemID identifies the boot system that reads the record, in up to
+	// 32 bytes.
+	SystemID string
+
+	// BootID identifies the boot image to the boot system, in up to 32
+	// bytes.
+	BootID string
+
+	// Data is recorded in the boot system use field, which holds up to
+	// 1977 bytes.
+	Data []byte
+}
+
+// WithBootRecord adds a boot record volume descriptor described by r to the
+// image.  It may be given several times, and the descriptors are recorded
+// in that order after the El Torito boot record, if any.
+func WithBootRecord(r BootRecord) Option {
+	return func(o *options) {
+		o.bootRecords = append(o.bootRecords, r)
+	}
+}
+
+// validate checks that the fields of r fit the descriptor.
+func (r *BootRecord) validate() error {
+	if len(r.SystemID) > 32 {
+		return fmt.Errorf("boot system identifier %q is longer than 32 bytes", r.SystemID)
+	} else if len(r.BootID) > 32 {
+		return fmt.Errorf("boot identifier %q is longer than 32 bytes", r.BootID)
+	} else if len(r.Data) > int(bootRecordUseSize) {
+		return fmt.Errorf("boot record data of %d bytes exceeds %d bytes", len(r.Data), bootRecordUseSize)
+	}
+	return nil
+}
+
+// writeBootRecords writes the boot records given with WithBootRecord.
+func writeBootRecords(w *ISO9660Writer, o *options, l *imageLayout) error {
+	for i, r := range o.bootRecords {
+		sw := w.NextSector()
+		if expected := l.bootRecordsSector + uint32(i); w.CurrentSector() != expected {
+			return internalErrorf("unexpected boot record sector %d (expected %d)", w.CurrentSector(), expected)
+		}
+
+		sw.WriteByte(0)
+		sw.WriteString(volumeDescriptorSetMagic)
+		sw.WriteString(r.SystemID)
+		sw.WriteZeros(32 - len(r.SystemID))
+		sw.WriteString(r.BootID)
+		sw.WriteZeros(32 - len(r.BootID))
+		sw.Write(r.Data)
+
+		sw.PadWithZeros()
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+package iso9660wrap
+
+import "sync"
+
+// Buffers are shared by every ImageWriter and Reader of the process, so
+// that building or extracting many images in a row generates little
+// garbage.  Pointers to arrays are pooled, as a slice would be allocated
+// anew each time it is put back.
+var (
+	chunkPool = sync.Pool{New: func() interface{} { return new([prefetchChunkSize]byte) }}
+)
+
+// zeroSector is written where sectors are padded with zeros.
+var zeroSector [SectorSize]byte
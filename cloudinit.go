@@ -0,0 +1,33 @@
+package iso9660wrap
+
+import (
+	"io"
+)
+
+// cloudInitVolumeID is the volume label cloud-init's NoCloud data source
+// looks for.
+const cloudInitVolumeID = "cidata"
+
+// WriteCloudInitSeed writes a seed image for cloud-init's NoCloud data source
+// to w.  The image is labelled "cidata" and holds the files user-data,
+// meta-data and, unless networkConfig is nil, network-config, under exactly
+// these lower-case names.  userData and metaData must not be empty.  opts
+// apply on top of the settings the seed needs.
+func WriteCloudInitSeed(w io.Writer, userData, metaData, networkConfig []byte, opts ...Option) error {
+	return writeSeed(w, "cloud-init", cloudInitVolumeID, cloudInitFiles(userData, metaData, networkConfig), opts)
+}
+
+// NewCloudInitSeed is like WriteCloudInitSeed, but returns the ImageWriter
+// of the seed image, for serving it with an ImageHandler or adding files to
+// it.
+func NewCloudInitSeed(userData, metaData, networkConfig []byte, opts ...Option) (*ImageWriter, error) {
+	return newSeed("cloud-init", cloudInitVolumeID, cloudInitFiles(userData, metaData, networkConfig), opts)
+}
+
+func cloudInitFiles(userData, metaData, networkConfig []byte) []seedFile {
+	return []seedFile{
+		{path: "user-data", data: userData},
+		{path: "meta-data", data: metaData},
+		{path: "network-config", data: networkConfig, optional: true},
+	}
+}
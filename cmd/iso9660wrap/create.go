@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/rn/iso9660wrap"
+)
+
+var symlinkPolicies = map[string]iso9660wrap.SymlinkPolicy{
+	"follow": iso9660wrap.SymlinkFollow,
+	"record": iso9660wrap.SymlinkRecord,
+	"skip":   iso9660wrap.SymlinkSkip,
+	"error":  iso9660wrap.SymlinkError,
+}
+
+var duplicatePolicies = map[string]iso9660wrap.DuplicatePolicy{
+	"error":  iso9660wrap.DuplicateError,
+	"rename": iso9660wrap.DuplicateRename,
+	"last":   iso9660wrap.DuplicateLastWins,
+}
+
+// create writes an image of the given files and directories.  Files are
+// placed in the root directory under their base names, and the contents of
+// directories are merged into the root directory, as mkisofs does.  With
+// -manifest, the image starts out as the manifest declares, -image merges
+// the files of existing images into it, and with -T the listed files are
+// added under their own paths.  Later inputs replace the files of existing
+// images.  With -M and -C, the image is a new session of a multisession
+// medium, like with mkisofs, and -plan reports the layout before writing
+// it.  Without any inputs, the image has an empty root directory, as
+// placeholder seed disks need.
+func create(args []string) {
+	fs := subcommandFlags("create", "OUTFILE [INPUT...]")
+	var out outputFlags
+	out.register(fs)
+	volumeID := fs.String("volid", "", "volume identifier of the image")
+	rockRidge := fs.Bool("rock", false, "record Rock Ridge extensions with POSIX names and permissions")
+	joliet := fs.Bool("J", false, "record Joliet names for Windows, as mkisofs -J does")
+	xa := fs.Bool("xa", false, "mark the image as CD-ROM XA, as mkisofs -XA does")
+	enhanced := fs.Bool("iso1999", false, "add an ISO 9660:1999 enhanced volume descriptor with the names as given, mangling the ISO9660 names as mkisofs -iso-level 4 does")
+	dedup := fs.Bool("dedup", false, "store files with identical contents only once")
+	manifestFile := fs.String("manifest", "", "build the image declared by the JSON or YAML manifest at `FILE`")
+	fileList := fs.String("T", "", "add the files and directories listed in `FILE`, one per line, or - for standard input")
+	nulSeparated := fs.Bool("0", false, "the list given with -T is separated by NUL bytes, as with find -print0")
+	symlinks := fs.String("symlinks", "follow", "what to do with symbolic links in input directories: follow, record (requires -rock), skip or error")
+	duplicates := fs.String("duplicates", "error", "what to do with entries whose ISO9660 names collide, such as readme.txt and README.TXT: error, rename or last")
+	var exclude, includeOnly, images stringList
+	fs.Var(&images, "image", "merge the files of the existing `IMAGE` into the root directory, letting the inputs replace them; may be repeated")
+	fs.Var(&exclude, "exclude", "leave out entries of input directories matching `PATTERN`, such as '*.tmp'; may be repeated")
+	fs.Var(&includeOnly, "include-only", "add only the files of input directories matching `PATTERN`, such as 'configs/**'; may be repeated")
+	previous := fs.String("M", "", "write a new session keeping the files of the last session of the medium `IMAGE`; requires -C")
+	sessionInfo := fs.String("C", "", "the start sectors of the last session and of the new one, as `LAST,NEXT`")
+	prefetch := fs.Int("prefetch", 0, "read up to `MIB` mebibytes of input ahead of writing it")
+	systemArea := fs.String("G", "", "write `FILE`, of up to 32 KiB, to the system area at the start of the image")
+	plan := fs.Bool("plan", false, "report the size, directories and ISO9660 violations of the image before writing it, and fail rather than write an image with violations")
+	pad := fs.Bool("pad", false, "append 150 sectors of zeros to the image, as mkisofs -pad does")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	outfile := fs.Arg(0)
+	inputs := fs.Args()[1:]
+
+	policy, ok := symlinkPolicies[*symlinks]
+	if !ok {
+		log.Fatalf("unknown symlink policy %q", *symlinks)
+	}
+	duplicatePolicy, ok := duplicatePolicies[*duplicates]
+	if !ok {
+		log.Fatalf("unknown duplicate policy %q", *duplicates)
+	}
+
+	var last, next uint32
+	if *sessionInfo != "" {
+		if _, err := fmt.Sscanf(*sessionInfo, "%d,%d", &last, &next); err != nil {
+			log.Fatalf("invalid session sectors %q, expected LAST,NEXT", *sessionInfo)
+		}
+	} else if *previous != "" {
+		log.Fatalf("-M requires -C")
+	}
+
+	var area []byte
+	if *systemArea != "" {
+		var err error
+		if area, err = ioutil.ReadFile(*systemArea); err != nil {
+			log.Fatalf("could not read system area: %s", err)
+		}
+	}
+
+	var manifest *iso9660wrap.Manifest
+	if *manifestFile != "" {
+		fh, err := os.Open(*manifestFile)
+		if err != nil {
+			log.Fatalf("could not open manifest %s: %s", *manifestFile, err)
+		}
+		manifest, err = iso9660wrap.ReadManifest(fh)
+		fh.Close()
+		if err != nil {
+			log.Fatalf("%s: %s", *manifestFile, err)
+		}
+	}
+
+	out.write(outfile, func(outfh *os.File, opts []iso9660wrap.Option) error {
+		if *volumeID != "" {
+			opts = append(opts, iso9660wrap.WithVolumeID(*volumeID))
+		}
+		if *rockRidge {
+			opts = append(opts, iso9660wrap.WithRockRidge())
+		}
+		if *joliet {
+			opts = append(opts, iso9660wrap.WithJoliet())
+		}
+		opts = append(opts, iso9660wrap.WithSymlinkPolicy(policy), iso9660wrap.WithSymlinkWarning(func(name, target string) {
+			log.Printf("warning: skipping symbolic link %s -> %s", name, target)
+		}))
+		opts = append(opts, iso9660wrap.WithDuplicatePolicy(duplicatePolicy))
+		if *xa {
+			opts = append(opts, iso9660wrap.WithXA())
+		}
+		if *enhanced {
+			opts = append(opts, iso9660wrap.WithEnhancedVolume(), iso9660wrap.WithNameMangling())
+		}
+		if *dedup {
+			opts = append(opts, iso9660wrap.WithDeduplication())
+		}
+		if len(exclude) > 0 {
+			opts = append(opts, iso9660wrap.WithExclude(exclude...))
+		}
+		if len(includeOnly) > 0 {
+			opts = append(opts, iso9660wrap.WithIncludeOnly(includeOnly...))
+		}
+		if *sessionInfo != "" {
+			opts = append(opts, iso9660wrap.WithSessionStart(next))
+		}
+		if *prefetch > 0 {
+			opts = append(opts, iso9660wrap.WithPrefetch(*prefetch<<20))
+		}
+		if area != nil {
+			opts = append(opts, iso9660wrap.WithSystemArea(area))
+		}
+		if *pad {
+			opts = append(opts, iso9660wrap.WithPadding(iso9660wrap.DefaultPadding))
+		}
+		iw := iso9660wrap.NewImageWriter(opts...)
+		if manifest != nil {
+			var err error
+			iw, err = manifest.ImageWriter(filepath.Dir(*manifestFile), opts...)
+			if err != nil {
+				return err
+			}
+		}
+		if *previous != "" {
+			fh, err := os.Open(*previous)
+			if err != nil {
+				return fmt.Errorf("could not open image %s for reading: %w", *previous, err)
+			}
+			defer fh.Close()
+			if err := iw.AddPreviousSession(fh, last); err != nil {
+				return fmt.Errorf("%s: %w", *previous, err)
+			}
+		}
+		for _, image := range images {
+			fh, err := os.Open(image)
+			if err != nil {
+				return fmt.Errorf("could not open image %s for reading: %w", image, err)
+			}
+			defer fh.Close()
+			if err := iw.AddImage(fh, "/"); err != nil {
+				return fmt.Errorf("%s: %w", image, err)
+			}
+		}
+		if *fileList != "" {
+			list := os.Stdin
+			if *fileList != "-" {
+				var err error
+				list, err = os.Open(*fileList)
+				if err != nil {
+					return fmt.Errorf("could not open file list %s: %w", *fileList, err)
+				}
+				defer list.Close()
+			}
+			sep := byte('\n')
+			if *nulSeparated {
+				sep = 0
+			}
+			if err := iw.AddFileList(list, sep); err != nil {
+				return fmt.Errorf("%s: %w", *fileList, err)
+			}
+		}
+		for _, input := range inputs {
+			fi, err := os.Stat(input)
+			if err != nil {
+				return fmt.Errorf("could not read input %s: %w", input, err)
+			}
+			if fi.IsDir() {
+				err = iw.AddTree(input, "/")
+			} else {
+				err = iw.AddFile(input)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if *plan {
+			if err := report(iw); err != nil {
+				return err
+			}
+		}
+		return iw.Finalize(outfh)
+	})
+}
+
+// report logs the plan of the image iw would write, failing if it has any
+// violations.
+func report(iw *iso9660wrap.ImageWriter) error {
+	p, err := iw.Plan()
+	if err != nil {
+		return err
+	}
+	level := "no interchange level"
+	if p.Level != 0 {
+		level = fmt.Sprintf("interchange level %d", p.Level)
+	}
+	log.Printf("image of %d bytes in %d sectors, conforming to %s", p.Size, p.Sectors, level)
+	log.Printf("path tables of %d bytes in %d sectors each", p.PathTableSize, p.PathTableSectors)
+	for _, d := range p.Directories {
+		log.Printf("%s: %d sectors at sector %d, depth %d", d.Path, d.Sectors, d.Sector, d.Depth)
+	}
+	for _, v := range p.Violations {
+		log.Printf("violation: %s", v)
+	}
+	if len(p.Violations) > 0 {
+		return fmt.Errorf("image has %d violations of ISO9660", len(p.Violations))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/rn/iso9660wrap"
+)
+
+// diff prints the differences between two images, one per line, and exits
+// with status 1 if there are any, like diff.
+func diff(args []string) {
+	fs := subcommandFlags("diff", "IMAGE1 IMAGE2")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	fa, _ := openImage(fs.Arg(0))
+	defer fa.Close()
+	fb, _ := openImage(fs.Arg(1))
+	defer fb.Close()
+
+	diffs, err := iso9660wrap.Diff(fa, fb)
+	if err != nil {
+		log.Fatalf("comparing %s and %s failed with %s", fs.Arg(0), fs.Arg(1), err)
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+}
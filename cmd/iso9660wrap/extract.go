@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// extract copies files and directories out of an image, by default all of
+// them.
+func extract(args []string) {
+	fs := subcommandFlags("extract", "IMAGE [PATH...]")
+	dir := fs.String("C", ".", "directory to extract into")
+	primary := fs.Bool("primary", false, "use the ISO9660 identifiers rather than Rock Ridge or Joliet names")
+	jobs := fs.Int("j", 0, "number of files to extract at once (default GOMAXPROCS)")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	fh, r := openImage(fs.Arg(0), readerOptions(*primary)...)
+	defer fh.Close()
+	if err := r.Extract(*dir, *jobs, fs.Args()[1:]...); err != nil {
+		log.Fatalf("extracting from %s failed with %s", fs.Arg(0), err)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rn/iso9660wrap"
+)
+
+// inject writes a copy of an image with files added or replaced, keeping its
+// volume identifiers and boot catalog.  Each file is given as ISOPATH=FILE.
+func inject(args []string) {
+	fs := subcommandFlags("inject", "IMAGE OUTFILE ISOPATH=FILE...")
+	var out outputFlags
+	out.register(fs)
+	fs.Parse(args)
+	if fs.NArg() < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	image, outfile := fs.Arg(0), fs.Arg(1)
+	type graft struct{ isoPath, file string }
+	var grafts []graft
+	for _, arg := range fs.Args()[2:] {
+		i := strings.IndexByte(arg, '=')
+		if i <= 0 || i == len(arg)-1 {
+			log.Fatalf("invalid file %q, expected ISOPATH=FILE", arg)
+		}
+		grafts = append(grafts, graft{arg[:i], arg[i+1:]})
+	}
+
+	fh, _ := openImage(image)
+	defer fh.Close()
+	out.write(outfile, func(outfh *os.File, opts []iso9660wrap.Option) error {
+		return iso9660wrap.Rebuild(outfh, fh, func(iw *iso9660wrap.ImageWriter) error {
+			for _, g := range grafts {
+				if err := iw.AddFileAs(g.file, g.isoPath); err != nil {
+					return err
+				}
+			}
+			return nil
+		}, opts...)
+	})
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/rn/iso9660wrap"
+)
+
+// list prints the path of every file and directory in an image, and with -l
+// their sizes, sectors and recording dates as well.
+func list(args []string) {
+	fs := subcommandFlags("list", "IMAGE")
+	long := fs.Bool("l", false, "print the size, first sector and recording date of each entry")
+	primary := fs.Bool("primary", false, "use the ISO9660 identifiers rather than Rock Ridge or Joliet names")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	fh, r := openImage(fs.Arg(0), readerOptions(*primary)...)
+	defer fh.Close()
+
+	err := r.Walk(func(info iso9660wrap.ISOFileInfo) error {
+		name := info.Path
+		if info.IsDir() {
+			name += "/"
+		}
+		if *long {
+			fmt.Printf("%12d %8d %s %s\n", info.Size, info.LBA, info.ModTime.Format(time.RFC3339), name)
+		} else {
+			fmt.Println(name)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("listing %s failed with %s", fs.Arg(0), err)
+	}
+}
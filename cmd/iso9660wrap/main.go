@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rn/iso9660wrap"
+)
+
+// commands maps the name of each subcommand to the function running it with
+// the arguments following the name.
+var commands = map[string]func(args []string){
+	"create":  create,
+	"list":    list,
+	"extract": extract,
+	"verify":  verify,
+	"diff":    diff,
+	"inject":  inject,
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [-f | -atomic] [-v] [-md5] [-sha256] [-verify] [-sparse] INFILE OUTFILE\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s create [flags] OUTFILE [INPUT...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s list [-l] [-primary] IMAGE\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s extract [-C DIR] [-primary] [-j N] IMAGE [PATH...]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s verify IMAGE\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s diff IMAGE1 IMAGE2\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "       %s inject [flags] IMAGE OUTFILE ISOPATH=FILE...\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) > 1 {
+		if cmd, ok := commands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+	wrap()
+}
+
+// wrap wraps a single file in an image, which is what the command did
+// before it had subcommands.
+func wrap() {
+	var out outputFlags
+	out.register(flag.CommandLine)
+	flag.Usage = printUsage
+	flag.Parse()
+	if flag.NArg() != 2 {
+		printUsage()
+		os.Exit(1)
+	}
+
+	infile := flag.Arg(0)
+	outfile := flag.Arg(1)
+
+	infh, err := os.Open(infile)
+	if err != nil {
+		log.Fatalf("could not open input file %s for reading: %s", infile, err)
+	}
+
+	out.write(outfile, func(outfh *os.File, opts []iso9660wrap.Option) error {
+		return iso9660wrap.WriteFile(outfh, infh, opts...)
+	})
+}
+
+// outputFlags are the flags that control how an image is written.
+type outputFlags struct {
+	overwrite  bool
+	atomic     bool
+	verbose    bool
+	implantMD5 bool
+	sidecar    bool
+	readBack   bool
+	sparse     bool
+}
+
+func (f *outputFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&f.overwrite, "f", false, "overwrite OUTFILE if it already exists")
+	fs.BoolVar(&f.atomic, "atomic", false, "write to a temporary file and rename it to OUTFILE when done")
+	fs.BoolVar(&f.verbose, "v", false, "log where each file is placed in the image")
+	fs.BoolVar(&f.implantMD5, "md5", false, "implant an MD5 checksum for checkisomd5, as implantisomd5 does")
+	fs.BoolVar(&f.sidecar, "sha256", false, "write the SHA-256 digest of the image to OUTFILE.sha256")
+	fs.BoolVar(&f.readBack, "verify", false, "read the image back once written and check it against the inputs")
+	fs.BoolVar(&f.sparse, "sparse", false, "seek over sectors of zeros instead of writing them, leaving holes in OUTFILE")
+}
+
+// write creates outfile and has build write the image to it, passing the
+// options the flags ask for.  It exits on failure.
+func (f *outputFlags) write(outfile string, build func(outfh *os.File, opts []iso9660wrap.Option) error) {
+	mode := iso9660wrap.Exclusive
+	if f.atomic {
+		mode = iso9660wrap.Atomic
+	} else if f.overwrite {
+		mode = iso9660wrap.Overwrite
+	}
+
+	opts := []iso9660wrap.Option{iso9660wrap.WithSourceDateEpoch()}
+	if f.verbose {
+		opts = append(opts, iso9660wrap.WithLogger(log.New(os.Stderr, "", 0)))
+	}
+	if f.readBack {
+		opts = append(opts, iso9660wrap.WithVerify())
+	}
+	if f.sparse {
+		opts = append(opts, iso9660wrap.WithSparse())
+	}
+	var result iso9660wrap.Result
+	opts = append(opts, iso9660wrap.WithResult(&result))
+	if f.sidecar {
+		opts = append(opts, iso9660wrap.WithSHA256())
+	}
+
+	err := iso9660wrap.WriteToFile(outfile, mode, func(outfh *os.File) error {
+		err := build(outfh, opts)
+		if err == nil && f.implantMD5 {
+			err = iso9660wrap.ImplantMD5(outfh, false)
+			if err == nil && f.sidecar {
+				// the implanted checksum changed the image
+				result.SHA256, err = fileSHA256(outfh)
+			}
+		}
+		return err
+	})
+	if err != nil {
+		log.Fatalf("writing file failed with %s", err)
+	}
+	if f.verbose {
+		log.Printf("%d sectors, %d files, %d bytes of padding", result.Sectors, len(result.Files), result.Padding)
+	}
+	if f.sidecar {
+		line := fmt.Sprintf("%x  %s\n", result.SHA256, filepath.Base(outfile))
+		err = ioutil.WriteFile(outfile+".sha256", []byte(line), 0666)
+		if err != nil {
+			log.Fatalf("writing checksum file failed with %s", err)
+		}
+	}
+}
+
+func fileSHA256(f *os.File) ([]byte, error) {
+	h := sha256.New()
+	_, err := io.Copy(h, io.NewSectionReader(f, 0, 1<<62))
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// openImage opens the image at path for reading.  It exits on failure.
+func openImage(path string, opts ...iso9660wrap.ReaderOption) (*os.File, *iso9660wrap.Reader) {
+	fh, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("could not open image %s for reading: %s", path, err)
+	}
+	r, err := iso9660wrap.NewReader(fh, opts...)
+	if err != nil {
+		log.Fatalf("could not read image %s: %s", path, err)
+	}
+	return fh, r
+}
+
+// subcommandFlags returns a flag set for the subcommand name, whose
+// arguments after the flags are described by args.
+func subcommandFlags(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s %s [flags] %s\n", os.Args[0], name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// readerOptions returns the options of NewReader for the -primary flag.
+func readerOptions(primary bool) []iso9660wrap.ReaderOption {
+	if primary {
+		return []iso9660wrap.ReaderOption{iso9660wrap.UseNames(iso9660wrap.PrimaryNames)}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/rn/iso9660wrap"
+)
+
+// verify checks that the structure of an image conforms to ECMA-119, that
+// the data of every file can be read and, if the image holds an implanted
+// MD5 checksum, that the image matches it.  Every structural problem is
+// reported before verify fails.
+func verify(args []string) {
+	fs := subcommandFlags("verify", "IMAGE")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	image := fs.Arg(0)
+	fh, r := openImage(image)
+	defer fh.Close()
+
+	findings, err := iso9660wrap.Validate(fh)
+	if err != nil {
+		log.Fatalf("%s: %s", image, err)
+	}
+	for _, f := range findings {
+		log.Printf("%s: %s", image, f)
+	}
+	if len(findings) > 0 {
+		log.Fatalf("%s: %d structural problems found", image, len(findings))
+	}
+
+	files := 0
+	err = r.Walk(func(info iso9660wrap.ISOFileInfo) error {
+		if info.IsDir() {
+			return nil
+		}
+		files++
+		f, err := r.Open(info.Path)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(ioutil.Discard, f); err != nil {
+			return fmt.Errorf("reading %s: %w", info.Path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("%s: %s", image, err)
+	}
+
+	err = iso9660wrap.VerifyMD5(fh)
+	switch {
+	case errors.Is(err, iso9660wrap.ErrNoChecksum):
+		fmt.Printf("%s: %d files OK\n", image, files)
+	case err != nil:
+		log.Fatalf("%s: %s", image, err)
+	default:
+		fmt.Printf("%s: %d files OK, implanted MD5 checksum matches\n", image, files)
+	}
+}
@@ -0,0 +1,22 @@
+package iso9660wrap
+
+import (
+	"io"
+)
+
+// configDriveVolumeID is the volume label of an OpenStack config drive.
+const configDriveVolumeID = "config-2"
+
+// WriteConfigDrive writes an OpenStack config drive in the version 2 format
+// to w.  The image is labelled "config-2" and holds metaData as
+// openstack/latest/meta_data.json along with userData as
+// openstack/latest/user_data and networkData as
+// openstack/latest/network_data.json, each unless nil.  The JSON files must
+// be valid.  opts apply on top of the settings the config drive needs.
+func WriteConfigDrive(w io.Writer, metaData, userData, networkData []byte, opts ...Option) error {
+	return writeSeed(w, "config drive", configDriveVolumeID, []seedFile{
+		{path: "openstack/latest/meta_data.json", data: metaData, json: true},
+		{path: "openstack/latest/user_data", data: userData, optional: true},
+		{path: "openstack/latest/network_data.json", data: networkData, optional: true, json: true},
+	}, opts)
+}
@@ -0,0 +1,66 @@
+package iso9660wrap
+
+import (
+	"crypto/sha256"
+	"io"
+)
+
+// WithDeduplication lets files with identical contents share a single
+// extent, which shrinks images holding many copies of the same data, such as
+// driver bundles.  Files of the same size are read and hashed with SHA-256
+// while the image is laid out, so they are read twice; they must not change
+// until the image is written.  Readers added with AddReader that can be read
+// only once are never shared.
+func WithDeduplication() Option {
+	return func(o *options) {
+		o.dedup = true
+	}
+}
+
+// hashDuplicateCandidates computes the digest of every file that might share
+// its contents with another, that is, every file another file of the same
+// size can be shared with.
+func (iw *ImageWriter) hashDuplicateCandidates(dirs []*directoryEntry, unshared map[*FileEntry]bool) error {
+	bySize := map[int64][]*FileEntry{}
+	paths := map[*FileEntry]string{}
+	for _, d := range dirs {
+		for _, f := range d.files {
+			if f.Size > 0 && f.open != nil && !f.oneShot && !f.prior && f.symlink == "" && f.xar == nil && f.unitSize == 0 && !unshared[f] {
+				bySize[f.Size] = append(bySize[f.Size], f)
+				paths[f] = d.path() + "/" + f.Name
+			}
+		}
+	}
+	for _, files := range bySize {
+		if len(files) < 2 {
+			continue
+		}
+		for _, f := range files {
+			if err := f.hash(paths[f]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hash computes the digest of the contents of f, whose path in the image is
+// path, unless it is known already.
+func (f *FileEntry) hash(path string) error {
+	if f.digest != nil {
+		return nil
+	}
+	r, err := f.reader()
+	if err != nil {
+		return &InputError{path, err}
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return &InputError{path, err}
+	}
+	var digest [sha256.Size]byte
+	copy(digest[:], h.Sum(nil))
+	f.digest = &digest
+	return nil
+}
@@ -0,0 +1,84 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDeduplication(t *testing.T) {
+	blob := []byte(strings.Repeat("firmware", 1000))
+	other := bytes.ToUpper(blob)
+	build := func(opts ...Option) (*Reader, int) {
+		t.Helper()
+		iw := NewImageWriter(opts...)
+		for _, name := range []string{"A/FW.BIN", "B/FW.BIN", "C/FW.BIN"} {
+			if err := iw.AddBytes(name, blob); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// the same size with other contents
+		if err := iw.AddBytes("OTHER.BIN", other); err != nil {
+			t.Fatal(err)
+		}
+		// readers that can be read only once and interleaved files are
+		// never shared
+		if err := iw.AddReader("ONCE.BIN", int64(len(blob)), struct{ io.Reader }{bytes.NewReader(blob)}); err != nil {
+			t.Fatal(err)
+		}
+		if err := iw.AddBytes("UNITS.BIN", blob, Interleave(1, 1)); err != nil {
+			t.Fatal(err)
+		}
+		img := writeImage(t, iw)
+		ir, err := ReadImage(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tree := readTree(t, ir)
+		for _, name := range []string{"A/FW.BIN", "B/FW.BIN", "C/FW.BIN", "ONCE.BIN", "UNITS.BIN"} {
+			if tree[name] != string(blob) {
+				t.Errorf("%s holds %d bytes", name, len(tree[name]))
+			}
+		}
+		if tree["OTHER.BIN"] != string(other) {
+			t.Error("OTHER.BIN holds the data of another file")
+		}
+		// libarchive reads interleaved files as if they were contiguous
+		delete(tree, "UNITS.BIN")
+		listed := bsdtarTree(t, img)
+		delete(listed, "UNITS.BIN")
+		compareTrees(t, "bsdtar", listed, tree)
+		return ir, len(img)
+	}
+	lbas := func(ir *Reader) map[uint32][]string {
+		t.Helper()
+		m := map[uint32][]string{}
+		for _, name := range []string{"A/FW.BIN", "B/FW.BIN", "C/FW.BIN", "OTHER.BIN", "ONCE.BIN", "UNITS.BIN"} {
+			info, err := ir.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			m[info.LBA] = append(m[info.LBA], name)
+		}
+		return m
+	}
+
+	ir, size := build(WithDeduplication())
+	shared := lbas(ir)
+	if len(shared) != 4 {
+		t.Errorf("files are at %v, want the copies of FW.BIN in a single extent", shared)
+	}
+	for _, names := range shared {
+		if len(names) > 1 && strings.Join(names, " ") != "A/FW.BIN B/FW.BIN C/FW.BIN" {
+			t.Errorf("%v share an extent", names)
+		}
+	}
+	ir, plainSize := build()
+	if got := lbas(ir); len(got) != 6 {
+		t.Errorf("without WithDeduplication files are at %v", got)
+	}
+	if saved := plainSize - size; saved != 2*int(numDataSectors(int64(len(blob))))*int(SectorSize) {
+		t.Errorf("deduplication saves %d bytes", saved)
+	}
+}
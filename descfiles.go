@@ -0,0 +1,100 @@
+package iso9660wrap
+
+import "fmt"
+
+// descriptorFile is a file of the root directory whose identifier the
+// volume descriptors record.
+type descriptorFile byte
+
+const (
+	copyrightFile descriptorFile = iota + 1
+	abstractFile
+	bibliographicFile
+)
+
+var descriptorFileNames = map[descriptorFile]string{
+	copyrightFile:     "copyright",
+	abstractFile:      "abstract",
+	bibliographicFile: "bibliographic",
+}
+
+// WithAbstractFileID sets the identifier of the file in the root directory
+// holding the abstract of the image.  It may be up to 37 characters long.
+func WithAbstractFileID(id string) Option {
+	return func(o *options) {
+		o.abstractFileID = id
+	}
+}
+
+// WithBibliographicFileID sets the identifier of the file in the root
+// directory holding bibliographic records of the image.  It may be up to 37
+// characters long.
+func WithBibliographicFileID(id string) Option {
+	return func(o *options) {
+		o.bibliographicFileID = id
+	}
+}
+
+// CopyrightFile marks the file as the copyright file of the image, whose
+// identifier the volume descriptors record, as WithCopyrightFileID does for
+// an identifier given by hand.  The file must be in the root directory.
+func CopyrightFile() FileOption {
+	return func(f *FileEntry) {
+		f.describes = copyrightFile
+	}
+}
+
+// AbstractFile marks the file as the abstract file of the image, like
+// CopyrightFile.
+func AbstractFile() FileOption {
+	return func(f *FileEntry) {
+		f.describes = abstractFile
+	}
+}
+
+// BibliographicFile marks the file as the bibliographic file of the image,
+// like CopyrightFile.
+func BibliographicFile() FileOption {
+	return func(f *FileEntry) {
+		f.describes = bibliographicFile
+	}
+}
+
+// layoutDescriptorFiles sets the copyright, abstract and bibliographic file
+// identifiers of l, from the files marked as such or else from the options.
+func (iw *ImageWriter) layoutDescriptorFiles(l *imageLayout) error {
+	ids := map[descriptorFile]*string{
+		copyrightFile:     &l.copyrightFileID,
+		abstractFile:      &l.abstractFileID,
+		bibliographicFile: &l.bibliographicFileID,
+	}
+	l.copyrightFileID = iw.copyrightFileID
+	l.abstractFileID = iw.abstractFileID
+	l.bibliographicFileID = iw.bibliographicFileID
+	marked := map[descriptorFile]bool{}
+	for _, d := range l.dirs {
+		for _, f := range d.files {
+			if f.describes == 0 {
+				continue
+			}
+			kind := descriptorFileNames[f.describes]
+			if d != iw.root {
+				return fmt.Errorf("%s/%s is the %s file, which must be in the root directory", d.path(), f.origName, kind)
+			} else if marked[f.describes] {
+				return fmt.Errorf("image has several %s files", kind)
+			} else if *ids[f.describes] != "" {
+				return fmt.Errorf("%s is the %s file, but the %s file identifier is set to %q as well", f.origName, kind, kind, *ids[f.describes])
+			}
+			marked[f.describes] = true
+			id := f.Name
+			if iw.fileVersions {
+				id += ";1"
+			}
+			if len(id) > 37 {
+				return fmt.Errorf("%s file identifier %q is longer than 37 characters", kind, id)
+			}
+			*ids[f.describes] = id
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// DiffKind is the kind of a Difference between two images.
+type DiffKind int
+
+const (
+	// DiffAdded is a file or directory found only in the second image.
+	DiffAdded DiffKind = iota
+	// DiffRemoved is a file or directory found only in the first image.
+	DiffRemoved
+	// DiffContents is a file whose size or data differs.
+	DiffContents
+	// DiffMetadata is a file or directory whose type, flags or
+	// recording date differs.
+	DiffMetadata
+	// DiffBoot is a difference in the El Torito boot catalogs.
+	DiffBoot
+	// DiffVolume is a difference in the primary volume descriptors.
+	DiffVolume
+)
+
+var diffKindNames = map[DiffKind]string{
+	DiffAdded:    "added",
+	DiffRemoved:  "removed",
+	DiffContents: "contents",
+	DiffMetadata: "metadata",
+	DiffBoot:     "boot",
+	DiffVolume:   "volume",
+}
+
+func (k DiffKind) String() string {
+	if name, ok := diffKindNames[k]; ok {
+		return name
+	}
+	return fmt.Sprintf("DiffKind(%d)", int(k))
+}
+
+// Difference is a difference between two images found by Diff.
+type Difference struct {
+	Kind DiffKind
+	// Path is the path of the file or directory that differs, or empty
+	// for differences of the volume or its boot catalog.
+	Path   string
+	Detail string
+}
+
+func (d Difference) String() string {
+	switch {
+	case d.Path == "":
+		return fmt.Sprintf("%s: %s", d.Kind, d.Detail)
+	case d.Detail == "":
+		return fmt.Sprintf("%s: %s", d.Kind, d.Path)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.Kind, d.Path, d.Detail)
+}
+
+// Diff compares the ISO9660 images a and b, reporting files and directories
+// added to or removed from b, files whose contents changed, differences in
+// file flags and recording dates, and differences in the volume identifier
+// and the boot catalog.  Boot images are identified by the path of the file
+// holding them, so an image moved to another sector but otherwise unchanged
+// does not count as a difference.  Associated files are compared with
+// associated files of the same name.  Paths are those NewReader exposes by
+// default, so Rock Ridge or Joliet names where the images record them.
+// Differences of the volume come first, then those of the boot catalog,
+// then those of files ordered by path.
+func Diff(a, b io.ReaderAt) ([]Difference, error) {
+	ra, err := NewReader(a)
+	if err != nil {
+		return nil, fmt.Errorf("first image: %w", err)
+	}
+	rb, err := NewReader(b)
+	if err != nil {
+		return nil, fmt.Errorf("second image: %w", err)
+	}
+	filesA, err := diffEntries(ra)
+	if err != nil {
+		return nil, fmt.Errorf("first image: %w", err)
+	}
+	filesB, err := diffEntries(rb)
+	if err != nil {
+		return nil, fmt.Errorf("second image: %w", err)
+	}
+
+	var diffs []Difference
+	if ra.VolumeID() != rb.VolumeID() {
+		diffs = append(diffs, Difference{Kind: DiffVolume, Detail: fmt.Sprintf("volume identifier %q became %q", ra.VolumeID(), rb.VolumeID())})
+	}
+	bootDiffs, err := diffBoot(ra, rb, filesA, filesB)
+	if err != nil {
+		return nil, err
+	}
+	diffs = append(diffs, bootDiffs...)
+
+	var keys []diffKey
+	for k := range filesA {
+		keys = append(keys, k)
+	}
+	for k := range filesB {
+		if _, ok := filesA[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].path != keys[j].path {
+			return keys[i].path < keys[j].path
+		}
+		return keys[i].associated && !keys[j].associated
+	})
+	for _, k := range keys {
+		fa, inA := filesA[k]
+		fb, inB := filesB[k]
+		switch {
+		case !inA:
+			diffs = append(diffs, Difference{Kind: DiffAdded, Path: k.path})
+		case !inB:
+			diffs = append(diffs, Difference{Kind: DiffRemoved, Path: k.path})
+		default:
+			d, err := diffEntry(ra, rb, &fa, &fb)
+			if err != nil {
+				return nil, err
+			}
+			diffs = append(diffs, d...)
+		}
+	}
+	return diffs, nil
+}
+
+// diffKey identifies an entry of an image: associated files are set apart
+// from the regular files of the same name.
+type diffKey struct {
+	path       string
+	associated bool
+}
+
+func diffEntries(ir *Reader) (map[diffKey]ISOFileInfo, error) {
+	entries := map[diffKey]ISOFileInfo{}
+	err := ir.Walk(func(info ISOFileInfo) error {
+		entries[diffKey{info.Path, info.Flags&fileFlagAssociated != 0}] = info
+		return nil
+	})
+	return entries, err
+}
+
+// diffEntry compares the entries fa of image ra and fb of image rb, which
+// have the same path.
+func diffEntry(ra, rb *Reader, fa, fb *ISOFileInfo) ([]Difference, error) {
+	var diffs []Difference
+	metadata := func(format string, v ...interface{}) {
+		diffs = append(diffs, Difference{Kind: DiffMetadata, Path: fa.Path, Detail: fmt.Sprintf(format, v...)})
+	}
+	if fa.IsDir() != fb.IsDir() {
+		if fa.IsDir() {
+			metadata("directory became a file")
+		} else {
+			metadata("file became a directory")
+		}
+		return diffs, nil
+	}
+	if fa.Flags&fileFlagHidden != fb.Flags&fileFlagHidden {
+		metadata("hidden flag changed from %t to %t", fa.Flags&fileFlagHidden != 0, fb.Flags&fileFlagHidden != 0)
+	}
+	if !fa.ModTime.Equal(fb.ModTime) {
+		metadata("recording date %s became %s", fa.ModTime, fb.ModTime)
+	}
+	if fa.IsDir() {
+		return diffs, nil
+	}
+
+	contents := Difference{Kind: DiffContents, Path: fa.Path}
+	if fa.Size != fb.Size {
+		contents.Detail = fmt.Sprintf("size %d became %d", fa.Size, fb.Size)
+		return append(diffs, contents), nil
+	}
+	da, err := contentDigest(ra, fa)
+	if err != nil {
+		return nil, fmt.Errorf("first image: %w", err)
+	}
+	db, err := contentDigest(rb, fb)
+	if err != nil {
+		return nil, fmt.Errorf("second image: %w", err)
+	}
+	if !bytes.Equal(da, db) {
+		contents.Detail = "data differs"
+		diffs = append(diffs, contents)
+	}
+	return diffs, nil
+}
+
+// contentDigest returns the SHA-256 digest of the data of the file info.
+func contentDigest(ir *Reader, info *ISOFileInfo) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, ir.open(info)); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", info.Path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// diffBoot compares the boot catalogs of ra and rb, whose files are filesA
+// and filesB.
+func diffBoot(ra, rb *Reader, filesA, filesB map[diffKey]ISOFileInfo) ([]Difference, error) {
+	bootA, err := ra.BootImages()
+	if err != nil {
+		return nil, fmt.Errorf("first image: %w", err)
+	}
+	bootB, err := rb.BootImages()
+	if err != nil {
+		return nil, fmt.Errorf("second image: %w", err)
+	}
+	var diffs []Difference
+	for i := 0; i < len(bootA) || i < len(bootB); i++ {
+		var detail string
+		switch {
+		case i >= len(bootA):
+			detail = fmt.Sprintf("boot entry %d added: %s", i+1, describeBootImage(&bootB[i], filesB))
+		case i >= len(bootB):
+			detail = fmt.Sprintf("boot entry %d removed: %s", i+1, describeBootImage(&bootA[i], filesA))
+		default:
+			a, b := describeBootImage(&bootA[i], filesA), describeBootImage(&bootB[i], filesB)
+			if a == b {
+				continue
+			}
+			detail = fmt.Sprintf("boot entry %d changed from %s to %s", i+1, a, b)
+		}
+		diffs = append(diffs, Difference{Kind: DiffBoot, Detail: detail})
+	}
+	return diffs, nil
+}
+
+// describeBootImage describes the boot catalog entry b of the image whose
+// files are files, naming the boot image by its path if a file holds it.
+func describeBootImage(b *BootImage, files map[diffKey]ISOFileInfo) string {
+	image := ""
+	for _, f := range files {
+		// of files sharing the data, the first path is used
+		if !f.IsDir() && f.LBA == b.LBA && f.Size > 0 && (image == "" || "/"+f.Path < image) {
+			image = "/" + f.Path
+		}
+	}
+	if image == "" {
+		image = fmt.Sprintf("sector %d", b.LBA)
+	}
+	return fmt.Sprintf("%s (platform %#02x, media %d, bootable %t, load segment %#x, %d sectors, system type %#02x)",
+		image, byte(b.Platform), b.Media, b.Bootable, b.LoadSegment, b.LoadSize, b.SystemType)
+}
@@ -0,0 +1,105 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	stamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	build := func(volumeID string, add func(iw *ImageWriter) error) []byte {
+		t.Helper()
+		iw := NewImageWriter(WithVolumeID(volumeID), WithTimestamp(stamp))
+		for name, data := range map[string]string{
+			"SAME.TXT":   "same",
+			"DIR/IN.TXT": "in",
+			"BOOT.BIN":   strings.Repeat("boot", 1024),
+		} {
+			if err := iw.AddBytes(name, []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := iw.AddBootImage("BOOT.BIN"); err != nil {
+			t.Fatal(err)
+		}
+		if err := add(iw); err != nil {
+			t.Fatal(err)
+		}
+		return writeImage(t, iw)
+	}
+	a := build("FIRST", func(iw *ImageWriter) error {
+		for name, data := range map[string]string{
+			"DATA.TXT": "aaaa",
+			"SIZE.TXT": "123",
+			"GONE.TXT": "gone",
+			"HIDE.TXT": "hide",
+			"DATE.TXT": "date",
+			"KIND":     "kind",
+		} {
+			if err := iw.AddBytes(name, []byte(data)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	b := build("SECOND", func(iw *ImageWriter) error {
+		// the big file moves the boot image, which still counts as the same
+		for name, data := range map[string]string{
+			"AAA.BIN":    strings.Repeat("a", 100000),
+			"DATA.TXT":   "bbbb",
+			"SIZE.TXT":   "1234",
+			"KIND/X.TXT": "x",
+			"NEW.TXT":    "new",
+			"EFI.IMG":    "efi",
+		} {
+			if err := iw.AddBytes(name, []byte(data)); err != nil {
+				return err
+			}
+		}
+		if err := iw.AddBytes("HIDE.TXT", []byte("hide"), Hidden()); err != nil {
+			return err
+		}
+		if err := iw.AddBytes("DATE.TXT", []byte("date"), ModTime(stamp.Add(time.Hour))); err != nil {
+			return err
+		}
+		return iw.AddBootImage("EFI.IMG", Platform(PlatformEFI))
+	})
+
+	diffs, err := Diff(bytes.NewReader(a), bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`volume: volume identifier "FIRST" became "SECOND"`,
+		"boot: boot entry 2 added: /EFI.IMG (platform 0xef,",
+		"added: AAA.BIN",
+		"contents: DATA.TXT: data differs",
+		"metadata: DATE.TXT: recording date 2024-05-01 12:00:00 +0000 UTC became 2024-05-01 13:00:00 +0000 UTC",
+		"added: EFI.IMG",
+		"removed: GONE.TXT",
+		"metadata: HIDE.TXT: hidden flag changed from false to true",
+		"metadata: KIND: file became a directory",
+		"added: KIND/X.TXT",
+		"added: NEW.TXT",
+		"contents: SIZE.TXT: size 3 became 4",
+	}
+	for i := 0; i < len(diffs) || i < len(want); i++ {
+		switch {
+		case i >= len(diffs):
+			t.Errorf("missing difference %q", want[i])
+		case i >= len(want):
+			t.Errorf("unexpected difference %q", diffs[i])
+		case !strings.HasPrefix(diffs[i].String(), want[i]):
+			t.Errorf("difference %d is %q, want %q", i, diffs[i], want[i])
+		}
+	}
+
+	if diffs, err := Diff(bytes.NewReader(a), bytes.NewReader(a)); err != nil || len(diffs) != 0 {
+		t.Errorf("Diff of an image with itself returned %v, %v", diffs, err)
+	}
+	if _, err := Diff(bytes.NewReader(a), bytes.NewReader(b[:SectorSize])); err == nil || !strings.HasPrefix(err.Error(), "second image: ") {
+		t.Errorf("Diff with a truncated image returned %v", err)
+	}
+}
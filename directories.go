@@ -1,66 +1,312 @@
 package iso9660wrap
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// File flags of a directory record.
+const (
+	fileFlagHidden     byte = 1 << 0 // existence bit
+	fileFlagDirectory  byte = 1 << 1
+	fileFlagAssociated byte = 1 << 2
+
+	// fileFlagMultiExtent marks every directory record of a file except
+	// its last one, when the file is recorded in more than one extent.
+	fileFlagMultiExtent byte = 1 << 7
+)
+
+// maxExtentSize is the largest extent a directory record can describe such
+// that another extent of the same file can follow it.
+const maxExtentSize = int64(math.MaxUint32 &^ (SectorSize - 1))
+
+// directoryRecord holds the fields of a single directory record.
+type directoryRecord struct {
+	identifier string
+	sector     uint32
+	size       uint32
+	flags      byte
+	xarLength  byte // sectors of the extended attribute record
+	systemUse  []byte
+
+	// unitSize and gapSize are the sectors of the file units and of the
+	// gaps between them of an interleaved file
+	unitSize byte
+	gapSize  byte
+	// volume is the volume sequence number of the volume holding the
+	// extent, or zero for the only volume of a set
+	volume uint16
+
+	// recorded is the recording date of the record, if it differs from
+	// that of the image.
+	recorded time.Time
+}
+
 func WriteDirectoryRecord(w *SectorWriter, identifier string, firstSectorNum uint32) uint32 {
-	if len(identifier) > 30 {
-		Panicf("directory identifier length %d is out of bounds", len(identifier))
-	}
-	recordLength := 33 + len(identifier)
+	r := directoryRecord{identifier: identifier, sector: firstSectorNum, size: SectorSize, flags: fileFlagDirectory}
+	return r.write(w, time.Now())
+}
 
-	w.WriteByte(byte(recordLength))
-	w.WriteByte(0) // number of sectors in extended attribute record
-	w.WriteBothEndianDWord(firstSectorNum)
-	w.WriteBothEndianDWord(SectorSize) // directory length
-	writeDirectoryRecordtimestamp(w, time.Now())
-	w.WriteByte(byte(3))     // bitfield; directory
-	w.WriteByte(byte(0))     // file unit size for an interleaved file
-	w.WriteByte(byte(0))     // interleave gap size for an interleaved file
-	w.WriteBothEndianWord(1) // volume sequence number
-	w.WriteByte(byte(len(identifier)))
-	w.WriteString(identifier)
-	// optional padding to even length
+// WriteFileRecordHeader writes the directory record of a file.  The identifier
+// is written as given, so it must include the version, such as "FILE.TXT;1",
+// if one is wanted.
+func WriteFileRecordHeader(w *SectorWriter, identifier string, firstSectorNum uint32, fileSize uint32) uint32 {
+	r := directoryRecord{identifier: identifier, sector: firstSectorNum, size: fileSize}
+	return r.write(w, time.Now())
+}
+
+// length returns the length of the record, including the padding to an even
+// length and the System Use field.
+func (r *directoryRecord) length() uint32 {
+	recordLength := 33 + len(r.identifier)
 	if recordLength%2 == 1 {
 		recordLength++
-		w.WriteByte(0)
 	}
-	return uint32(recordLength)
+	recordLength += len(r.systemUse)
+	// records are of even length, even when the system use field isn't
+	return uint32(recordLength + recordLength%2)
 }
 
-func WriteFileRecordHeader(w *SectorWriter, identifier string, firstSectorNum uint32, fileSize uint32) uint32 {
-	if len(identifier) > 30 {
-		Panicf("directory identifier length %d is out of bounds", len(identifier))
+func (r *directoryRecord) write(w *SectorWriter, t time.Time) uint32 {
+	if r.length() > 255 {
+		w.fail(fmt.Errorf("directory identifier length %d is out of bounds", len(r.identifier)))
+		return 0
+	}
+	recordLength := r.length()
+	if !r.recorded.IsZero() {
+		t = r.recorded
+	}
+	volume := r.volume
+	if volume == 0 {
+		volume = 1
 	}
-	recordLength := 33 + len(identifier)
 
 	w.WriteByte(byte(recordLength))
-	w.WriteByte(0)                         // number of sectors in extended attribute record
-	w.WriteBothEndianDWord(firstSectorNum) // first sector
-	w.WriteBothEndianDWord(fileSize)
-	writeDirectoryRecordtimestamp(w, time.Now())
-	w.WriteByte(byte(0))     // bitfield; normal file
-	w.WriteByte(byte(0))     // file unit size for an interleaved file
-	w.WriteByte(byte(0))     // interleave gap size for an interleaved file
-	w.WriteBothEndianWord(1) // volume sequence number
-	w.WriteByte(byte(len(identifier)))
-	w.WriteString(identifier)
+	w.WriteByte(r.xarLength) // number of sectors in extended attribute record
+	w.WriteBothEndianDWord(r.sector)
+	w.WriteBothEndianDWord(r.size)
+	writeDirectoryRecordtimestamp(w, t)
+	w.WriteByte(r.flags)
+	w.WriteByte(r.unitSize)       // file unit size for an interleaved file
+	w.WriteByte(r.gapSize)        // interleave gap size for an interleaved file
+	w.WriteBothEndianWord(volume) // volume sequence number
+	w.WriteByte(byte(len(r.identifier)))
+	w.WriteString(r.identifier)
 	// optional padding to even length
-	if recordLength%2 == 1 {
-		recordLength++
+	if len(r.identifier)%2 == 0 {
 		w.WriteByte(0)
 	}
-	return uint32(recordLength)
+	w.Write(r.systemUse)
+	if len(r.systemUse)%2 == 1 {
+		w.WriteByte(0)
+	}
+	return recordLength
+}
+
+// records returns the records of d's directory extent, starting with the
+// "." and ".." entries.
+func (d *directoryEntry) records(o *options) []directoryRecord {
+	parent := d.isoParent()
+	recs := []directoryRecord{
+		d.record("\x00"),
+		parent.record("\x01"),
+	}
+	recs[0].recorded = o.inZone(o.entryTime(d.modTime))
+	recs[1].recorded = o.inZone(o.entryTime(parent.modTime))
+	var xaSkip byte
+	if o.xa {
+		xaSkip = xaSystemUseSize
+	}
+	if o.rockRidge {
+		recs[0].systemUse = d.rrDirAttributes()
+		if d.parent == nil {
+			recs[0].systemUse = append(append(suspSP(xaSkip), suspER()...), recs[0].systemUse...)
+		}
+		recs[1].systemUse = parent.rrDirAttributes()
+		if d.movedTo != nil {
+			recs[1].systemUse = append(recs[1].systemUse, rrPL(d.parent.sector)...)
+		}
+	}
+	// subdirs and files are each sorted already; merge them into a single
+	// ordering
+	i, j := 0, 0
+	for i < len(d.subdirs) || j < len(d.files) {
+		if j == len(d.files) || (i < len(d.subdirs) && compareIdentifiers(d.childName(d.subdirs[i]), d.files[j].Name) < 0) {
+			sub := d.subdirs[i]
+			r := sub.record(d.childName(sub))
+			r.recorded = o.inZone(o.entryTime(sub.modTime))
+			if o.rockRidge {
+				r.systemUse = rrSystemUse(sub.origName, sub.rrDirAttributes())
+			}
+			switch sub.movedTo {
+			case nil:
+			case d:
+				r.systemUse = append(r.systemUse, rrRE()...)
+			default:
+				// a file standing in for the relocated directory
+				r.flags &^= fileFlagDirectory
+				r.size = 0
+				r.systemUse = append(r.systemUse, rrCL(sub.sector)...)
+			}
+			recs = append(recs, r)
+			i++
+		} else {
+			f := d.files[j]
+			frecs := f.records(o)
+			if o.rockRidge {
+				su := rrSystemUse(f.origName, f.rrAttributes())
+				for k := range frecs {
+					frecs[k].systemUse = su
+				}
+			}
+			recs = append(recs, frecs...)
+			j++
+		}
+	}
+	if o.xa {
+		for i := range recs {
+			su := xaSystemUse(recs[i].flags&fileFlagDirectory != 0)
+			if i == 0 && d.parent == nil && o.rockRidge {
+				// the SP entry stays first, and the bytes it says to skip
+				// follow it here as they start every other record
+				sp := len(suspSP(xaSkip))
+				recs[i].systemUse = append(append(recs[i].systemUse[:sp:sp], su...), recs[i].systemUse[sp:]...)
+				continue
+			}
+			recs[i].systemUse = append(su, recs[i].systemUse...)
+		}
+	}
+	return recs
+}
+
+// sortEntries orders the subdirectories and files of d as ECMA-119 9.3
+// requires for directory records.
+func (d *directoryEntry) sortEntries() {
+	sort.SliceStable(d.subdirs, func(i, j int) bool {
+		return compareIdentifiers(d.childName(d.subdirs[i]), d.childName(d.subdirs[j])) < 0
+	})
+	sort.SliceStable(d.files, func(i, j int) bool {
+		if c := compareIdentifiers(d.files[i].Name, d.files[j].Name); c != 0 {
+			return c < 0
+		}
+		// an associated file precedes the file it is associated with
+		return d.files[i].flags&fileFlagAssociated > d.files[j].flags&fileFlagAssociated
+	})
+}
+
+// compareIdentifiers compares two file or directory identifiers according to
+// the collation rules of ECMA-119 9.3: names and then extensions are compared
+// after padding the shorter one with spaces, and higher version numbers sort
+// first.
+func compareIdentifiers(a, b string) int {
+	aName, aExt, aVersion := splitIdentifier(a)
+	bName, bExt, bVersion := splitIdentifier(b)
+	if c := comparePadded(aName, bName); c != 0 {
+		return c
+	}
+	if c := comparePadded(aExt, bExt); c != 0 {
+		return c
+	}
+	if aVersion > bVersion {
+		return -1
+	} else if aVersion < bVersion {
+		return 1
+	}
+	return 0
+}
+
+func splitIdentifier(identifier string) (name, ext string, version int) {
+	name = identifier
+	if i := strings.LastIndexByte(name, ';'); i >= 0 {
+		version, _ = strconv.Atoi(name[i+1:])
+		name = name[:i]
+	}
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name, ext = name[:i], name[i+1:]
+	}
+	return name, ext, version
+}
+
+func comparePadded(a, b string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		ca, cb := byte(' '), byte(' ')
+		if i < len(a) {
+			ca = a[i]
+		}
+		if i < len(b) {
+			cb = b[i]
+		}
+		if ca != cb {
+			return int(ca) - int(cb)
+		}
+	}
+	return 0
+}
+
+// record returns a record pointing at d's extent under identifier.
+func (d *directoryEntry) record(identifier string) directoryRecord {
+	return directoryRecord{identifier: identifier, sector: d.sector, size: d.size, flags: fileFlagDirectory}
+}
+
+// records returns the records describing f.  Files larger than
+// maxExtentSize are split into several consecutive extents, each of which
+// gets its own record.
+func (f *FileEntry) records(o *options) []directoryRecord {
+	identifier := f.Name
+	if o.fileVersions {
+		identifier += ";1"
+	}
+	recorded := f.modTime
+	if recorded.IsZero() {
+		recorded = o.entryTime(f.srcModTime)
+	}
+	recorded = o.inZone(recorded)
+	var recs []directoryRecord
+	sector := f.sector
+	remaining := f.Size
+	for {
+		size := remaining
+		flags := f.flags
+		if size > maxExtentSize {
+			size = maxExtentSize
+			flags |= fileFlagMultiExtent
+		}
+		recs = append(recs, directoryRecord{identifier: identifier, sector: sector, size: uint32(size), flags: flags, xarLength: byte(f.xarSectors()), unitSize: f.unitSize, gapSize: f.gapSize, recorded: recorded})
+		remaining -= size
+		if remaining == 0 {
+			return recs
+		}
+		sector += uint32(size / int64(SectorSize))
+	}
+}
+
+// directoryExtentSize returns the size of the extent holding recs.  Records
+// never straddle a sector boundary, so a record that doesn't fit in what is
+// left of a sector starts the next one.
+func directoryExtentSize(recs []directoryRecord) uint32 {
+	sectors, used := uint32(1), uint32(0)
+	for _, r := range recs {
+		l := r.length()
+		if used+l > SectorSize {
+			sectors++
+			used = 0
+		}
+		used += l
+	}
+	return sectors * SectorSize
 }
 
 func writeDirectoryRecordtimestamp(w *SectorWriter, t time.Time) {
-	t = t.UTC()
+	t, offset := gmtOffset(t)
 	w.WriteByte(byte(t.Year() - 1900))
 	w.WriteByte(byte(t.Month()))
 	w.WriteByte(byte(t.Day()))
 	w.WriteByte(byte(t.Hour()))
 	w.WriteByte(byte(t.Minute()))
 	w.WriteByte(byte(t.Second()))
-	w.WriteByte(0) // UTC offset
+	w.WriteByte(offset)
 }
@@ -0,0 +1,226 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDirectoryRoundTrip(t *testing.T) {
+	iw := NewImageWriter()
+	want := map[string]string{}
+	add := func(name, data string) {
+		t.Helper()
+		if err := iw.AddBytes(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		want[name] = data
+		for dir := filepath.ToSlash(filepath.Dir(name)); dir != "."; dir = filepath.ToSlash(filepath.Dir(dir)) {
+			want[dir+"/"] = ""
+		}
+	}
+	// added in reverse, so that the records have to be sorted, and enough
+	// of them that the root directory takes several sectors
+	for i := 150; i > 0; i-- {
+		add(fmt.Sprintf("FILE%03d.TXT", i), strings.Repeat(strconv.Itoa(i), i))
+	}
+	// enough directories that the path tables take several sectors
+	for i := 0; i < 120; i++ {
+		add(fmt.Sprintf("DIRECTORY_%03d/DATA.BIN", i), fmt.Sprint(i))
+	}
+	add("A/B/C/D/E/F/G/DEEP.TXT", "deep")
+	add("A/B/EMPTY.TXT", "")
+
+	p, err := iw.Plan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := p.Directories[0]; root.Sectors < 2 {
+		t.Errorf("root directory takes %d sectors, want several", root.Sectors)
+	}
+	if p.PathTableSectors < 2 {
+		t.Errorf("path tables take %d sectors, want several", p.PathTableSectors)
+	}
+
+	img := writeImage(t, iw)
+	pvd := img[primaryVolumeSectorNum*SectorSize:]
+	if n := littleEndian32(pvd[80:]); int64(n)*int64(SectorSize) != int64(len(img)) {
+		t.Errorf("volume space size is %d sectors, but the image has %d", n, len(img)/int(SectorSize))
+	}
+	if size := littleEndian32(pvd[132:]); size != p.PathTableSize {
+		t.Errorf("path table size is %d bytes, but Plan gives %d", size, p.PathTableSize)
+	}
+
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTrees(t, "ReadImage", readTree(t, ir), want)
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), want)
+}
+
+func TestMultiExtentRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes an image of more than 4 GiB")
+	}
+	// the file reads as zeros but for the offsets at a few places, most of
+	// them around the end of the first extent
+	const size = maxExtentSize + 3*int64(SectorSize) + 5
+	offsets := []int64{0, 1 << 30, maxExtentSize - 8, maxExtentSize, maxExtentSize + int64(SectorSize), size - 8}
+	src := io.NewSectionReader(markedReader(offsets), 0, size)
+
+	iw := NewImageWriter(WithSparse())
+	if err := iw.AddReader("BIG.BIN", size, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("SMALL.TXT", []byte("small")); err != nil {
+		t.Fatal(err)
+	}
+	iso := filepath.Join(t.TempDir(), "image.iso")
+	f, err := os.Create(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := iw.Finalize(f); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, f)
+
+	ir, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := ir.Stat("BIG.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != size {
+		t.Errorf("BIG.BIN is %d bytes, want %d", info.Size, size)
+	}
+	r, err := ir.Open("BIG.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range offsets {
+		b := make([]byte, 8)
+		if _, err := r.ReadAt(b, off); err != nil {
+			t.Fatalf("reading BIG.BIN at %d: %v", off, err)
+		}
+		if got := int64(binary.BigEndian.Uint64(b)); got != off {
+			t.Errorf("BIG.BIN holds %d at %d", got, off)
+		}
+	}
+
+	list := bsdtarList(t, iso)
+	if got := list["BIG.BIN"]; len(got) < 5 || got[4] != strconv.FormatInt(size, 10) {
+		t.Errorf("bsdtar lists BIG.BIN as %q, want %d bytes", got, size)
+	}
+}
+
+func TestMultiExtentReaderAt(t *testing.T) {
+	if testing.Short() {
+		t.Skip("reads an image of more than 4 GiB")
+	}
+	const size = maxExtentSize + 3*int64(SectorSize) + 5
+	// the marks at the end of the first extent and across its end
+	offsets := []int64{0, maxExtentSize - 16, maxExtentSize - 3, maxExtentSize + 4093, size - 8}
+	iw := NewImageWriter()
+	if err := iw.AddReader("BIG.BIN", size, io.NewSectionReader(markedReader(offsets), 0, size)); err != nil {
+		t.Fatal(err)
+	}
+	im, err := iw.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, err := im.ReaderAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir, err := NewReader(ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := ir.Open("BIG.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, off := range offsets {
+		b := make([]byte, 8)
+		if _, err := r.ReadAt(b, off); err != nil {
+			t.Fatalf("reading BIG.BIN at %d: %v", off, err)
+		}
+		if got := int64(binary.BigEndian.Uint64(b)); got != off {
+			t.Errorf("BIG.BIN holds %d at %d", got, off)
+		}
+	}
+}
+
+func TestInterleavedRecordHostile(t *testing.T) {
+	iw := NewImageWriter()
+	if err := iw.AddBytes("UNITS.BIN", make([]byte, 3*SectorSize), Interleave(1, 1)); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, iw)
+	if ir, err := ReadImage(img); err != nil {
+		t.Fatal(err)
+	} else if got := readTree(t, ir)["UNITS.BIN"]; len(got) != 3*int(SectorSize) {
+		t.Fatalf("UNITS.BIN holds %d bytes", len(got))
+	}
+	rec := bytes.Index(img, []byte("UNITS.BIN")) - 33
+	if rec < 0 || img[rec+25]&fileFlagDirectory != 0 || img[rec+26] != 1 {
+		t.Fatal("no directory record of UNITS.BIN")
+	}
+	for _, tc := range []struct {
+		desc   string
+		change func(b []byte)
+		want   string
+	}{
+		{"file units past the image", func(b []byte) {
+			binary.LittleEndian.PutUint32(b[10:], 0xFFFFFFFF)
+			b[27] = 255
+		}, "interleaved extent"},
+		{"sector past the image", func(b []byte) {
+			binary.LittleEndian.PutUint32(b[2:], 0xFFFFFFFF)
+			b[1] = 255
+		}, "exceeds the image"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			b := append([]byte(nil), img...)
+			tc.change(b[rec:])
+			ir, err := ReadImage(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ir.Walk(func(ISOFileInfo) error { return nil }); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("Walk returned %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+// markedReader reads as zeros except for the 8 bytes at each of its offsets,
+// which hold the offset.
+type markedReader []int64
+
+func (m markedReader) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	for _, o := range m {
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(o))
+		for i := range b {
+			if j := o + int64(i) - off; j >= 0 && j < int64(len(p)) {
+				p[j] = b[i]
+			}
+		}
+	}
+	return len(p), nil
+}
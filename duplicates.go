@@ -0,0 +1,104 @@
+package iso9660wrap
+
+import "fmt"
+
+// DuplicatePolicy selects what happens when an entry is added under a name
+// whose identifier, once upper-cased or mangled, is that of an entry
+// already in its directory, such as "readme.txt" after "README.TXT".
+type DuplicatePolicy int
+
+const (
+	// DuplicateError fails to add the entry.  Directories are merged
+	// instead, as graft points of the same directory are.
+	DuplicateError DuplicatePolicy = iota
+	// DuplicateRename records the entry under the identifier with the
+	// smallest numeric suffix, such as README_1.TXT, that is still free.
+	// Directories whose names differ are kept apart the same way.
+	DuplicateRename
+	// DuplicateLastWins replaces the file added before with the one added
+	// since.  Directories are merged, under the name added last.
+	DuplicateLastWins
+)
+
+// WithDuplicatePolicy sets what happens to entries whose identifiers
+// collide.  The default is DuplicateError.  A file and a directory never
+// replace each other, so DuplicateLastWins fails for them as
+// DuplicateError does.
+func WithDuplicatePolicy(p DuplicatePolicy) Option {
+	return func(o *options) {
+		o.duplicates = p
+	}
+}
+
+// resolveFileConflict applies the duplicate policy to f, which is about to
+// be added to dir as name.
+func (iw *ImageWriter) resolveFileConflict(dir *directoryEntry, f *FileEntry, name string) error {
+	if !dir.conflicts(f) {
+		return nil
+	}
+	if iw.duplicates == DuplicateRename {
+		base, ext := splitExtension(f.Name)
+		f.Name = dir.uniqueIdentifier(base, ext, iw.identifierLimit(false, ext))
+		return nil
+	}
+	for _, sub := range dir.subdirs {
+		if sub.name == f.Name {
+			return fmt.Errorf("%s has the identifier %s of a directory already in the image", name, f.Name)
+		}
+	}
+	for i, g := range dir.files {
+		if g.Name != f.Name || g.flags&fileFlagAssociated != f.flags&fileFlagAssociated {
+			continue
+		}
+		if iw.duplicates == DuplicateLastWins {
+			dir.files = append(dir.files[:i], dir.files[i+1:]...)
+			return nil
+		} else if g.origName != f.origName {
+			return fmt.Errorf("%s has the identifier %s of %s, already in the image", name, f.Name, g.origName)
+		}
+		break
+	}
+	return fmt.Errorf("%s already exists in the image", name)
+}
+
+// resolveDirConflict applies the duplicate policy to the directory called
+// c that is about to be added to dir as dirname, returning the existing
+// directory it is merged with, if any, and its identifier otherwise.
+func (iw *ImageWriter) resolveDirConflict(dir *directoryEntry, c, dirname string) (*directoryEntry, string, error) {
+	for _, sub := range dir.subdirs {
+		if sub.name != dirname {
+			continue
+		}
+		switch iw.duplicates {
+		case DuplicateRename:
+			return nil, dir.uniqueIdentifier(dirname, "", iw.identifierLimit(true, "")), nil
+		case DuplicateLastWins:
+			sub.origName = c
+		}
+		return sub, dirname, nil
+	}
+	if dir.lookup(dirname) {
+		if iw.duplicates == DuplicateRename {
+			return nil, dir.uniqueIdentifier(dirname, "", iw.identifierLimit(true, "")), nil
+		}
+		return nil, "", fmt.Errorf("%s already exists in the image and is not a directory", dirname)
+	}
+	return nil, dirname, nil
+}
+
+// identifierLimit returns the length the name of an identifier with the
+// extension ext may take, which is what a numeric suffix has to fit in.
+func (iw *ImageWriter) identifierLimit(dir bool, ext string) int {
+	switch {
+	case iw.level == 1:
+		return 8
+	case iw.relaxedNames:
+		if ext != "" {
+			return maxRelaxedIdentifierLength - len(ext) - 1
+		}
+		return maxRelaxedIdentifierLength
+	case dir:
+		return maxDirIdentifierLength
+	}
+	return maxFileIdentifierLength - len(ext)
+}
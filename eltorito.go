@@ -0,0 +1,380 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// BootMedia is the kind of media an El Torito boot image emulates.
+type BootMedia byte
+
+// Boot media types, as recorded in boot catalog entries.
+const (
+	NoEmulation BootMedia = iota
+	Floppy1200
+	Floppy1440
+	Floppy2880
+	HardDisk
+)
+
+// floppySizes maps the floppy emulation media types to the exact size
+// their boot images must have.
+var floppySizes = map[BootMedia]int64{
+	Floppy1200: 1200 * 1024,
+	Floppy1440: 1440 * 1024,
+	Floppy2880: 2880 * 1024,
+}
+
+// BootPlatform is the platform a boot image is meant for.
+type BootPlatform byte
+
+// Platform IDs of the boot catalog.
+const (
+	PlatformBIOS    BootPlatform = 0x00 // 80x86 BIOS
+	PlatformPowerPC BootPlatform = 0x01
+	PlatformMac     BootPlatform = 0x02
+	PlatformEFI     BootPlatform = 0xEF
+)
+
+const (
+	bootSystemID         = "EL TORITO SPECIFICATION"
+	bootCatalogEntrySize = 32
+)
+
+// bootEntry describes a boot image registered with AddBootImage.
+type bootEntry struct {
+	path        string
+	platform    BootPlatform
+	media       BootMedia
+	loadSegment uint16
+	loadSize    uint16
+	infoTable   bool
+
+	file *FileEntry
+	// systemType is the partition type of a hard disk image.
+	systemType byte
+}
+
+// BootOption sets a property of a boot image added with AddBootImage.
+type BootOption func(*bootEntry)
+
+// Emulate sets the media the boot image emulates.  Boot images emulating a
+// floppy disk must be exactly as large as that floppy disk, and those
+// emulating a hard disk must start with a master boot record holding a
+// single partition.  The default is NoEmulation.
+func Emulate(media BootMedia) BootOption {
+	return func(b *bootEntry) {
+		b.media = media
+	}
+}
+
+// Platform sets the platform the boot image is meant for.  The default is
+// PlatformBIOS.
+func Platform(p BootPlatform) BootOption {
+	return func(b *bootEntry) {
+		b.platform = p
+	}
+}
+
+// LoadSegment sets the real mode segment the BIOS loads a no emulation boot
+// image to.  The default is 0x7C0.
+func LoadSegment(segment uint16) BootOption {
+	return func(b *bootEntry) {
+		b.loadSegment = segment
+	}
+}
+
+// LoadSize sets the number of 512 byte sectors of a no emulation boot image
+// that the BIOS loads, such as the 4 that isolinux expects.  By default the
+// whole image is loaded.
+func LoadSize(sectors uint16) BootOption {
+	return func(b *bootEntry) {
+		b.loadSize = sectors
+	}
+}
+
+// BootInfoTable patches a boot info table into bytes 8 to 63 of the boot
+// image, holding the address of the primary volume descriptor, the address
+// and length of the boot image and a checksum over the rest of it, as
+// isolinux and other boot loaders made for mkisofs -boot-info-table expect.
+// The boot image is read into memory to compute the checksum, unless the
+// image is written with FinalizeAt.
+func BootInfoTable() BootOption {
+	return func(b *bootEntry) {
+		b.infoTable = true
+	}
+}
+
+// AddBootImage makes the image bootable through El Torito, using the file
+// added to the image under name as a boot image.  The file may be added
+// before or after the call.  The first boot image becomes the default
+// entry of the boot catalog, and further ones are grouped into sections by
+// platform, so that for example a BIOS image followed by a PlatformEFI image
+// boots on both kinds of firmware.  The boot catalog is recorded in a sector
+// of its own without appearing in any directory.
+func (iw *ImageWriter) AddBootImage(name string, opts ...BootOption) error {
+	// validation entry, default entry and a section header for each
+	// further image
+	if (2*len(iw.boot)+2)*bootCatalogEntrySize > int(SectorSize) {
+		return fmt.Errorf("too many boot images")
+	}
+	b := &bootEntry{path: name}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.media > HardDisk {
+		return fmt.Errorf("invalid boot media type %d", b.media)
+	}
+	iw.boot = append(iw.boot, b)
+	return nil
+}
+
+// layoutBoot resolves the boot images and checks that they are valid for
+// their media type.
+func (iw *ImageWriter) layoutBoot() error {
+	for _, b := range iw.boot {
+		f := iw.lookupFile(b.path)
+		if f == nil {
+			return fmt.Errorf("boot image %s is not in the image", b.path)
+		}
+		if f.Size == 0 {
+			return fmt.Errorf("boot image %s is empty", b.path)
+		} else if f.unitSize != 0 {
+			return fmt.Errorf("boot image %s can't be interleaved", b.path)
+		}
+		if size, ok := floppySizes[b.media]; ok && f.Size != size {
+			return fmt.Errorf("boot image %s of %d bytes does not match the %d bytes of the emulated floppy disk", b.path, f.Size, size)
+		}
+		if b.media == HardDisk && f.open != nil {
+			// EstimateSize has nothing to read
+			systemType, err := readPartitionType(f, b.path)
+			if err != nil {
+				return err
+			}
+			b.systemType = systemType
+		}
+		if b.infoTable {
+			if f.prior {
+				return fmt.Errorf("boot image %s of the previous session can't get a boot info table", b.path)
+			}
+			if f.Size < bootInfoTableEnd {
+				return fmt.Errorf("boot image %s of %d bytes is too small for a boot info table", b.path, f.Size)
+			}
+			// the table is patched in once the image is laid out, or
+			// once it is written with FinalizeAt
+			if f.open != nil && !iw.patchLate {
+				if _, err := f.peek(b.path, int(f.Size)); err != nil {
+					return err
+				}
+			}
+		}
+		b.file = f
+	}
+	return nil
+}
+
+const bootInfoTableEnd = 64
+
+// bootInfoTableFiles returns the boot images that get a boot info table,
+// whose patched data can't be shared with other files.
+func (iw *ImageWriter) bootInfoTableFiles() map[*FileEntry]bool {
+	files := map[*FileEntry]bool{}
+	for _, b := range iw.boot {
+		if b.infoTable {
+			files[b.file] = true
+		}
+	}
+	return files
+}
+
+// patchBootInfoTables replaces the data of boot images that get a boot info
+// table with a patched copy.
+func (iw *ImageWriter) patchBootInfoTables() {
+	for _, b := range iw.boot {
+		if !b.infoTable {
+			continue
+		}
+		f := b.file
+		data := append([]byte(nil), f.head...)
+		var sum bootInfoChecksum
+		sum.Write(data)
+		copy(data[8:bootInfoTableEnd], iw.bootInfoTable(f, sum.sum()))
+		f.contents = data
+	}
+}
+
+// bootInfoTable returns bytes 8 to 63 of the boot image f, holding its boot
+// info table with the checksum sum.
+func (iw *ImageWriter) bootInfoTable(f *FileEntry, sum uint32) []byte {
+	table := make([]byte, bootInfoTableEnd-8)
+	binary.LittleEndian.PutUint32(table, iw.sessionStart+primaryVolumeSectorNum)
+	binary.LittleEndian.PutUint32(table[4:], f.sector+f.xarSectors())
+	binary.LittleEndian.PutUint32(table[8:], uint32(f.Size))
+	binary.LittleEndian.PutUint32(table[12:], sum)
+	return table
+}
+
+// bootInfoChecksum sums the little-endian 32-bit words of the data written
+// to it that follow the boot info table, as the table records.
+type bootInfoChecksum struct {
+	n     int64
+	word  [4]byte
+	total uint32
+}
+
+func (c *bootInfoChecksum) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if c.n >= bootInfoTableEnd {
+			i := (c.n - bootInfoTableEnd) % 4
+			c.word[i] = b
+			if i == 3 {
+				c.total += binary.LittleEndian.Uint32(c.word[:])
+			}
+		}
+		c.n++
+	}
+	return len(p), nil
+}
+
+// sum returns the checksum, counting a final partial word as padded with
+// zeros.
+func (c *bootInfoChecksum) sum() uint32 {
+	total := c.total
+	if c.n > bootInfoTableEnd {
+		if i := (c.n - bootInfoTableEnd) % 4; i != 0 {
+			var word [4]byte
+			copy(word[:i], c.word[:i])
+			total += binary.LittleEndian.Uint32(word[:])
+		}
+	}
+	return total
+}
+
+// readPartitionType reads the master boot record of the hard disk image f
+// and returns the type of its only partition.
+func readPartitionType(f *FileEntry, path string) (byte, error) {
+	mbr, err := f.peek(path, 512)
+	if err != nil {
+		return 0, err
+	} else if len(mbr) < 512 {
+		return 0, fmt.Errorf("boot image %s is too small to hold a master boot record", path)
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xAA {
+		return 0, fmt.Errorf("boot image %s does not start with a master boot record", path)
+	}
+	var systemType byte
+	partitions := 0
+	for i := 0; i < 4; i++ {
+		if t := mbr[446+16*i+4]; t != 0 {
+			systemType = t
+			partitions++
+		}
+	}
+	if partitions != 1 {
+		return 0, fmt.Errorf("boot image %s has %d partitions, but hard disk emulation requires exactly one", path, partitions)
+	}
+	return systemType, nil
+}
+
+// sectorCount returns the number of 512 byte sectors the BIOS loads.
+func (b *bootEntry) sectorCount() uint16 {
+	if b.media != NoEmulation {
+		// the emulated drive is read through the BIOS instead
+		return 1
+	}
+	if b.loadSize != 0 {
+		return b.loadSize
+	}
+	n := (b.file.Size + 511) / 512
+	if n > 0xffff {
+		n = 0xffff
+	}
+	return uint16(n)
+}
+
+func writeBootRecord(w *ISO9660Writer, l *imageLayout) error {
+	sw := w.NextSector()
+	if w.CurrentSector() != l.bootRecordSector {
+		return internalErrorf("unexpected boot record sector %d (expected %d)", w.CurrentSector(), l.bootRecordSector)
+	}
+
+	sw.WriteByte(0)
+	sw.WriteString(volumeDescriptorSetMagic)
+	sw.WriteString(bootSystemID)
+	sw.WriteZeros(32 - len(bootSystemID))
+	sw.WriteZeros(32) // boot identifier
+	sw.WriteLittleEndianDWord(l.bootCatalogSector)
+
+	sw.PadWithZeros()
+	return nil
+}
+
+func writeBootCatalog(w *ISO9660Writer, l *imageLayout, boot []*bootEntry) error {
+	sw := w.NextSector()
+	if w.CurrentSector() != l.bootCatalogSector {
+		return internalErrorf("unexpected boot catalog sector %d (expected %d)", w.CurrentSector(), l.bootCatalogSector)
+	}
+	sw.Write(bootValidationEntry(boot[0].platform))
+	sw.Write(boot[0].catalogEntry())
+	sections := bootSections(boot[1:])
+	for i, section := range sections {
+		header := make([]byte, bootCatalogEntrySize)
+		header[0] = 0x90
+		if i == len(sections)-1 {
+			header[0] = 0x91 // final header
+		}
+		header[1] = byte(section[0].platform)
+		binary.LittleEndian.PutUint16(header[2:], uint16(len(section)))
+		sw.Write(header)
+		for _, b := range section {
+			sw.Write(b.catalogEntry())
+		}
+	}
+	sw.PadWithZeros()
+	return nil
+}
+
+// bootSections groups boot by platform, in the order the platforms first
+// appear.
+func bootSections(boot []*bootEntry) [][]*bootEntry {
+	var sections [][]*bootEntry
+	index := map[BootPlatform]int{}
+	for _, b := range boot {
+		i, ok := index[b.platform]
+		if !ok {
+			i = len(sections)
+			index[b.platform] = i
+			sections = append(sections, nil)
+		}
+		sections[i] = append(sections[i], b)
+	}
+	return sections
+}
+
+// bootValidationEntry returns the validation entry that starts the boot
+// catalog.
+func bootValidationEntry(platform BootPlatform) []byte {
+	e := make([]byte, bootCatalogEntrySize)
+	e[0] = 1 // header ID
+	e[1] = byte(platform)
+	e[30], e[31] = 0x55, 0xAA
+	// the words of the entry must sum up to zero
+	var sum uint16
+	for i := 0; i < len(e); i += 2 {
+		sum += binary.LittleEndian.Uint16(e[i:])
+	}
+	binary.LittleEndian.PutUint16(e[28:], -sum)
+	return e
+}
+
+// catalogEntry returns the boot catalog entry of b.
+func (b *bootEntry) catalogEntry() []byte {
+	e := make([]byte, bootCatalogEntrySize)
+	e[0] = 0x88 // bootable
+	e[1] = byte(b.media)
+	binary.LittleEndian.PutUint16(e[2:], b.loadSegment)
+	e[4] = b.systemType
+	binary.LittleEndian.PutUint16(e[6:], b.sectorCount())
+	binary.LittleEndian.PutUint32(e[8:], b.file.sector+b.file.xarSectors())
+	return e
+}
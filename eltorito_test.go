@@ -0,0 +1,252 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+// hardDiskImage returns a hard disk image of size bytes with a master boot
+// record holding a single FAT16 partition.
+func hardDiskImage(size int) []byte {
+	img := make([]byte, size)
+	e := img[446:]
+	e[0], e[4] = 0x80, 0x06
+	binary.LittleEndian.PutUint32(e[8:], 1)
+	binary.LittleEndian.PutUint32(e[12:], uint32(size/512-1))
+	img[510], img[511] = 0x55, 0xAA
+	return img
+}
+
+func TestElToritoRoundTrip(t *testing.T) {
+	loader := bytes.Repeat([]byte("isolinux"), 1000)
+	floppy := bytes.Repeat([]byte{0xF6}, 1440*1024)
+	hdd := hardDiskImage(64 << 10)
+	efiFiles := map[string][]byte{"EFI/BOOT/BOOTX64.EFI": []byte("MZ efi application")}
+	bootCode := bytes.Repeat([]byte{0x90}, mbrBootCodeSize)
+
+	iw := NewImageWriter(WithHybridMBR(bootCode), WithHybridGPT())
+	for name, data := range map[string][]byte{
+		"ISOLINUX/ISOLINUX.BIN": loader,
+		"IMAGES/FLOPPY.IMG":     floppy,
+		"IMAGES/HDD.IMG":        hdd,
+		"README.TXT":            []byte("bootable"),
+	} {
+		if err := iw.AddBytes(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := iw.AddBootImage("ISOLINUX/ISOLINUX.BIN", LoadSize(4), BootInfoTable()); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBootImage("IMAGES/FLOPPY.IMG", Emulate(Floppy1440)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBootImage("IMAGES/HDD.IMG", Emulate(HardDisk)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddEFIBootImage("EFI/EFIBOOT.IMG", efiFiles); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, iw)
+
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := readTree(t, ir)
+	images, err := ir.BootImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		path       string
+		platform   BootPlatform
+		media      BootMedia
+		loadSize   uint16
+		systemType byte
+	}{
+		{"ISOLINUX/ISOLINUX.BIN", PlatformBIOS, NoEmulation, 4, 0},
+		{"IMAGES/FLOPPY.IMG", PlatformBIOS, Floppy1440, 1, 0},
+		{"IMAGES/HDD.IMG", PlatformBIOS, HardDisk, 1, 0x06},
+		{"EFI/EFIBOOT.IMG", PlatformEFI, NoEmulation, 0, 0},
+	}
+	if len(images) != len(want) {
+		t.Fatalf("boot catalog holds %d images, want %d", len(images), len(want))
+	}
+	lba := map[string]uint32{}
+	for i, w := range want {
+		info, err := ir.Stat(w.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lba[w.path] = info.LBA
+		got := images[i]
+		if !got.Bootable || got.Platform != w.platform || got.Media != w.media || got.LBA != info.LBA || got.SystemType != w.systemType {
+			t.Errorf("boot image %d is %+v, want %s at sector %d", i, got, w.path, info.LBA)
+		}
+		if w.loadSize != 0 && got.LoadSize != w.loadSize {
+			t.Errorf("boot image %d loads %d sectors, want %d", i, got.LoadSize, w.loadSize)
+		}
+	}
+
+	// the boot info table of isolinux
+	patched := []byte(tree["ISOLINUX/ISOLINUX.BIN"])
+	var sum uint32
+	for i := bootInfoTableEnd; i < len(loader); i += 4 {
+		sum += binary.LittleEndian.Uint32(loader[i:])
+	}
+	table := patched[8:bootInfoTableEnd]
+	for i, w := range []uint32{primaryVolumeSectorNum, lba["ISOLINUX/ISOLINUX.BIN"], uint32(len(loader)), sum} {
+		if got := binary.LittleEndian.Uint32(table[4*i:]); got != w {
+			t.Errorf("boot info table field %d is %d, want %d", i, got, w)
+		}
+	}
+	if !bytes.Equal(patched[:8], loader[:8]) || !bytes.Equal(patched[bootInfoTableEnd:], loader[bootInfoTableEnd:]) {
+		t.Error("boot info table changed bytes outside of it")
+	}
+
+	// the hybrid MBR and the GPT
+	if img[510] != 0x55 || img[511] != 0xAA || !bytes.Equal(img[:mbrBootCodeSize], bootCode) {
+		t.Error("system area doesn't start with the MBR")
+	}
+	if got := binary.LittleEndian.Uint64(img[432:]); got != uint64(lba["ISOLINUX/ISOLINUX.BIN"])*4 {
+		t.Errorf("MBR gives the boot image at block %d, want %d", got, lba["ISOLINUX/ISOLINUX.BIN"]*4)
+	}
+	if e := img[446:]; e[0] != 0x80 || e[4] != hybridPartitionType || binary.LittleEndian.Uint32(e[12:]) != uint32(len(img)/512) {
+		t.Errorf("first MBR partition is % x, want the whole image", e[:16])
+	}
+	espStart := uint64(lba["EFI/EFIBOOT.IMG"]) * 4
+	if e := img[446+16:]; e[4] != mbrEFIType || uint64(binary.LittleEndian.Uint32(e[8:])) != espStart {
+		t.Errorf("second MBR partition is % x, want the EFI system partition at block %d", e[:16], espStart)
+	}
+	for _, off := range []int{gptBlockSize, len(img) - gptBlockSize} {
+		h := append([]byte(nil), img[off:off+gptBlockSize]...)
+		if string(h[:8]) != "EFI PART" {
+			t.Fatalf("no GPT header at offset %d", off)
+		}
+		headerSum := binary.LittleEndian.Uint32(h[16:])
+		binary.LittleEndian.PutUint32(h[16:], 0)
+		if crc32.ChecksumIEEE(h[:gptHeaderSize]) != headerSum {
+			t.Errorf("GPT header at offset %d has a bad checksum", off)
+		}
+		entriesLBA := binary.LittleEndian.Uint64(h[72:])
+		entries := img[entriesLBA*gptBlockSize : entriesLBA*gptBlockSize+gptNumEntries*gptEntrySize]
+		if crc32.ChecksumIEEE(entries) != binary.LittleEndian.Uint32(h[88:]) {
+			t.Errorf("partition entries of the GPT header at offset %d have a bad checksum", off)
+		}
+		if !bytes.Equal(entries[:16], parseGUID(efiSystemPartitionGUID)) || binary.LittleEndian.Uint64(entries[32:]) != espStart {
+			t.Errorf("first GPT partition of the header at offset %d is not the EFI system partition at block %d", off, espStart)
+		}
+	}
+
+	// the FAT image of the EFI system partition
+	esp := []byte(tree["EFI/EFIBOOT.IMG"])
+	if got := readFATFile(t, esp, "EFI/BOOT/BOOTX64.EFI"); !bytes.Equal(got, efiFiles["EFI/BOOT/BOOTX64.EFI"]) {
+		t.Errorf("EFI system partition holds %q", got)
+	}
+
+	// bsdtar doesn't list the boot catalog, which appears in no directory
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), tree)
+}
+
+func TestElToritoAPM(t *testing.T) {
+	iw := NewImageWriter(WithAPM("EFI/EFIBOOT.IMG"))
+	if err := iw.AddEFIBootImage("EFI/EFIBOOT.IMG", map[string][]byte{"EFI/BOOT/BOOTX64.EFI": []byte("MZ")}); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, iw)
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := ir.Stat("EFI/EFIBOOT.IMG")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(img[:2]) != "ER" || binary.BigEndian.Uint16(img[2:]) != uint16(SectorSize) || binary.BigEndian.Uint32(img[4:]) != uint32(len(img))/SectorSize {
+		t.Errorf("driver descriptor record is % x", img[:8])
+	}
+	for i, w := range []struct {
+		start, count uint32
+		typ          string
+	}{
+		{1, 2, "Apple_partition_map"},
+		{info.LBA, uint32(numDataSectors(info.Size)), "Apple_HFS"},
+	} {
+		e := img[uint32(i+1)*SectorSize:]
+		typ := string(bytes.TrimRight(e[48:80], "\x00"))
+		if string(e[:2]) != "PM" || binary.BigEndian.Uint32(e[4:]) != 2 || binary.BigEndian.Uint32(e[8:]) != w.start || binary.BigEndian.Uint32(e[12:]) != w.count || typ != w.typ {
+			t.Errorf("Apple partition %d is % x, want %s at block %d of %d blocks", i+1, e[:16], w.typ, w.start, w.count)
+		}
+	}
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), readTree(t, ir))
+}
+
+func TestBootImagesHostile(t *testing.T) {
+	iw := NewImageWriter()
+	for _, name := range []string{"BIOS.BIN", "EFI.IMG"} {
+		if err := iw.AddBytes(name, make([]byte, 4096)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := iw.AddBootImage("BIOS.BIN"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBootImage("EFI.IMG", Platform(PlatformEFI)); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, iw)
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, ok, err := ir.bootCatalogSector()
+	if err != nil || !ok {
+		t.Fatalf("no boot catalog: %v", err)
+	}
+	header := int(catalog*SectorSize) + 2*bootCatalogEntrySize
+	if img[header] != 0x91 {
+		t.Fatalf("boot catalog has no final section header at offset %d", header)
+	}
+
+	for _, tc := range []struct {
+		desc   string
+		change func(b []byte)
+		opts   []ReaderOption
+		want   string
+	}{
+		{"too many entries", func(b []byte) {
+			binary.LittleEndian.PutUint16(b[header+2:], 0xFFFF)
+		}, nil, "section of 65535 entries exceeds the catalog"},
+		{"no final header", func(b []byte) {
+			for i := header; i+bootCatalogEntrySize <= len(b); i += bootCatalogEntrySize {
+				b[i], b[i+2], b[i+3] = 0x90, 0, 0
+			}
+		}, nil, "is truncated"},
+		{"outside the image", func(b []byte) {
+			for vd := b[(primaryVolumeSectorNum+1)*SectorSize:]; ; vd = vd[SectorSize:] {
+				if vd[0] == 0 {
+					binary.LittleEndian.PutUint32(vd[71:], 0xFFFFFFF0)
+					return
+				}
+			}
+		}, nil, "exceeds the image"},
+		{"memory limit", func(b []byte) {}, []ReaderOption{MemoryLimit(1024)}, "exceeds the memory limit"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			b := append([]byte(nil), img...)
+			tc.change(b)
+			ir, err := ReadImage(b, tc.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if images, err := ir.BootImages(); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("BootImages returned %d images and %v, want an error containing %q", len(images), err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package iso9660wrap
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrSectorBounds is returned when a write would extend past the end of
+	// the current sector.
+	ErrSectorBounds = errors.New("write out of sector bounds")
+
+	// ErrInputSizeChanged is returned when an input yields a different
+	// number of bytes than were planned for it.
+	ErrInputSizeChanged = errors.New("input file size changed while the ISO file was being created")
+
+	// ErrInternal is returned when what was written disagrees with the
+	// planned layout of the image.  It indicates a bug in this package.
+	ErrInternal = errors.New("internal error")
+
+	// ErrChecksumMismatch is returned when an image doesn't match the
+	// checksum embedded in it.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+
+	// ErrNoChecksum is returned when verifying an image that has no
+	// checksum embedded in it.
+	ErrNoChecksum = errors.New("image holds no implanted checksum")
+
+	// ErrVerificationFailed is returned when an image read back after
+	// writing it with WithVerify differs from what was written.
+	ErrVerificationFailed = errors.New("image read back differs from its inputs")
+
+	// ErrLimitExceeded is returned when an image being read exceeds the
+	// limits set with MaxDepth or MemoryLimit.
+	ErrLimitExceeded = errors.New("image exceeds the limits of the reader")
+)
+
+// InputError records a failure to open or read one of the inputs of an
+// image.
+type InputError struct {
+	// Path is the path of the input within the image.
+	Path string
+	Err  error
+}
+
+func (e *InputError) Error() string {
+	return "input file " + e.Path + ": " + e.Err.Error()
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+func internalErrorf(format string, v ...interface{}) error {
+	return fmt.Errorf("%w: "+format, append([]interface{}{ErrInternal}, v...)...)
+}
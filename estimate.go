@@ -0,0 +1,40 @@
+package iso9660wrap
+
+import "strings"
+
+// EstimateSize returns the exact size in bytes of an image holding files,
+// including the reserved sectors, volume descriptors, path tables, directory
+// extents and the padding of every file to whole sectors.  The Name of each
+// entry is its slash-separated path in the image, and only Name and Size are
+// used.  A Name ending in "/" stands for a directory, so that empty
+// directories can be accounted for.  Nothing is opened, read or written.
+func EstimateSize(files []FileEntry, opts ...Option) (int64, error) {
+	iw := NewImageWriter(opts...)
+	for _, f := range files {
+		var err error
+		if strings.HasSuffix(f.Name, "/") {
+			err = iw.AddDir(f.Name)
+		} else {
+			err = iw.add(f.Name, f.Size, nil)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	return iw.Size()
+}
+
+// Size returns the size in bytes of the image Finalize would write with the
+// entries scheduled so far.  For a session set with WithSessionStart, that
+// is the size of the session alone.
+func (iw *ImageWriter) Size() (int64, error) {
+	err := iw.options.validate()
+	if err != nil {
+		return 0, err
+	}
+	l, err := iw.layout()
+	if err != nil {
+		return 0, err
+	}
+	return int64(l.numSectors-l.sessionStart) * int64(SectorSize), nil
+}
@@ -0,0 +1,36 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxEnhancedIdentifierLength is the longest identifier ISO 9660:1999
+// permits.
+const maxEnhancedIdentifierLength = 207
+
+// WithEnhancedVolume adds an enhanced volume descriptor, which ISO 9660:1999
+// defines as a supplementary volume descriptor of version 2, as mkisofs
+// -iso-level 4 does.  Its hierarchy records entries under the names they
+// were added with, in up to 207 bytes and without versions, and nests
+// directories as deep as they are, so readers that prefer it need neither
+// Joliet nor Rock Ridge for such names.  The primary volume is recorded as
+// usual, so combine it with WithNameMangling for names that aren't valid
+// identifiers there.
+func WithEnhancedVolume() Option {
+	return WithSupplementaryVolume(SupplementaryVolume{
+		EncodeName: enhancedName,
+		enhanced:   true,
+	})
+}
+
+// enhancedName returns the identifier recorded for name in an enhanced
+// volume.
+func enhancedName(name string, dir bool) (string, error) {
+	if len(name) > maxEnhancedIdentifierLength {
+		return "", fmt.Errorf("name %s is longer than %d bytes", name, maxEnhancedIdentifierLength)
+	} else if strings.ContainsAny(name, "\x00/") {
+		return "", fmt.Errorf("name %q contains a NUL byte or '/'", name)
+	}
+	return name, nil
+}
@@ -0,0 +1,142 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Extract copies the files and directories of the image at the given
+// slash-separated paths, or all of them if none are given, into the local
+// directory dir, setting the modification times of files to their recording
+// dates.  Files are copied by workers goroutines at once, each reading its
+// own extents from the underlying io.ReaderAt, which speeds up extraction
+// of large images to fast storage; workers of 0 or less means
+// runtime.GOMAXPROCS(0).  Directories are created before any file in them
+// is written.  Files and directories get the permissions Rock Ridge records
+// for them if the Reader exposes Rock Ridge names, directories only once
+// everything in them is written, and symbolic links are created after all
+// files, so that nothing is written through them.  Extract stops at the
+// first error, and fails if one of paths is not in the image.
+func (ir *Reader) Extract(dir string, workers int, paths ...string) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	selected := make([]string, len(paths))
+	for i, p := range paths {
+		selected[i] = strings.Trim(p, "/")
+	}
+	found := make([]bool, len(selected))
+
+	jobs := make(chan ISOFileInfo)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for info := range jobs {
+				if failed() != nil {
+					// drain the remaining jobs
+					continue
+				}
+				if err := ir.extractFile(&info, filepath.Join(dir, filepath.FromSlash(info.Path))); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	var dirs, links []ISOFileInfo
+	err := ir.Walk(func(info ISOFileInfo) error {
+		if err := failed(); err != nil {
+			return err
+		}
+		if len(selected) > 0 {
+			match := false
+			for i, p := range selected {
+				if p == "" || info.Path == p || strings.HasPrefix(info.Path, p+"/") {
+					match, found[i] = true, true
+				}
+			}
+			if !match {
+				return nil
+			}
+		}
+		target := filepath.Join(dir, filepath.FromSlash(info.Path))
+		if info.IsDir() {
+			if info.hasPerm {
+				dirs = append(dirs, info)
+			}
+			return os.MkdirAll(target, 0777)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0777); err != nil {
+			return err
+		}
+		if info.symlink != "" {
+			links = append(links, info)
+			return nil
+		}
+		jobs <- info
+		return nil
+	})
+	close(jobs)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	} else if err != nil {
+		return err
+	}
+	for i, p := range paths {
+		if !found[i] {
+			return fmt.Errorf("%s is not in the image", p)
+		}
+	}
+	for _, info := range links {
+		if err := os.Symlink(filepath.FromSlash(info.symlink), filepath.Join(dir, filepath.FromSlash(info.Path))); err != nil {
+			return fmt.Errorf("extracting %s: %w", info.Path, err)
+		}
+	}
+	// subdirectories come after their parents
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(filepath.Join(dir, filepath.FromSlash(dirs[i].Path)), dirs[i].perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile copies the data of the file info to the local file target.
+func (ir *Reader) extractFile(info *ISOFileInfo, target string) error {
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	buf := chunkPool.Get().(*[prefetchChunkSize]byte)
+	_, err = io.CopyBuffer(out, ir.open(info), buf[:])
+	chunkPool.Put(buf)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && info.hasPerm {
+		err = os.Chmod(target, info.perm)
+	}
+	if err != nil {
+		return fmt.Errorf("extracting %s: %w", info.Path, err)
+	}
+	return os.Chtimes(target, info.ModTime, info.ModTime)
+}
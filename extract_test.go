@@ -0,0 +1,134 @@
+package iso9660wrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// extractDir returns a directory to extract into, which is made writable
+// again before it is removed.
+func extractDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	t.Cleanup(func() {
+		filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+			if err == nil && fi.IsDir() {
+				os.Chmod(path, 0755)
+			}
+			return nil
+		})
+	})
+	return dir
+}
+
+func TestExtract(t *testing.T) {
+	stamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	iw := NewImageWriter(WithRockRidge(), WithTimestamp(stamp))
+	files := map[string]struct {
+		data string
+		perm os.FileMode
+	}{
+		"README.TXT":           {"readme", 0444},
+		"bin/tool":             {"tool", 0755},
+		"etc/secret":           {"secret", 0600},
+		"a/b/c/d/e/f/g/h/deep": {"deep", 0640},
+	}
+	for name, f := range files {
+		if err := iw.AddBytes(name, []byte(f.data), POSIXAttributes(f.perm, 0, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range map[string]string{
+		"link":         "bin/tool",
+		"a/b/c/up":     "../..",
+		"etc/absolute": "/etc/passwd",
+	} {
+		if err := iw.AddSymlink(name, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ir, err := ReadImage(writeImage(t, iw))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{0, 1, 4} {
+		dir := extractDir(t)
+		if err := ir.Extract(dir, workers); err != nil {
+			t.Fatal(err)
+		}
+		for name, f := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			fi, err := os.Lstat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode() != f.perm || !fi.ModTime().Equal(stamp) {
+				t.Errorf("%d workers: %s is %v from %v, want %v from %v", workers, name, fi.Mode(), fi.ModTime(), f.perm, stamp)
+			}
+			if b, err := ioutil.ReadFile(path); err != nil || string(b) != f.data {
+				t.Errorf("%d workers: %s holds %q: %v", workers, name, b, err)
+			}
+		}
+		for name, want := range map[string]string{"link": "bin/tool", "a/b/c/up": "../..", "etc/absolute": "/etc/passwd"} {
+			if got, err := os.Readlink(filepath.Join(dir, filepath.FromSlash(name))); err != nil || filepath.ToSlash(got) != want {
+				t.Errorf("%d workers: %s links to %q: %v", workers, name, got, err)
+			}
+		}
+		// directories are read-only, as Rock Ridge records by default
+		for _, name := range []string{"bin", "a/b/c/d/e/f/g/h"} {
+			if fi, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil || fi.Mode() != os.ModeDir|0555 {
+				t.Errorf("%d workers: directory %s is %v: %v", workers, name, fi.Mode(), err)
+			}
+		}
+	}
+
+	// extracting some of the image
+	dir := extractDir(t)
+	if err := ir.Extract(dir, 2, "/a/b/c/", "bin"); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && !fi.IsDir() {
+			got = append(got, filepath.ToSlash(path[len(dir)+1:]))
+		}
+		return err
+	})
+	if want := "a/b/c/d/e/f/g/h/deep a/b/c/up bin/tool"; strings.Join(got, " ") != want {
+		t.Errorf("extracted %q, want %q", got, want)
+	}
+	if err := ir.Extract(extractDir(t), 1, "missing"); err == nil || !strings.Contains(err.Error(), "missing is not in the image") {
+		t.Errorf("Extract of a missing path returned %v", err)
+	}
+}
+
+func TestExtractPrimaryNames(t *testing.T) {
+	iw := NewImageWriter(WithRockRidge())
+	if err := iw.AddBytes("DIR/FILE.TXT", []byte("data"), POSIXAttributes(0700, 0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddSymlink("LINK", "DIR/FILE.TXT"); err != nil {
+		t.Fatal(err)
+	}
+	ir, err := ReadImage(writeImage(t, iw), UseNames(PrimaryNames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := extractDir(t)
+	if err := ir.Extract(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	// without Rock Ridge the permissions are those of new files and links
+	// are empty files
+	if fi, err := os.Lstat(filepath.Join(dir, "LINK")); err != nil || !fi.Mode().IsRegular() || fi.Size() != 0 {
+		t.Errorf("LINK is %v: %v", fi, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "DIR", "FILE.TXT")); err != nil || fi.Mode().Perm() == 0700 {
+		t.Errorf("FILE.TXT is %v: %v", fi, err)
+	}
+}
@@ -0,0 +1,279 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	fatSectorSize  = 512
+	fatRootEntries = 512
+	fatEntrySize   = 32
+	fatMedia       = 0xF8
+
+	fatAttrDirectory = 0x10
+	fatAttrArchive   = 0x20
+
+	// fatDate is 1980-01-01, the earliest date FAT can record, which every
+	// entry gets so that images are reproducible.
+	fatDate = 1<<5 | 1
+)
+
+// AddEFIBootImage builds a FAT image holding files, adds it to the image
+// under name and registers it as a PlatformEFI boot image, so that UEFI
+// firmware can boot the image without any tools beyond this package.  files
+// maps slash-separated paths within the FAT image to their contents; UEFI
+// firmware looks for EFI/BOOT/BOOTX64.EFI on x86-64 systems.
+func (iw *ImageWriter) AddEFIBootImage(name string, files map[string][]byte, opts ...BootOption) error {
+	img, err := MakeFATImage(files)
+	if err != nil {
+		return err
+	}
+	err = iw.add(name, int64(len(img)), func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(img)), nil
+	})
+	if err != nil {
+		return err
+	}
+	return iw.AddBootImage(name, append([]BootOption{Platform(PlatformEFI)}, opts...)...)
+}
+
+// fatNode is a file or directory of a FAT image under construction.
+type fatNode struct {
+	name     [11]byte
+	data     []byte
+	children []*fatNode // nil for files
+	dir      bool
+
+	cluster  uint32
+	clusters uint32
+}
+
+// MakeFATImage returns a FAT12 or FAT16 file system image, whichever fits,
+// holding files.  files maps slash-separated paths to their contents.  Every
+// path component must be a valid 8.3 name; long names are not supported.
+func MakeFATImage(files map[string][]byte) ([]byte, error) {
+	root := &fatNode{dir: true}
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if err := root.add(splitPath(p), files[p]); err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+	}
+	if len(root.children) > fatRootEntries {
+		return nil, fmt.Errorf("FAT root directory can't hold %d entries", len(root.children))
+	}
+
+	// find the smallest cluster size that FAT16 can address
+	var spc, numClusters uint32
+	for spc = 1; ; spc *= 2 {
+		if spc > 64 {
+			return nil, fmt.Errorf("files are too large for a FAT16 image")
+		}
+		numClusters = 0
+		root.allocate(spc*fatSectorSize, &numClusters)
+		if numClusters < 65525 {
+			break
+		}
+	}
+	fat16 := numClusters >= 4085
+
+	// FAT12 entries take a byte and a half, the last one rounded up
+	fatBytes := ((numClusters+2)*3 + 1) / 2
+	if fat16 {
+		fatBytes = (numClusters + 2) * 2
+	}
+	fatSectors := (fatBytes + fatSectorSize - 1) / fatSectorSize
+	rootSectors := uint32(fatRootEntries * fatEntrySize / fatSectorSize)
+	dataStart := 1 + 2*fatSectors + rootSectors
+	totalSectors := dataStart + numClusters*spc
+
+	img := make([]byte, totalSectors*fatSectorSize)
+	writeFATBootSector(img, spc, fatSectors, totalSectors, fat16)
+
+	fat := img[fatSectorSize : fatSectorSize+fatSectors*fatSectorSize]
+	setEntry := func(n, v uint32) {
+		if fat16 {
+			binary.LittleEndian.PutUint16(fat[2*n:], uint16(v))
+			return
+		}
+		o := n * 3 / 2
+		if n%2 == 0 {
+			fat[o] = byte(v)
+			fat[o+1] = fat[o+1]&0xF0 | byte(v>>8)&0x0F
+		} else {
+			fat[o] = fat[o]&0x0F | byte(v<<4)
+			fat[o+1] = byte(v >> 4)
+		}
+	}
+	eoc := uint32(0xFFF)
+	if fat16 {
+		eoc = 0xFFFF
+	}
+	setEntry(0, eoc&^0xFF|fatMedia)
+	setEntry(1, eoc)
+
+	// cluster returns the image from the start of cluster c
+	cluster := func(c uint32) []byte {
+		return img[(dataStart+(c-2)*spc)*fatSectorSize:]
+	}
+	var write func(n, parent *fatNode)
+	write = func(n, parent *fatNode) {
+		for i := uint32(0); i < n.clusters; i++ {
+			next := n.cluster + i + 1
+			if i == n.clusters-1 {
+				next = eoc
+			}
+			setEntry(n.cluster+i, next)
+		}
+		if !n.dir {
+			copy(cluster(n.cluster), n.data)
+			return
+		}
+		var entries []byte
+		if parent != nil {
+			dot := &fatNode{dir: true, cluster: n.cluster}
+			copy(dot.name[:], ".          ")
+			dotdot := &fatNode{dir: true, cluster: parent.cluster}
+			copy(dotdot.name[:], "..         ")
+			entries = append(entries, dot.entry()...)
+			entries = append(entries, dotdot.entry()...)
+		}
+		for _, c := range n.children {
+			entries = append(entries, c.entry()...)
+			write(c, n)
+		}
+		if parent == nil {
+			copy(img[(1+2*fatSectors)*fatSectorSize:], entries)
+		} else {
+			copy(cluster(n.cluster), entries)
+		}
+	}
+	write(root, nil)
+	// the second FAT is a copy of the first
+	copy(img[fatSectorSize+fatSectors*fatSectorSize:], fat)
+	return img, nil
+}
+
+// add adds a file with the given path components and data below n.
+func (n *fatNode) add(components []string, data []byte) error {
+	if len(components) == 0 {
+		return fmt.Errorf("invalid path")
+	}
+	name, err := fatName(components[0])
+	if err != nil {
+		return err
+	}
+	for _, c := range n.children {
+		if c.name == name {
+			if len(components) == 1 || !c.dir {
+				return fmt.Errorf("%s already exists", components[0])
+			}
+			return c.add(components[1:], data)
+		}
+	}
+	c := &fatNode{name: name, dir: len(components) > 1}
+	n.children = append(n.children, c)
+	if !c.dir {
+		c.data = data
+		return nil
+	}
+	return c.add(components[1:], data)
+}
+
+// allocate assigns consecutive clusters of clusterSize bytes to the nodes
+// below n, counting them in numClusters.  The root directory has an area
+// of its own.
+func (n *fatNode) allocate(clusterSize uint32, numClusters *uint32) {
+	for _, c := range n.children {
+		size := uint32(len(c.data))
+		if c.dir {
+			size = uint32(len(c.children)+2) * fatEntrySize
+		}
+		c.clusters = (size + clusterSize - 1) / clusterSize
+		c.cluster = 0
+		if c.clusters > 0 {
+			c.cluster = 2 + *numClusters
+		}
+		*numClusters += c.clusters
+		if c.dir {
+			c.allocate(clusterSize, numClusters)
+		}
+	}
+}
+
+// entry returns the directory entry of n.
+func (n *fatNode) entry() []byte {
+	e := make([]byte, fatEntrySize)
+	copy(e, n.name[:])
+	e[11] = fatAttrArchive
+	if n.dir {
+		e[11] = fatAttrDirectory
+	}
+	binary.LittleEndian.PutUint16(e[16:], fatDate) // creation date
+	binary.LittleEndian.PutUint16(e[18:], fatDate) // last access date
+	binary.LittleEndian.PutUint16(e[24:], fatDate) // modification date
+	binary.LittleEndian.PutUint16(e[26:], uint16(n.cluster))
+	if !n.dir {
+		binary.LittleEndian.PutUint32(e[28:], uint32(len(n.data)))
+	}
+	return e
+}
+
+// fatName returns the 8.3 directory entry name of name.
+func fatName(name string) ([11]byte, error) {
+	var n [11]byte
+	base, ext := splitExtension(strings.ToUpper(name))
+	if base == "" || len(base) > 8 || len(ext) > 3 || !fatCharacters(base) || !fatCharacters(ext) {
+		return n, fmt.Errorf("%s is not a valid 8.3 name", name)
+	}
+	copy(n[:], base+strings.Repeat(" ", 8-len(base))+ext+strings.Repeat(" ", 3-len(ext)))
+	return n, nil
+}
+
+func fatCharacters(s string) bool {
+	for _, r := range s {
+		if !(r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'()-@^_`{}~", r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func writeFATBootSector(img []byte, spc, fatSectors, totalSectors uint32, fat16 bool) {
+	b := img[:fatSectorSize]
+	copy(b, []byte{0xEB, 0x3C, 0x90})
+	copy(b[3:11], "MSWIN4.1")
+	binary.LittleEndian.PutUint16(b[11:], fatSectorSize)
+	b[13] = byte(spc)
+	binary.LittleEndian.PutUint16(b[14:], 1) // reserved sectors
+	b[16] = 2                                // number of FATs
+	binary.LittleEndian.PutUint16(b[17:], fatRootEntries)
+	if totalSectors < 0x10000 {
+		binary.LittleEndian.PutUint16(b[19:], uint16(totalSectors))
+	} else {
+		binary.LittleEndian.PutUint32(b[32:], totalSectors)
+	}
+	b[21] = fatMedia
+	binary.LittleEndian.PutUint16(b[22:], uint16(fatSectors))
+	binary.LittleEndian.PutUint16(b[24:], 32) // sectors per track
+	binary.LittleEndian.PutUint16(b[26:], 64) // heads
+	b[36] = 0x80                              // drive number
+	b[38] = 0x29                              // extended boot signature
+	copy(b[43:54], "EFIBOOT    ")
+	if fat16 {
+		copy(b[54:62], "FAT16   ")
+	} else {
+		copy(b[54:62], "FAT12   ")
+	}
+	b[510], b[511] = 0x55, 0xAA
+}
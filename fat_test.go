@@ -0,0 +1,164 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// readFATFile returns the data of the file at path in the FAT image img,
+// following its cluster chain.
+func readFATFile(t *testing.T, img []byte, path string) []byte {
+	t.Helper()
+	spc := uint32(img[13])
+	fatSectors := uint32(binary.LittleEndian.Uint16(img[22:]))
+	rootEntries := uint32(binary.LittleEndian.Uint16(img[17:]))
+	fat16 := string(img[54:62]) == "FAT16   "
+	fat := img[fatSectorSize : (1+fatSectors)*fatSectorSize]
+	if !bytes.Equal(fat, img[(1+fatSectors)*fatSectorSize:(1+2*fatSectors)*fatSectorSize]) {
+		t.Fatal("the two FATs differ")
+	}
+	rootStart := (1 + 2*fatSectors) * fatSectorSize
+	dataStart := rootStart + rootEntries*fatEntrySize
+	clusterSize := spc * fatSectorSize
+
+	next := func(c uint32) uint32 {
+		if fat16 {
+			return uint32(binary.LittleEndian.Uint16(fat[2*c:]))
+		}
+		v := uint32(binary.LittleEndian.Uint16(fat[c*3/2:]))
+		if c%2 == 1 {
+			return v >> 4
+		}
+		return v & 0xFFF
+	}
+	eoc := uint32(0xFF8)
+	if fat16 {
+		eoc = 0xFFF8
+	}
+	chain := func(first uint32) []byte {
+		var data []byte
+		for c := first; c >= 2 && c < eoc; c = next(c) {
+			off := dataStart + (c-2)*clusterSize
+			data = append(data, img[off:off+clusterSize]...)
+		}
+		return data
+	}
+
+	dir := img[rootStart:dataStart]
+	components := strings.Split(path, "/")
+	for i, c := range components {
+		name, err := fatName(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for e := 0; e+fatEntrySize <= len(dir); e += fatEntrySize {
+			entry := dir[e : e+fatEntrySize]
+			if !bytes.Equal(entry[:11], name[:]) {
+				continue
+			}
+			data := chain(uint32(binary.LittleEndian.Uint16(entry[26:])))
+			if i == len(components)-1 {
+				return data[:binary.LittleEndian.Uint32(entry[28:])]
+			}
+			dir, found = data, true
+			break
+		}
+		if !found {
+			t.Fatalf("%s not found in the FAT image", path)
+		}
+	}
+	return nil
+}
+
+func TestMakeFATImageClusterCounts(t *testing.T) {
+	// Besides the file, EFI and EFI/BOOT take a cluster each, and the FAT
+	// holds two reserved entries, so a file of n sectors needs n+4 FAT12
+	// entries.  Try the entry counts around every sector boundary of the
+	// table that FAT12 reaches.
+	var sizes []int
+	for boundary := fatSectorSize; boundary*2/3 < 4085; boundary += fatSectorSize {
+		for entries := boundary*2/3 - 2; entries <= boundary*2/3+2; entries++ {
+			if n := entries - 4; n > 0 && n+2 < 4085 {
+				sizes = append(sizes, n*fatSectorSize, n*fatSectorSize-1)
+			}
+		}
+	}
+	sizes = append(sizes, 679*fatSectorSize) // 681 clusters
+	for _, size := range sizes {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			data := bytes.Repeat([]byte{0xA5, 0x5A, 0x3C}, size/3+1)[:size]
+			img, err := MakeFATImage(map[string][]byte{"EFI/BOOT/BOOTX64.EFI": data})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(img[54:62]); got != "FAT12   " {
+				t.Fatalf("file system type %q, want FAT12", got)
+			}
+			if got := readFATFile(t, img, "EFI/BOOT/BOOTX64.EFI"); !bytes.Equal(got, data) {
+				t.Errorf("file read back holds %d bytes differing from the %d written", len(got), len(data))
+			}
+		})
+	}
+}
+
+func TestMakeFATImageFAT16(t *testing.T) {
+	files := map[string][]byte{
+		"EFI/BOOT/BOOTX64.EFI":  bytes.Repeat([]byte("x64"), 1<<20),
+		"EFI/BOOT/BOOTIA32.EFI": bytes.Repeat([]byte("ia32"), 1000),
+		"STARTUP.NSH":           []byte("\\EFI\\BOOT\\BOOTX64.EFI\r\n"),
+	}
+	img, err := MakeFATImage(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(img[54:62]); got != "FAT16   " {
+		t.Fatalf("file system type %q, want FAT16", got)
+	}
+	for path, want := range files {
+		if got := readFATFile(t, img, path); !bytes.Equal(got, want) {
+			t.Errorf("%s read back differs from what was written", path)
+		}
+	}
+}
+
+func TestMakeFATImageInvalidNames(t *testing.T) {
+	for _, name := range []string{"TOOLONGNAME.EFI", "A.LONG", "SP ACE", ""} {
+		if _, err := MakeFATImage(map[string][]byte{name: []byte("x")}); err == nil {
+			t.Errorf("MakeFATImage accepted %q", name)
+		}
+	}
+}
+
+func TestAddEFIBootImageRoundTrip(t *testing.T) {
+	files := map[string][]byte{
+		"EFI/BOOT/BOOTX64.EFI": bytes.Repeat([]byte("x64"), 100000),
+		"EFI/BOOT/GRUB.CFG":    []byte("set timeout=5\n"),
+		"STARTUP.NSH":          []byte("\\EFI\\BOOT\\BOOTX64.EFI\r\n"),
+	}
+	for i := 0; i < 40; i++ {
+		// more entries than a single sector of a subdirectory holds
+		files[fmt.Sprintf("EFI/TOOLS/TOOL%02d.EFI", i)] = []byte(fmt.Sprint(i))
+	}
+	iw := NewImageWriter(WithRockRidge())
+	if err := iw.AddEFIBootImage("boot/efi.img", files); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, iw)
+
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := readTree(t, ir)
+	esp := []byte(tree["boot/efi.img"])
+	for path, want := range files {
+		if got := readFATFile(t, esp, path); !bytes.Equal(got, want) {
+			t.Errorf("%s read back from the image differs from what was written", path)
+		}
+	}
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), tree)
+}
@@ -0,0 +1,80 @@
+package iso9660wrap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+)
+
+// AddFileList schedules the local files and directories listed in r for
+// inclusion in the image, as find(1) prints them: one path per line, or
+// separated by NUL bytes if sep is 0, as with find -print0.  Each entry keeps
+// its path in the image, relative to the root directory, so that a listed
+// directory becomes an empty directory of the image unless its contents are
+// listed too.  Symbolic links are handled according to WithSymlinkPolicy,
+// where following a link to a directory adds the directory alone.  Absolute
+// paths are recorded without their leading "/", and
+// paths may not contain "..".
+func (iw *ImageWriter) AddFileList(r io.Reader, sep byte) error {
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString(sep)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		path := strings.TrimSuffix(line, string(sep))
+		if sep == '\n' {
+			path = strings.TrimSuffix(path, "\r")
+		}
+		if path != "" {
+			if aerr := iw.addListedFile(path); aerr != nil {
+				return aerr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (iw *ImageWriter) addListedFile(path string) error {
+	isoPath := strings.TrimPrefix(pathpkg.Clean("/"+filepath.ToSlash(path)), "/")
+	for _, c := range strings.Split(filepath.ToSlash(path), "/") {
+		if c == ".." {
+			return fmt.Errorf("listed path %s leads outside the image", path)
+		}
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		handled, err := iw.applySymlinkPolicy(isoPath, func() (string, error) {
+			return os.Readlink(path)
+		})
+		if handled || err != nil {
+			return err
+		}
+		fi, err = os.Stat(path)
+		if err != nil {
+			return err
+		}
+	}
+	if fi.IsDir() {
+		if isoPath == "" {
+			return nil
+		}
+		dir, err := iw.mkdirAll(splitPath(isoPath))
+		if err != nil {
+			return err
+		}
+		dir.modTime = fi.ModTime()
+		dir.posix = iw.sourceAttributes(fi)
+		return nil
+	}
+	return iw.AddFileAs(path, isoPath)
+}
@@ -0,0 +1,107 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	pathpkg "path"
+	"strings"
+)
+
+// WithExclude leaves out the files and directories matching any of patterns
+// when adding a directory tree, such as with AddFS.  A pattern containing no
+// "/" matches the name of an entry at any depth, such as "*.tmp", and other
+// patterns match the path of an entry relative to the added tree, where "**"
+// matches any number of directories, such as "build/**/*.o".  Patterns
+// otherwise follow the syntax of path.Match.  Excluding a directory excludes
+// everything below it.
+func WithExclude(patterns ...string) Option {
+	return func(o *options) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// WithIncludeOnly adds only the files matching one of patterns when adding a
+// directory tree, such as "configs/**".  Patterns are matched as for
+// WithExclude, which takes precedence.  Directories are descended into
+// regardless, but only recorded in the image if they match or hold a file
+// that does.
+func WithIncludeOnly(patterns ...string) Option {
+	return func(o *options) {
+		o.include = append(o.include, patterns...)
+	}
+}
+
+// checkPatterns checks the syntax of the filter patterns.
+func (o *options) checkPatterns() error {
+	for _, p := range append(append([]string(nil), o.exclude...), o.include...) {
+		for _, c := range strings.Split(p, "/") {
+			if _, err := pathpkg.Match(c, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", p, err)
+			}
+		}
+	}
+	return nil
+}
+
+// excluded reports whether the entry at path, relative to the added tree,
+// is left out by the filters.
+func (o *options) excluded(path string, dir bool) bool {
+	for _, p := range o.exclude {
+		if matchPattern(p, path) {
+			return true
+		}
+	}
+	if len(o.include) == 0 {
+		return false
+	}
+	for _, p := range o.include {
+		if matchPattern(p, path) {
+			return false
+		}
+	}
+	// directories are still descended into
+	return !dir
+}
+
+// included reports whether the directory at path is explicitly included,
+// which also holds if no WithIncludeOnly patterns are given.
+func (o *options) included(path string) bool {
+	if len(o.include) == 0 {
+		return true
+	}
+	for _, p := range o.include {
+		if matchPattern(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPattern reports whether path matches the filter pattern.
+func matchPattern(pattern, path string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := pathpkg.Match(pattern, pathpkg.Base(path))
+		return ok
+	}
+	return matchComponents(strings.Split(strings.Trim(pattern, "/"), "/"), strings.Split(path, "/"))
+}
+
+func matchComponents(pattern, path []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(path); i++ {
+				if matchComponents(pattern[1:], path[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(path) == 0 {
+			return false
+		}
+		if ok, _ := pathpkg.Match(pattern[0], path[0]); !ok {
+			return false
+		}
+		pattern, path = pattern[1:], path[1:]
+	}
+	return len(path) == 0
+}
@@ -0,0 +1,65 @@
+package iso9660wrap
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// filterTestFS is a build tree with artifacts to leave out.
+var filterTestFS = fstest.MapFS{
+	"README.md":                  {Data: []byte("readme")},
+	"notes.tmp":                  {Data: []byte("tmp")},
+	"src/main.c":                 {Data: []byte("main")},
+	"src/main.tmp":               {Data: []byte("tmp")},
+	"build/obj/main.o":           {Data: []byte("object")},
+	"build/obj/deep/util.o":      {Data: []byte("object")},
+	"build/main":                 {Data: []byte("binary")},
+	"cache/blob":                 {Data: []byte("cache")},
+	"configs/app.yaml":           {Data: []byte("app")},
+	"configs/nested/db.yaml":     {Data: []byte("db")},
+	"configs/nested/db.yaml.tmp": {Data: []byte("tmp")},
+	"docs/configs/stray.yaml":    {Data: []byte("stray")},
+}
+
+func TestFilters(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		opts []Option
+		want string
+	}{
+		{"none", nil, "README.md build/ build/main build/obj/ build/obj/deep/ build/obj/deep/util.o build/obj/main.o cache/ cache/blob configs/ configs/app.yaml configs/nested/ configs/nested/db.yaml configs/nested/db.yaml.tmp docs/ docs/configs/ docs/configs/stray.yaml notes.tmp src/ src/main.c src/main.tmp"},
+		{"exclude", []Option{WithExclude("*.tmp", "build/**/*.o", "cache", "docs")}, "README.md build/ build/main build/obj/ build/obj/deep/ configs/ configs/app.yaml configs/nested/ configs/nested/db.yaml src/ src/main.c"},
+		{"include only", []Option{WithIncludeOnly("configs/**")}, "configs/ configs/app.yaml configs/nested/ configs/nested/db.yaml configs/nested/db.yaml.tmp"},
+		{"exclude takes precedence", []Option{WithIncludeOnly("configs/**", "README.md"), WithExclude("*.tmp")}, "README.md configs/ configs/app.yaml configs/nested/ configs/nested/db.yaml"},
+		{"include by name", []Option{WithIncludeOnly("*.yaml")}, "configs/ configs/app.yaml configs/nested/ configs/nested/db.yaml docs/ docs/configs/ docs/configs/stray.yaml"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			iw := NewImageWriter(append(tc.opts, WithRockRidge())...)
+			if err := iw.AddFS(filterTestFS); err != nil {
+				t.Fatal(err)
+			}
+			ir, err := ReadImage(writeImage(t, iw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for path, data := range readTree(t, ir) {
+				if !strings.HasSuffix(path, "/") && data != string(filterTestFS[path].Data) {
+					t.Errorf("%s holds %q", path, data)
+				}
+				got = append(got, path)
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != tc.want {
+				t.Errorf("image holds\n%s\nwant\n%s", strings.Join(got, " "), tc.want)
+			}
+		})
+	}
+
+	iw := NewImageWriter(WithExclude("build/[a"))
+	if err := iw.AddFS(filterTestFS); err == nil || !strings.Contains(err.Error(), `invalid pattern "build/[a"`) {
+		t.Errorf("AddFS with an invalid pattern returned %v", err)
+	}
+}
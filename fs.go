@@ -0,0 +1,98 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	pathpkg "path"
+)
+
+// WriteFS writes an image containing every file and directory in fsys to w.
+// fsys may be any fs.FS, such as an embed.FS or the result of os.DirFS.
+func WriteFS(w io.Writer, fsys fs.FS, opts ...Option) error {
+	iw := NewImageWriter(opts...)
+	err := iw.AddFS(fsys)
+	if err != nil {
+		return err
+	}
+	return iw.Finalize(w)
+}
+
+// AddFS schedules every file and directory in fsys for inclusion in the
+// image, keeping their paths relative to the root of fsys.  Files are not
+// opened until Finalize.  Symbolic links are handled according to
+// WithSymlinkPolicy, and entries are filtered according to WithExclude and
+// WithIncludeOnly.
+func (iw *ImageWriter) AddFS(fsys fs.FS) error {
+	return iw.addFS(fsys, "", "", 0)
+}
+
+// addFS adds the contents of fsys under the directory prefix of the image.
+// base is the path of fsys within the tree being added, which filters match
+// paths against, and links is the number of symbolic links followed to get
+// to fsys.
+func (iw *ImageWriter) addFS(fsys fs.FS, prefix, base string, links int) error {
+	if err := iw.checkPatterns(); err != nil {
+		return err
+	}
+	return fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == "." {
+			return nil
+		}
+		name := pathpkg.Join(prefix, path)
+		rel := pathpkg.Join(base, path)
+
+		if d.Type()&fs.ModeSymlink != 0 && iw.symlinks != SymlinkFollow {
+			if iw.excluded(rel, false) {
+				return nil
+			}
+			_, err := iw.applySymlinkPolicy(name, func() (string, error) {
+				return readLink(fsys, path)
+			})
+			return err
+		}
+
+		fi, err := fs.Stat(fsys, path)
+		if err != nil {
+			return err
+		}
+		if iw.excluded(rel, fi.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() {
+			if iw.included(rel) {
+				dir, err := iw.mkdirAll(splitPath(name))
+				if err != nil {
+					return err
+				}
+				dir.modTime = fi.ModTime()
+				dir.posix = iw.sourceAttributes(fi)
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// a followed link to a directory, which WalkDir doesn't
+			// descend into
+			if links >= maxSymlinkDepth {
+				return fmt.Errorf("%s: too many levels of symbolic links", name)
+			}
+			sub, err := fs.Sub(fsys, path)
+			if err != nil {
+				return err
+			}
+			return iw.addFS(sub, name, rel, links+1)
+		}
+		if !fi.Mode().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", name)
+		}
+		return iw.add(name, fi.Size(), func() (io.ReadCloser, error) {
+			return fsys.Open(path)
+		}, iw.source(fi))
+	})
+}
@@ -0,0 +1,85 @@
+//go:build go1.18
+
+package iso9660wrap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// FuzzReadImage reads arbitrary images, which must fail with an error
+// rather than panic, loop or allocate without bound.  The seeds in
+// testdata/fuzz/FuzzReadImage are images written by this package, without
+// the system area, which keeps them small enough to mutate and minimize.
+func FuzzReadImage(f *testing.F) {
+	f.Fuzz(func(t *testing.T, b []byte) {
+		b = append(make([]byte, 16*SectorSize), b...)
+		if _, err := Validate(bytes.NewReader(b)); err != nil {
+			return
+		}
+		ir, err := ReadImage(b, MemoryLimit(1<<20))
+		if err != nil {
+			return
+		}
+		ir.BootImages()
+		ir.Walk(func(info ISOFileInfo) error {
+			if info.IsDir() {
+				return nil
+			}
+			if r, err := ir.Open(info.Path); err == nil {
+				io.Copy(ioutil.Discard, io.LimitReader(r, 1<<20))
+			}
+			return nil
+		})
+	})
+}
+
+// FuzzValidateName checks that every identifier ValidateName accepts or
+// produces is valid for the options it was given.
+func FuzzValidateName(f *testing.F) {
+	options := []struct {
+		name  string
+		opts  []Option
+		valid func(id string, dir bool) bool
+	}{
+		{"strict", nil, defaultIdentifier},
+		{"mangled", []Option{WithNameMangling()}, defaultIdentifier},
+		{"level 2", []Option{WithInterchangeLevel(2), WithNameMangling()}, func(id string, dir bool) bool {
+			return identifierLevel(id, dir) != 0
+		}},
+		{"level 1", []Option{WithInterchangeLevel(1), WithNameMangling()}, func(id string, dir bool) bool {
+			return identifierLevel(id, dir) == 1
+		}},
+		{"relaxed", []Option{WithRelaxedNames()}, func(id string, dir bool) bool {
+			return len(id) <= maxRelaxedIdentifierLength && !strings.ContainsAny(id, "/;")
+		}},
+	}
+	f.Fuzz(func(t *testing.T, name string, dir bool) {
+		for _, o := range options {
+			id, err := ValidateName(name, dir, o.opts...)
+			if err != nil {
+				continue
+			}
+			if id == "" || !utf8.ValidString(id) || !o.valid(id, dir) {
+				t.Errorf("%s: ValidateName(%q, %v) = %q, which is not a valid identifier", o.name, name, dir, id)
+			}
+		}
+	})
+}
+
+// defaultIdentifier reports whether id is valid without an interchange
+// level, which permits file identifiers with several dots.
+func defaultIdentifier(id string, dir bool) bool {
+	if dir {
+		return identifierLevel(id, dir) != 0
+	}
+	n := len(id)
+	if strings.Contains(id, ".") {
+		n--
+	}
+	return filenameSatisfiesISOConstraints(id) && n <= maxFileIdentifierLength
+}
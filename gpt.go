@@ -0,0 +1,167 @@
+package iso9660wrap
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	gptBlockSize      = 512
+	gptNumEntries     = 128
+	gptEntrySize      = 128
+	gptEntriesBlocks  = gptNumEntries * gptEntrySize / gptBlockSize
+	gptHeaderSize     = 92
+	gptProtectiveType = 0xEE
+	mbrEFIType        = 0xEF
+
+	// gptBackupSectors is the number of sectors appended to the image for
+	// the backup partition entries and header, which fill the last blocks
+	// of the image.
+	gptBackupSectors = ((gptEntriesBlocks+1)*gptBlockSize + SectorSize - 1) / SectorSize
+)
+
+const efiSystemPartitionGUID = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+
+// WithHybridGPT records a GUID partition table in the system area, with an
+// EFI system partition covering the first PlatformEFI boot image, so that
+// UEFI firmware can boot the image from a USB stick, as with xorriso's
+// -isohybrid-gpt options.  The backup partition table is appended to the
+// image.  Unless WithHybridMBR is given as well, the MBR is a protective
+// one.
+func WithHybridGPT() Option {
+	return func(o *options) {
+		o.hybridGPT = true
+	}
+}
+
+// efiBootImage returns the first PlatformEFI boot image.
+func (iw *ImageWriter) efiBootImage() (*bootEntry, error) {
+	for _, b := range iw.boot {
+		if b.platform == PlatformEFI {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("a GPT requires a PlatformEFI boot image")
+}
+
+// espBlocks returns the first and last 512 byte block of the EFI system
+// partition.
+func (b *bootEntry) espBlocks() (first, last uint64) {
+	first = uint64(b.file.sector+b.file.xarSectors()) * uint64(SectorSize/gptBlockSize)
+	n := (uint64(b.file.Size) + gptBlockSize - 1) / gptBlockSize
+	if n == 0 {
+		n = 1
+	}
+	return first, first + n - 1
+}
+
+// gpt returns the partition entries of the GPT, and the GUID of the disk.
+func (iw *ImageWriter) gpt(l *imageLayout, now time.Time) (entries []byte, diskGUID []byte, err error) {
+	b, err := iw.efiBootImage()
+	if err != nil {
+		return nil, nil, err
+	}
+	// GUIDs are derived from the image rather than random, so that builds
+	// stay reproducible
+	seed := fmt.Sprintf("%s\x00%d\x00%s", l.volumeID, l.numSectors, now.UTC().Format(time.RFC3339Nano))
+	diskGUID = derivedGUID(seed + "\x00disk")
+
+	entries = make([]byte, gptNumEntries*gptEntrySize)
+	first, last := b.espBlocks()
+	e := entries[:gptEntrySize]
+	copy(e[0:16], parseGUID(efiSystemPartitionGUID))
+	copy(e[16:32], derivedGUID(seed+"\x00esp"))
+	binary.LittleEndian.PutUint64(e[32:], first)
+	binary.LittleEndian.PutUint64(e[40:], last)
+	for i, c := range utf16.Encode([]rune("EFI System Partition")) {
+		binary.LittleEndian.PutUint16(e[56+2*i:], c)
+	}
+	return entries, diskGUID, nil
+}
+
+// gptHeader returns the GPT header stored at block current of a disk of
+// numBlocks blocks, with the partition entries at block entriesLBA.
+func gptHeader(entries, diskGUID []byte, numBlocks, current, entriesLBA uint64) []byte {
+	backup := numBlocks - 1
+	if current == backup {
+		backup = 1
+	}
+	h := make([]byte, gptBlockSize)
+	copy(h, "EFI PART")
+	binary.LittleEndian.PutUint32(h[8:], 0x00010000) // revision 1.0
+	binary.LittleEndian.PutUint32(h[12:], gptHeaderSize)
+	binary.LittleEndian.PutUint64(h[24:], current)
+	binary.LittleEndian.PutUint64(h[32:], backup)
+	binary.LittleEndian.PutUint64(h[40:], 2+gptEntriesBlocks)           // first usable block
+	binary.LittleEndian.PutUint64(h[48:], numBlocks-2-gptEntriesBlocks) // last usable block
+	copy(h[56:72], diskGUID)
+	binary.LittleEndian.PutUint64(h[72:], entriesLBA)
+	binary.LittleEndian.PutUint32(h[80:], gptNumEntries)
+	binary.LittleEndian.PutUint32(h[84:], gptEntrySize)
+	binary.LittleEndian.PutUint32(h[88:], crc32.ChecksumIEEE(entries))
+	binary.LittleEndian.PutUint32(h[16:], crc32.ChecksumIEEE(h[:gptHeaderSize]))
+	return h
+}
+
+// writeGPT records the primary GPT and its MBR in the system area.
+func (iw *ImageWriter) writeGPT(area []byte, l *imageLayout, now time.Time) error {
+	entries, diskGUID, err := iw.gpt(l, now)
+	if err != nil {
+		return err
+	}
+	numBlocks := uint64(l.numSectors) * uint64(SectorSize/gptBlockSize)
+	if iw.hybridMBR {
+		// a hybrid MBR, which also lists the EFI system partition
+		b, _ := iw.efiBootImage()
+		first, last := b.espBlocks()
+		writeMBRPartition(area, 1, 0, mbrEFIType, first, last-first+1)
+	} else {
+		writeMBRPartition(area, 0, 0, gptProtectiveType, 1, numBlocks-1)
+		area[510], area[511] = 0x55, 0xAA
+	}
+	copy(area[gptBlockSize:], gptHeader(entries, diskGUID, numBlocks, 1, 2))
+	copy(area[2*gptBlockSize:], entries)
+	return nil
+}
+
+// gptBackup returns the sectors holding the backup GPT.
+func (iw *ImageWriter) gptBackup(l *imageLayout, now time.Time) ([]byte, error) {
+	entries, diskGUID, err := iw.gpt(l, now)
+	if err != nil {
+		return nil, err
+	}
+	numBlocks := uint64(l.numSectors) * uint64(SectorSize/gptBlockSize)
+	backup := make([]byte, gptBackupSectors*SectorSize)
+	h := gptHeader(entries, diskGUID, numBlocks, numBlocks-1, numBlocks-1-gptEntriesBlocks)
+	copy(backup[len(backup)-gptBlockSize:], h)
+	copy(backup[len(backup)-gptBlockSize-len(entries):], entries)
+	return backup, nil
+}
+
+// parseGUID returns the mixed-endian binary form of a GUID in its usual
+// text form.
+func parseGUID(s string) []byte {
+	b, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(b) != 16 {
+		panic("invalid GUID " + s)
+	}
+	b[0], b[1], b[2], b[3] = b[3], b[2], b[1], b[0]
+	b[4], b[5] = b[5], b[4]
+	b[6], b[7] = b[7], b[6]
+	return b
+}
+
+// derivedGUID returns a version 4 style GUID derived from seed.
+func derivedGUID(seed string) []byte {
+	sum := sha256.Sum256([]byte(seed))
+	g := sum[:16]
+	g[7] = g[7]&0x0f | 0x40 // version, in the mixed-endian third field
+	g[8] = g[8]&0x3f | 0x80 // variant
+	return g
+}
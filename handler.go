@@ -0,0 +1,89 @@
+package iso9660wrap
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// isoContentType is the media type images are served as.
+const isoContentType = "application/x-iso9660-image"
+
+// ImageHandler is an http.Handler that serves an image built for each
+// request, such as a cloud-init seed for the virtual machine asking for it:
+//
+//	http.Handle("/seed.iso", &iso9660wrap.ImageHandler{
+//		Build: func(r *http.Request) (*iso9660wrap.ImageWriter, error) {
+//			return iso9660wrap.NewCloudInitSeed(userData(r), metaData(r), nil)
+//		},
+//		Name: "seed.iso",
+//	})
+//
+// The Content-Length of the response is the exact size of the image, which
+// is laid out before anything is written.  The image itself is streamed
+// while it is written, so a failure past that point aborts the response.
+type ImageHandler struct {
+	// Build returns the ImageWriter of the image served for r.  Its error
+	// is reported to the client as an internal server error.
+	Build func(r *http.Request) (*ImageWriter, error)
+
+	// Name, if set, is the file name the client is told to save the image
+	// under.
+	Name string
+
+	// Ranges lets clients ask for byte ranges of the image, which are read
+	// from the sources of its files as Image.ReaderAt describes, rather
+	// than for all of it.  Images with readers added with AddReader that
+	// can be read only once can't be served that way.
+	Ranges bool
+}
+
+func (h *ImageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	iw, err := h.Build(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", isoContentType)
+	if h.Name != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": h.Name}))
+	}
+
+	if h.Ranges {
+		im, err := iw.Image()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		ra, err := im.ReaderAt()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, h.Name, time.Time{}, io.NewSectionReader(ra, 0, im.Size()))
+		return
+	}
+
+	size, err := iw.Size()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Accept-Ranges", "none")
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := iw.FinalizeContext(r.Context(), w); err != nil {
+		// the status has been sent, so all that is left is not to let
+		// the client take a truncated image for a complete one
+		panic(http.ErrAbortHandler)
+	}
+}
@@ -0,0 +1,101 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// serve returns the response of h to a request with method and, if set,
+// the Range header rng.
+func serve(h http.Handler, method, rng string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, "/seed.iso", nil)
+	if rng != "" {
+		r.Header.Set("Range", rng)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestImageHandler(t *testing.T) {
+	want := writeImage(t, lazyTestImage(t))
+	for _, ranges := range []bool{false, true} {
+		h := &ImageHandler{
+			Build: func(r *http.Request) (*ImageWriter, error) {
+				return lazyTestImage(t), nil
+			},
+			Name:   "seed.iso",
+			Ranges: ranges,
+		}
+		w := serve(h, http.MethodGet, "")
+		if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), want) {
+			t.Errorf("Ranges %v: GET returned %d with %d bytes, want the %d bytes of the image", ranges, w.Code, w.Body.Len(), len(want))
+		}
+		if got := w.Header().Get("Content-Length"); got != strconv.Itoa(len(want)) {
+			t.Errorf("Ranges %v: Content-Length is %q, want %d", ranges, got, len(want))
+		}
+		if got := w.Header().Get("Content-Type"); got != isoContentType {
+			t.Errorf("Ranges %v: Content-Type is %q", ranges, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=seed.iso` {
+			t.Errorf("Ranges %v: Content-Disposition is %q", ranges, got)
+		}
+
+		w = serve(h, http.MethodHead, "")
+		if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != strconv.Itoa(len(want)) {
+			t.Errorf("Ranges %v: HEAD returned %d with %d bytes and Content-Length %q", ranges, w.Code, w.Body.Len(), w.Header().Get("Content-Length"))
+		}
+
+		// the range ends within the data of the first file
+		w = serve(h, http.MethodGet, "bytes=32000-40000")
+		if !ranges {
+			if w.Code != http.StatusOK || w.Header().Get("Accept-Ranges") != "none" {
+				t.Errorf("GET of a range returned %d with Accept-Ranges %q, want all of the image", w.Code, w.Header().Get("Accept-Ranges"))
+			}
+			continue
+		}
+		if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), want[32000:40001]) {
+			t.Errorf("GET of a range returned %d with %d bytes, want bytes 32000 to 40000", w.Code, w.Body.Len())
+		}
+		if got, wantRange := w.Header().Get("Content-Range"), "bytes 32000-40000/"+strconv.Itoa(len(want)); got != wantRange {
+			t.Errorf("Content-Range is %q, want %q", got, wantRange)
+		}
+		w = serve(h, http.MethodGet, "bytes=-10")
+		if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), want[len(want)-10:]) {
+			t.Errorf("GET of the last 10 bytes returned %d with %q", w.Code, w.Body.Bytes())
+		}
+		w = serve(h, http.MethodGet, "bytes="+strconv.Itoa(len(want))+"-")
+		if w.Code != http.StatusRequestedRangeNotSatisfiable {
+			t.Errorf("GET of a range past the end returned %d", w.Code)
+		}
+	}
+}
+
+func TestImageHandlerErrors(t *testing.T) {
+	h := &ImageHandler{Build: func(r *http.Request) (*ImageWriter, error) {
+		return nil, errors.New("no such machine")
+	}}
+	if w := serve(h, http.MethodGet, ""); w.Code != http.StatusInternalServerError || !bytes.Contains(w.Body.Bytes(), []byte("no such machine")) {
+		t.Errorf("GET with a failing Build returned %d: %s", w.Code, w.Body.Bytes())
+	}
+	if w := serve(h, http.MethodPost, ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("POST returned %d with Allow %q", w.Code, w.Header().Get("Allow"))
+	}
+
+	// readers that can be read only once can't be served by range
+	h = &ImageHandler{
+		Build: func(r *http.Request) (*ImageWriter, error) {
+			iw := NewImageWriter()
+			return iw, iw.AddReader("PIPE.BIN", 3, struct{ io.Reader }{bytes.NewReader([]byte("abc"))})
+		},
+		Ranges: true,
+	}
+	if w := serve(h, http.MethodGet, "bytes=0-10"); w.Code != http.StatusInternalServerError {
+		t.Errorf("GET of a range of a one-shot reader returned %d", w.Code)
+	}
+}
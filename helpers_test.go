@@ -0,0 +1,217 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeImage writes the image of iw to memory, failing the test unless
+// Validate finds nothing wrong with it.
+func writeImage(t *testing.T, iw *ImageWriter) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := iw.Finalize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, bytes.NewReader(buf.Bytes()))
+	return buf.Bytes()
+}
+
+// checkValid fails the test for every finding of Validate on the image r.
+func checkValid(t *testing.T, r io.ReaderAt) {
+	t.Helper()
+	findings, err := Validate(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		t.Errorf("finding: %s", f)
+	}
+}
+
+// readTree returns the contents of the files ir reads by path, with the
+// paths of directories ending in a slash.
+func readTree(t *testing.T, ir *Reader) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := ir.Walk(func(info ISOFileInfo) error {
+		if info.IsDir() {
+			tree[info.Path+"/"] = ""
+			return nil
+		}
+		r, err := ir.Open(info.Path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadAll(r)
+		tree[info.Path] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// bsdtarMinImageSize is the size libarchive reads ahead to recognize an
+// ISO9660 image.  It reads smaller images as empty archives without an error.
+const bsdtarMinImageSize = int(24 * SectorSize)
+
+// bsdtarExtract extracts img with bsdtar, passing it args, and returns the
+// directory it was extracted to.  The test is skipped without bsdtar.
+func bsdtarExtract(t *testing.T, img []byte, args ...string) string {
+	t.Helper()
+	bsdtar, err := exec.LookPath("bsdtar")
+	if err != nil {
+		t.Skip("bsdtar not found")
+	}
+	if len(img) < bsdtarMinImageSize {
+		t.Fatalf("bsdtar can't recognize an image of %d bytes", len(img))
+	}
+	out := t.TempDir()
+	cmd := exec.Command(bsdtar, append([]string{"-x", "-f", tempImage(t, img), "-C", out}, args...)...)
+	// Joliet names are converted to the character set of the locale
+	cmd.Env = append(os.Environ(), "LC_ALL=C.UTF-8")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("bsdtar: %v\n%s", err, b)
+	}
+	return out
+}
+
+// bsdtarTree returns the tree bsdtar extracts from img as readTree does,
+// with symbolic links mapped to "-> " and their targets.
+func bsdtarTree(t *testing.T, img []byte, args ...string) map[string]string {
+	t.Helper()
+	out := bsdtarExtract(t, img, args...)
+	tree := map[string]string{}
+	err := filepath.Walk(out, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || path == out {
+			return err
+		}
+		rel := filepath.ToSlash(path[len(out)+1:])
+		switch {
+		case fi.IsDir():
+			tree[rel+"/"] = ""
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			tree[rel] = "-> " + target
+			return err
+		default:
+			b, err := ioutil.ReadFile(path)
+			tree[rel] = string(b)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+// compareTrees fails the test for every path whose contents differ between
+// got and want.
+func compareTrees(t *testing.T, what string, got, want map[string]string) {
+	t.Helper()
+	for path, w := range want {
+		if g, ok := got[path]; !ok {
+			t.Errorf("%s: %s is missing", what, path)
+		} else if g != w {
+			t.Errorf("%s: %s holds %d bytes starting %q, want %d bytes starting %q", what, path, len(g), head([]byte(g)), len(w), head([]byte(w)))
+		}
+	}
+	for path := range got {
+		if _, ok := want[path]; !ok {
+			t.Errorf("%s: unexpected %s", what, path)
+		}
+	}
+}
+
+// recordAt returns the directory record of the file called name in the
+// root directory of img, which aliases img.
+func recordAt(t *testing.T, img []byte, name string) []byte {
+	t.Helper()
+	pvd := img[primaryVolumeSectorNum*SectorSize:]
+	root := pvd[156:]
+	start, size := littleEndian32(root[2:]), littleEndian32(root[10:])
+	dir := img[start*SectorSize : start*SectorSize+size]
+	for p := 0; p < len(dir); {
+		length := int(dir[p])
+		if length == 0 {
+			p = (p/int(SectorSize) + 1) * int(SectorSize)
+			continue
+		}
+		rec := dir[p : p+length]
+		identifier := string(rec[33 : 33+int(rec[32])])
+		if identifier == name || identifier == name+";1" {
+			return rec
+		}
+		p += length
+	}
+	t.Fatalf("no record for %s in the root directory", name)
+	return nil
+}
+
+func littleEndian32(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b)
+}
+
+// head returns the first bytes of b, for messages.
+func head(b []byte) []byte {
+	if len(b) > 16 {
+		return b[:16]
+	}
+	return b
+}
+
+// bsdtarList returns the fields bsdtar -tv lists the image at path with for
+// each of its paths: the mode, the number of links, the numeric owner and
+// group and the size.  Symbolic links are listed under their own path.  The
+// test is skipped without bsdtar.
+func bsdtarList(t *testing.T, path string) map[string][]string {
+	t.Helper()
+	bsdtar, err := exec.LookPath("bsdtar")
+	if err != nil {
+		t.Skip("bsdtar not found")
+	}
+	if fi, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	} else if fi.Size() < int64(bsdtarMinImageSize) {
+		t.Fatalf("bsdtar can't recognize an image of %d bytes", fi.Size())
+	}
+	out, err := exec.Command(bsdtar, "-t", "-v", "--numeric-owner", "-f", path).CombinedOutput()
+	if err != nil {
+		t.Fatalf("bsdtar: %v\n%s", err, out)
+	}
+	list := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 9 {
+			t.Fatalf("bsdtar lists %q", line)
+		}
+		name := strings.Join(fields[8:], " ")
+		if i := strings.Index(name, " -> "); i >= 0 {
+			name = name[:i]
+		}
+		list[name] = fields[:5]
+	}
+	return list
+}
+
+// tempImage writes img to a file removed at the end of the test and returns
+// its path.
+func tempImage(t *testing.T, img []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "image.iso")
+	if err := ioutil.WriteFile(path, img, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,32 @@
+package iso9660wrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteIgnitionConfig writes an image that provisions a Fedora CoreOS or
+// other Ignition based system on first boot to w.  Ignition reads its
+// config from the user data of an OpenStack style config drive on the
+// platforms that take one, such as openstack, ibmcloud, kubevirt and
+// nutanix, so the image is labelled "config-2" and holds config as
+// openstack/latest/user_data.  config must be an Ignition config, a JSON
+// object that names its specification version in ignition.version.  opts
+// apply on top of the settings the image needs.
+func WriteIgnitionConfig(w io.Writer, config []byte, opts ...Option) error {
+	var c struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}
+	if err := json.Unmarshal(config, &c); err != nil {
+		return fmt.Errorf("invalid Ignition config: %w", err)
+	}
+	if c.Ignition.Version == "" {
+		return fmt.Errorf("Ignition config does not specify ignition.version")
+	}
+	return writeSeed(w, "Ignition", configDriveVolumeID, []seedFile{
+		{path: "openstack/latest/user_data", data: config, json: true},
+	}, opts)
+}
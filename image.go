@@ -0,0 +1,56 @@
+package iso9660wrap
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// Image is the image an ImageWriter describes, which unlike Finalize can be
+// written any number of times, to any destination that takes an
+// io.WriterTo.  Each write reads the inputs again.  The ImageWriter must not
+// be changed while the Image is in use, and writes of the same Image must
+// not overlap.
+type Image struct {
+	iw   *ImageWriter
+	size int64
+}
+
+// Image lays out the entries scheduled so far and returns their image.
+// Readers added with AddReader that can't be read again can be read only
+// once, so they can't be part of an Image.
+func (iw *ImageWriter) Image() (*Image, error) {
+	if err := iw.options.validate(); err != nil {
+		return nil, err
+	}
+	l, err := iw.layout()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range l.dirs {
+		for _, f := range d.files {
+			if f.oneShot && f.contents == nil {
+				return nil, fmt.Errorf("%s/%s can be read only once, but an Image may be written several times", d.path(), f.Name)
+			}
+		}
+	}
+	return &Image{iw: iw, size: int64(l.numSectors-l.sessionStart) * int64(SectorSize)}, nil
+}
+
+// Size returns the number of bytes WriteTo writes.
+func (im *Image) Size() int64 {
+	return im.size
+}
+
+// WriteTo writes the image to w, returning the number of bytes written.
+func (im *Image) WriteTo(w io.Writer) (int64, error) {
+	return im.WriteToContext(context.Background(), w)
+}
+
+// WriteToContext is like WriteTo, but stops writing and returns ctx's error
+// once ctx is done.
+func (im *Image) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	rw := &resultWriter{w: w}
+	err := im.iw.FinalizeContext(ctx, rw)
+	return rw.n, err
+}
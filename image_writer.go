@@ -0,0 +1,924 @@
+package iso9660wrap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ImageWriter assembles an ISO9660 image from any number of files and
+// directories.  The Add methods only record what goes into the image; no
+// input is opened or read until Finalize is called.
+type ImageWriter struct {
+	root *directoryEntry
+	options
+
+	// rawNames disables upper-casing and validation of identifiers, which is
+	// how WriteBuffer has always treated its file name.
+	rawNames bool
+
+	boot []*bootEntry
+
+	// previousEnd is the sector following the previous session added
+	// with AddPreviousSession.
+	previousEnd uint32
+
+	// patchLate is set while FinalizeAt writes an image whose boot info
+	// tables are patched in after the boot images are written.
+	patchLate bool
+
+	// lazy is set while the image is laid out for Image.ReaderAt, which
+	// reads the data of files from their sources on demand.
+	lazy *lazyImage
+
+	// openFiles holds a token for every input open, up to the limit set
+	// with WithMaxOpenFiles.
+	openFiles chan struct{}
+}
+
+// FileEntry describes a file scheduled for inclusion in an image.
+type FileEntry struct {
+	// Name is the file identifier within its directory, or the full path of
+	// the file in the image when passed to EstimateSize.
+	Name string
+	Size int64
+
+	// origName is the name the file was added under, before it was
+	// converted to an identifier.
+	origName string
+	open     func() (io.ReadCloser, error)
+	sector   uint32
+	flags    byte
+
+	// modTime is set by the ModTime option, and srcModTime is the
+	// modification time of the source file.
+	modTime    time.Time
+	srcModTime time.Time
+
+	xar *extendedAttributes
+
+	// unitSize and gapSize are set by Interleave.
+	unitSize byte
+	gapSize  byte
+
+	// describes is set by CopyrightFile, AbstractFile and
+	// BibliographicFile.
+	describes descriptorFile
+
+	// symlink is the target of a symbolic link.
+	symlink string
+	posix   *posixAttributes
+
+	// head holds the start of the file once peek has read it.  If the
+	// file can only be read once, oneShot is set and the file's data is
+	// read from head before the rest of it.
+	head    []byte
+	oneShot bool
+
+	// contents replaces the data of the file if it is not nil.
+	contents []byte
+
+	// inode identifies the source file if it has several hard links, and
+	// shares is the file whose extent the directory records of this file
+	// point at instead of an extent of its own.
+	inode  *fileID
+	shares *FileEntry
+	// digest is the SHA-256 digest of the data, once WithDeduplication
+	// has computed it, and written is the digest of the data written to
+	// the image, if WithVerify is set.
+	digest  *[32]byte
+	written *[32]byte
+
+	// overlay is set for files taken from an existing image by AddImage,
+	// which replace the file of the same name added before them and are
+	// replaced by one added after them.
+	overlay bool
+	// prior is set for files of a previous session, whose data is already
+	// recorded at sector.
+	prior bool
+}
+
+// fileID identifies a local file independently of its path.
+type fileID struct {
+	dev, ino uint64
+}
+
+// FileOption sets a property of a single file added to an ImageWriter.
+type FileOption func(*FileEntry)
+
+// Hidden sets the existence bit of the file's directory record, which
+// asks readers not to list the file.
+func Hidden() FileOption {
+	return func(f *FileEntry) {
+		f.flags |= fileFlagHidden
+	}
+}
+
+// ModTime sets the recording date of the file's directory record.  Without
+// it, files added from a file system record their modification time, and
+// others the recording time of the image.
+func ModTime(t time.Time) FileOption {
+	return func(f *FileEntry) {
+		f.modTime = t
+	}
+}
+
+// source records the attributes of the file's source described by fi.
+func (iw *ImageWriter) source(fi os.FileInfo) FileOption {
+	return func(f *FileEntry) {
+		f.srcModTime = fi.ModTime()
+		f.posix = iw.sourceAttributes(fi)
+		f.inode = sourceFileID(fi)
+	}
+}
+
+// Associated marks the file as an associated file, such as a resource fork.
+// An associated file may share its name with a regular file in the same
+// directory.
+func Associated() FileOption {
+	return func(f *FileEntry) {
+		f.flags |= fileFlagAssociated
+	}
+}
+
+type directoryEntry struct {
+	name     string
+	origName string
+	parent   *directoryEntry
+	subdirs  []*directoryEntry
+	files    []*FileEntry
+
+	// transTable is the generated TRANS.TBL among files, if any.
+	transTable *FileEntry
+
+	// modTime is the modification time of the source directory, if any.
+	modTime time.Time
+	posix   *posixAttributes
+
+	// movedTo is the RR_MOVED directory d was relocated to, with
+	// movedName as its identifier there, and rrMoved is RR_MOVED itself if
+	// d is the root directory.
+	movedTo   *directoryEntry
+	movedName string
+	rrMoved   *directoryEntry
+
+	number uint16 // path table record number
+	sector uint32
+	size   uint32
+}
+
+// NewImageWriter returns an ImageWriter for an image with an empty root
+// directory.
+func NewImageWriter(opts ...Option) *ImageWriter {
+	iw := &ImageWriter{root: &directoryEntry{name: "\x00"}}
+	for _, opt := range opts {
+		opt(&iw.options)
+	}
+	return iw
+}
+
+// AddFile schedules the local file at path for inclusion in the root
+// directory of the image, under its base name.
+func (iw *ImageWriter) AddFile(path string, opts ...FileOption) error {
+	return iw.AddFileAs(path, filepath.Base(path), opts...)
+}
+
+// AddFileAs schedules the local file at path for inclusion in the image
+// under isoPath, like a mkisofs graft point.  isoPath may contain
+// slash-separated directory identifiers, and any missing directories are
+// created.
+func (iw *ImageWriter) AddFileAs(path, isoPath string, opts ...FileOption) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	opts = append([]FileOption{iw.source(fi)}, opts...)
+	return iw.add(isoPath, fi.Size(), func() (io.ReadCloser, error) {
+		return os.Open(path)
+	}, opts...)
+}
+
+// AddReader schedules size bytes read from r for inclusion in the image under
+// name, so that data from any source, such as a network stream or generated
+// configuration, can be added without staging it in a file first.  name may
+// contain slash-separated directory identifiers, and any missing directories
+// are created.  r is not read until Finalize.  If r is an io.ReaderAt and an
+// io.Seeker, such as a *bytes.Reader or a regular *os.File, the data is read
+// with ReadAt from the current offset of r on, as often as it is needed, so
+// the file can be part of an Image or be deduplicated like a local file.
+// Other readers are read only once.  Files larger than 4 GiB are recorded in
+// multiple extents, as permitted by interchange level 3.
+func (iw *ImageWriter) AddReader(name string, size int64, r io.Reader, opts ...FileOption) error {
+	ra, isReaderAt := r.(io.ReaderAt)
+	if s, ok := r.(io.Seeker); ok && isReaderAt {
+		// pipes and terminals are files that can't seek
+		if off, err := s.Seek(0, io.SeekCurrent); err == nil {
+			return iw.add(name, size, func() (io.ReadCloser, error) {
+				// a byte past size is read, so that data that grew is
+				// reported like that of a local file
+				return sectionReadCloser{io.NewSectionReader(ra, off, size+1)}, nil
+			}, opts...)
+		}
+	}
+	opts = append([]FileOption{func(f *FileEntry) { f.oneShot = true }}, opts...)
+	return iw.add(name, size, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(r), nil
+	}, opts...)
+}
+
+// AddBytes schedules data for inclusion in the image under name, for the
+// small generated files, such as cloud-init's user-data and meta-data, that
+// are at hand in memory.  name may contain slash-separated directory
+// identifiers, and any missing directories are created.  data is not
+// copied, so it must not change until the image is written.
+func (iw *ImageWriter) AddBytes(name string, data []byte, opts ...FileOption) error {
+	return iw.add(name, int64(len(data)), func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}, opts...)
+}
+
+// sectionReadCloser is a section of the data of a reader added with
+// AddReader, which has nothing to close.
+type sectionReadCloser struct {
+	*io.SectionReader
+}
+
+func (sectionReadCloser) Close() error {
+	return nil
+}
+
+// AddDir creates the directory name in the image, along with any missing
+// parent directories.  A directory that stays empty is still recorded, with
+// an extent of its own holding just its "." and ".." records.
+func (iw *ImageWriter) AddDir(name string) error {
+	_, err := iw.mkdirAll(splitPath(name))
+	return err
+}
+
+func (iw *ImageWriter) add(name string, size int64, open func() (io.ReadCloser, error), opts ...FileOption) error {
+	if size < 0 {
+		return fmt.Errorf("invalid size %d for file %s", size, name)
+	}
+	components := splitPath(name)
+	if len(components) == 0 {
+		return fmt.Errorf("invalid file name %q", name)
+	}
+	dir, err := iw.mkdirAll(components[:len(components)-1])
+	if err != nil {
+		return err
+	}
+
+	f := &FileEntry{Size: size, origName: components[len(components)-1], open: open}
+	for _, opt := range opts {
+		opt(f)
+	}
+	if open != nil && !f.oneShot {
+		f.open = iw.limitOpen(open)
+	}
+	if y := f.modTime.UTC().Year(); !f.modTime.IsZero() && (y < 1900 || y > 1900+255) {
+		return fmt.Errorf("modification time %s of %s can not be recorded in an ISO9660 image", f.modTime, name)
+	}
+	f.Name, err = iw.fileIdentifier(dir, f.origName)
+	if err != nil {
+		return err
+	} else if err := iw.checkFileSize(f.Name, size); err != nil {
+		return err
+	}
+	dir.removeOverlaid(f)
+	if err := iw.resolveFileConflict(dir, f, name); err != nil {
+		return err
+	}
+
+	dir.files = append(dir.files, f)
+	return nil
+}
+
+func (iw *ImageWriter) mkdirAll(components []string) (*directoryEntry, error) {
+	dir := iw.root
+	for _, c := range components {
+		// a mangled directory is found again by the name it was added
+		// under
+		var next *directoryEntry
+		for _, sub := range dir.subdirs {
+			if sub.origName == c {
+				next = sub
+				break
+			}
+		}
+		if next == nil {
+			dirname, err := iw.dirIdentifier(dir, c)
+			if err != nil {
+				return nil, err
+			}
+			next, dirname, err = iw.resolveDirConflict(dir, c, dirname)
+			if err != nil {
+				return nil, err
+			}
+			if next == nil {
+				next = &directoryEntry{name: dirname, origName: c, parent: dir}
+				dir.subdirs = append(dir.subdirs, next)
+			}
+		}
+		dir = next
+	}
+	return dir, nil
+}
+
+func (iw *ImageWriter) identifier(name string) string {
+	if iw.rawNames || iw.preserveCase {
+		return name
+	}
+	return strings.ToUpper(name)
+}
+
+// lookup reports whether d already has an entry called name.
+func (d *directoryEntry) lookup(name string) bool {
+	for _, sub := range d.subdirs {
+		if sub.name == name {
+			return true
+		}
+	}
+	for _, f := range d.files {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// peek returns the first n bytes of f, or all of it if it is shorter,
+// without consuming them.
+func (f *FileEntry) peek(path string, n int) ([]byte, error) {
+	if len(f.head) >= n {
+		return f.head[:n], nil
+	} else if int64(len(f.head)) == f.Size {
+		return f.head, nil
+	}
+	r, err := f.reader()
+	if err != nil {
+		return nil, &InputError{path, err}
+	}
+	if !f.oneShot {
+		defer r.Close()
+	}
+	head := make([]byte, n)
+	l, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, &InputError{path, err}
+	}
+	f.head = head[:l]
+	return f.head, nil
+}
+
+// reader opens f for reading its data.
+func (f *FileEntry) reader() (io.ReadCloser, error) {
+	if f.contents != nil {
+		return ioutil.NopCloser(bytes.NewReader(f.contents)), nil
+	}
+	r, err := f.open()
+	if err != nil || !f.oneShot || len(f.head) == 0 {
+		return r, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(f.head), r), r}, nil
+}
+
+// lookupFile returns the file added under name, or nil if there is none.
+// Entries are also found by their identifiers, so that a boot image taken
+// from an existing image by Rebuild is still found once a file added under
+// another name replaces it.
+func (iw *ImageWriter) lookupFile(name string) *FileEntry {
+	components := splitPath(name)
+	if len(components) == 0 {
+		return nil
+	}
+	dir := iw.root
+	for _, c := range components[:len(components)-1] {
+		var next *directoryEntry
+		for _, sub := range dir.subdirs {
+			if sub.origName == c {
+				next = sub
+				break
+			} else if sub.name == c && next == nil {
+				next = sub
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		dir = next
+	}
+	var found *FileEntry
+	for _, f := range dir.files {
+		if f.flags&fileFlagAssociated != 0 {
+			continue
+		}
+		if f.origName == components[len(components)-1] {
+			return f
+		} else if f.Name == components[len(components)-1] && found == nil {
+			found = f
+		}
+	}
+	return found
+}
+
+// removeOverlaid removes the file of d that f replaces because one of them
+// was taken from an existing image.
+func (d *directoryEntry) removeOverlaid(f *FileEntry) {
+	for i, g := range d.files {
+		if g.Name == f.Name && g.flags&fileFlagAssociated == f.flags&fileFlagAssociated && (g.overlay || f.overlay) {
+			d.files = append(d.files[:i], d.files[i+1:]...)
+			return
+		}
+	}
+}
+
+// conflicts reports whether f can't be added to d because of an existing
+// entry with the same name.  An associated file and a regular file may
+// share a name.
+func (d *directoryEntry) conflicts(f *FileEntry) bool {
+	for _, sub := range d.subdirs {
+		if sub.name == f.Name {
+			return true
+		}
+	}
+	for _, g := range d.files {
+		if g.Name == f.Name && g.flags&fileFlagAssociated == f.flags&fileFlagAssociated {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the slash-separated path of d within the image, which is
+// empty for the root directory.
+func (d *directoryEntry) path() string {
+	if d.parent == nil {
+		return ""
+	}
+	return d.parent.path() + "/" + d.name
+}
+
+func splitPath(name string) []string {
+	var components []string
+	for _, c := range strings.Split(name, "/") {
+		if c != "" {
+			components = append(components, c)
+		}
+	}
+	return components
+}
+
+// outputBufferSize is the size of the writes Finalize makes to the output,
+// but for the system area.
+const outputBufferSize = 256 << 10
+
+// Finalize reads every scheduled input and writes the complete image to
+// outfh.
+func (iw *ImageWriter) Finalize(outfh io.Writer) error {
+	return iw.FinalizeContext(context.Background(), outfh)
+}
+
+// FinalizeContext is like Finalize, but stops writing and returns ctx's
+// error once ctx is done.  Input files opened by the ImageWriter are closed
+// before it returns.
+func (iw *ImageWriter) FinalizeContext(ctx context.Context, outfh io.Writer) error {
+	return iw.finalize(ctx, outfh, nil)
+}
+
+// FinalizeAt is like Finalize, but writes the image to w from offset 0 on,
+// patching structures in once the data they describe has been written.
+// Boot images with a boot info table are then written as they are read and
+// patched afterwards, rather than read into memory first, unless
+// WithSHA256 or WithVerify need the image to be written as a stream.
+func (iw *ImageWriter) FinalizeAt(w io.WriterAt) error {
+	return iw.FinalizeAtContext(context.Background(), w)
+}
+
+// FinalizeAtContext is like FinalizeAt, but stops writing and returns ctx's
+// error once ctx is done.
+func (iw *ImageWriter) FinalizeAtContext(ctx context.Context, w io.WriterAt) error {
+	return iw.finalize(ctx, &offsetWriter{w: w}, w)
+}
+
+// finalize writes the image to outfh, which writes to at if at is set.
+func (iw *ImageWriter) finalize(ctx context.Context, outfh io.Writer, at io.WriterAt) error {
+	err := iw.options.validate()
+	if err != nil {
+		return err
+	}
+	now, err := iw.options.recordingTime()
+	if err != nil {
+		return err
+	}
+	iw.patchLate = at != nil && !iw.sha256 && !iw.verify
+	defer func() { iw.patchLate = false }()
+	l, err := iw.layout()
+	if err != nil {
+		return err
+	}
+	var target interface{} = outfh
+	if at != nil {
+		target = at
+	}
+	readBack, ok := target.(io.ReaderAt)
+	if iw.verify && !ok {
+		return fmt.Errorf("verifying the image requires an output that can be read back")
+	}
+
+	area, err := iw.systemArea(l, now)
+	if err != nil {
+		return err
+	}
+	out := outfh
+	var sparse *sparseWriter
+	if f, ok := outfh.(*os.File); ok && iw.sparse {
+		if sparse, err = newSparseWriter(f); err != nil {
+			return fmt.Errorf("could not write to output file: %w", err)
+		} else if sparse != nil {
+			out = sparse
+		}
+	}
+	rw := newResultWriter(out, &iw.options)
+	_, err = rw.Write(area)
+	if err != nil {
+		return fmt.Errorf("could not write to output file: %w", err)
+	}
+
+	bufw := bufio.NewWriterSize(rw, outputBufferSize)
+	w := NewISO9660Writer(bufw)
+	if at != nil {
+		// the output starts with the first sector of the session
+		w = newPatchingWriter(bufw, at, -int64(l.sessionStart)*int64(SectorSize))
+	}
+	w.sectorNum += l.sessionStart
+	w.ctx = ctx
+
+	err = iw.write(w, l, now)
+	// A failed write leaves the sectors after it unwritten, which the
+	// layout checks in write may report first; the write error is the one
+	// that matters.
+	if werr := w.Err(); werr != nil {
+		return fmt.Errorf("could not write to output file: %w", werr)
+	} else if err != nil {
+		return err
+	}
+	err = bufw.Flush()
+	if err == nil && sparse != nil {
+		err = sparse.finish()
+	}
+	if err != nil {
+		return fmt.Errorf("could not write to output file: %w", err)
+	}
+	if iw.verify {
+		if err := iw.verifyImage(readBack, l); err != nil {
+			return err
+		}
+	}
+	rw.fill(&iw.options, l)
+	return nil
+}
+
+// write writes everything following the reserved sectors to w.
+func (iw *ImageWriter) write(w *ISO9660Writer, l *imageLayout, now time.Time) error {
+	err := writePrimaryVolumeDescriptor(w, &iw.options, l, now)
+	if err != nil {
+		return err
+	}
+	if l.bootRecordSector != 0 {
+		err = writeBootRecord(w, l)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeBootRecords(w, &iw.options, l)
+	if err != nil {
+		return err
+	}
+	for _, v := range l.svds {
+		err = writeSupplementaryVolumeDescriptor(w, &iw.options, l, v, now)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeVolumeDescriptorSetTerminator(w, l)
+	if err != nil {
+		return err
+	}
+	err = writePathTable(w, binary.LittleEndian, l.lPathTableSector, l.dirs)
+	if err != nil {
+		return err
+	}
+	err = writePathTable(w, binary.BigEndian, l.mPathTableSector, l.dirs)
+	if err != nil {
+		return err
+	}
+	err = writeSupplementaryPathTables(w, l)
+	if err != nil {
+		return err
+	}
+	for _, d := range l.dirs {
+		err = writeDirectory(w, d, &iw.options, now)
+		if err != nil {
+			return err
+		}
+	}
+	err = writeSupplementaryDirectories(w, &iw.options, l, now)
+	if err != nil {
+		return err
+	}
+	if l.bootCatalogSector != 0 {
+		err = writeBootCatalog(w, l, iw.boot)
+		if err != nil {
+			return err
+		}
+	}
+	late := map[*FileEntry]bool{}
+	if iw.patchLate {
+		late = iw.bootInfoTableFiles()
+	} else {
+		iw.patchBootInfoTables()
+	}
+	p := &progressReporter{fn: iw.progress, w: w, start: l.sessionStart, total: l.numSectors - l.sessionStart}
+	if iw.lazy != nil {
+		// nothing is written
+		p.fn = nil
+	}
+	p.report("")
+	var pf *prefetcher
+	if iw.prefetch > 0 && iw.lazy == nil {
+		pf = startPrefetch(l, iw.prefetch)
+		defer pf.close()
+	}
+	for _, d := range l.dirs {
+		for _, f := range d.files {
+			path := d.path() + "/" + f.Name
+			if f.shares != nil {
+				iw.logf("file %s shares the data at sector %d", path, f.sector)
+				continue
+			} else if f.prior {
+				iw.logf("file %s is kept from the previous session at sector %d", path, f.sector)
+				continue
+			}
+			iw.logf("file %s at sector %d", path, f.sector)
+			if f.xar != nil {
+				t := f.records(&iw.options)[0].recorded
+				if t.IsZero() {
+					t = now
+				}
+				err = writeExtendedAttributeRecord(w, f, path, t)
+				if err != nil {
+					return err
+				}
+			}
+			if iw.lazy != nil && f.contents == nil {
+				iw.lazy.skip(w, f, path, l)
+				continue
+			}
+			var checksum *bootInfoChecksum
+			var tee io.Writer
+			if late[f] {
+				checksum = &bootInfoChecksum{}
+				tee = checksum
+			}
+			err = writeFileData(w, f, path, pf, p, iw.verify, tee)
+			if err != nil {
+				return err
+			}
+			if checksum != nil && w.Err() == nil {
+				table := iw.bootInfoTable(f, checksum.sum())
+				if err := w.WriteSectorAt(f.sector+f.xarSectors(), 8, table); err != nil {
+					return fmt.Errorf("could not write to output file: %w", err)
+				}
+			}
+		}
+	}
+	for i := uint32(0); i < iw.padding; i++ {
+		w.NextSector().PadWithZeros()
+	}
+	if iw.hybridGPT {
+		backup, err := iw.gptBackup(l, now)
+		if err != nil {
+			return err
+		}
+		writeBytes(w, backup)
+	}
+	// The volume space size recorded in the primary volume descriptor
+	// must cover exactly the sectors written.
+	if w.CurrentSector() != l.numSectors-1 {
+		return internalErrorf("unexpected last sector number (expected %d, actual %d)",
+			l.numSectors-1, w.CurrentSector())
+	}
+
+	w.Finish()
+	return nil
+}
+
+// maxSectors is the number of logical blocks addressable through the 32-bit
+// extent locations of directory records and the volume space size field.
+const maxSectors = int64(math.MaxUint32)
+
+// imageLayout describes where everything is placed in an image.
+type imageLayout struct {
+	// sessionStart is the first sector of the image, which is zero unless
+	// it is a later session of a multisession medium.
+	sessionStart uint32
+
+	// dirs holds every directory in path table order, starting with the
+	// root directory.
+	dirs []*directoryEntry
+
+	// svds describes the supplementary volumes.
+	svds []*svdLayout
+
+	volumeID            string
+	copyrightFileID     string
+	abstractFileID      string
+	bibliographicFileID string
+
+	// bootRecordSector is zero if the image has no boot record.
+	bootRecordSector uint32
+	// bootRecordsSector is the sector of the first boot record given with
+	// WithBootRecord.
+	bootRecordsSector uint32
+	terminatorSector  uint32
+	bootCatalogSector uint32
+
+	pathTableSize    uint32
+	lPathTableSector uint32
+	mPathTableSector uint32
+
+	numSectors uint32
+}
+
+// layout assigns path table numbers and sectors to every directory and file.
+// Sector arithmetic is done on 64 bits, so an image that does not fit in the
+// 32-bit fields of the format is reported as an error rather than wrapping
+// around.
+func (iw *ImageWriter) layout() (*imageLayout, error) {
+	if err := iw.relocate(); err != nil {
+		return nil, err
+	}
+	if err := iw.layoutBoot(); err != nil {
+		return nil, err
+	}
+	if iw.sessionStart < iw.previousEnd {
+		return nil, fmt.Errorf("session starting at sector %d overlaps the previous session, which ends at sector %d", iw.sessionStart, iw.previousEnd)
+	}
+	l := &imageLayout{dirs: []*directoryEntry{iw.root}, sessionStart: iw.sessionStart}
+	for i := 0; i < len(l.dirs); i++ {
+		if i >= math.MaxUint16 {
+			return nil, fmt.Errorf("image has more than %d directories", math.MaxUint16)
+		}
+		l.dirs[i].number = uint16(i + 1)
+		if iw.transTable {
+			if err := l.dirs[i].addTransTable(&iw.options); err != nil {
+				return nil, err
+			}
+		}
+		// Sorting the subdirectories before queueing them orders the
+		// path table by level, parent and identifier.
+		l.dirs[i].sortEntries()
+		l.dirs = append(l.dirs, l.dirs[i].isoSubdirs()...)
+	}
+	if err := iw.layoutDescriptorFiles(l); err != nil {
+		return nil, err
+	}
+	if err := iw.layoutVolumeID(l); err != nil {
+		return nil, err
+	}
+
+	l.terminatorSector = l.sessionStart + primaryVolumeSectorNum + 1
+	if len(iw.boot) > 0 {
+		l.bootRecordSector = l.terminatorSector
+		l.terminatorSector++
+	}
+	for _, r := range iw.bootRecords {
+		if len(iw.boot) > 0 && r.SystemID == bootSystemID {
+			return nil, fmt.Errorf("boot record %q clashes with the El Torito boot record of the boot images", r.SystemID)
+		}
+	}
+	l.bootRecordsSector = l.terminatorSector
+	l.terminatorSector += uint32(len(iw.bootRecords))
+	if err := iw.layoutSupplementaryVolumes(l); err != nil {
+		return nil, err
+	}
+
+	l.pathTableSize = pathTableSize(l.dirs)
+	pathTableSectors := numDataSectors(int64(l.pathTableSize))
+	l.lPathTableSector = l.terminatorSector + 1
+	l.mPathTableSector = l.lPathTableSector + uint32(pathTableSectors)
+
+	sector := int64(l.mPathTableSector) + pathTableSectors
+	for _, v := range l.svds {
+		sector = v.placePathTables(sector)
+	}
+	for _, d := range l.dirs {
+		recs := d.records(&iw.options)
+		for _, r := range recs {
+			if r.length() > 255 {
+				return nil, fmt.Errorf("directory record for %s in %s is too long", r.identifier, d.path()+"/")
+			}
+		}
+		d.size = directoryExtentSize(recs)
+		d.sector = uint32(sector)
+		sector += int64(d.size / SectorSize)
+	}
+	for _, v := range l.svds {
+		var err error
+		if sector, err = v.placeDirs(sector, &iw.options); err != nil {
+			return nil, err
+		}
+	}
+	if len(iw.boot) > 0 {
+		l.bootCatalogSector = uint32(sector)
+		sector++
+	}
+	// hard links to the same source file, and with WithDeduplication
+	// files with the same contents, share a single extent
+	links := map[fileID]*FileEntry{}
+	contents := map[[32]byte]*FileEntry{}
+	unshared := iw.bootInfoTableFiles()
+	if iw.dedup {
+		if err := iw.hashDuplicateCandidates(l.dirs, unshared); err != nil {
+			return nil, err
+		}
+	}
+	for _, d := range l.dirs {
+		for _, f := range d.files {
+			if sector > maxSectors {
+				break
+			}
+			f.shares = nil
+			if f.prior {
+				continue
+			}
+			if err := f.checkInterleave(d.path() + "/" + f.Name); err != nil {
+				return nil, err
+			} else if err := f.checkExtendedAttributes(d.path() + "/" + f.Name); err != nil {
+				return nil, err
+			}
+			if f.Size == 0 && f.xar == nil {
+				// an empty file has no data to locate, so its extent
+				// is recorded with length 0 at sector 0 rather than
+				// pointing past the end of the image
+				f.sector = 0
+				continue
+			}
+			if f.inode != nil && f.xar == nil && f.unitSize == 0 && !unshared[f] {
+				if first, ok := links[*f.inode]; ok && first.Size == f.Size {
+					f.shares = first
+				} else {
+					links[*f.inode] = f
+				}
+			}
+			if f.shares == nil && iw.dedup && f.digest != nil {
+				if first, ok := contents[*f.digest]; ok && first.Size == f.Size {
+					f.shares = first
+				} else {
+					contents[*f.digest] = f
+				}
+			}
+			if f.shares != nil {
+				f.sector = f.shares.sector
+				continue
+			}
+			f.sector = uint32(sector)
+			sector += int64(f.xarSectors()) + f.dataSectors()
+		}
+	}
+	sector += int64(iw.padding)
+	if iw.hybridGPT {
+		if _, err := iw.efiBootImage(); err != nil {
+			return nil, err
+		}
+		sector += int64(gptBackupSectors)
+	}
+	if _, err := iw.apmFiles(); err != nil {
+		return nil, err
+	}
+	if sector > maxSectors {
+		return nil, fmt.Errorf("image of %d sectors exceeds the maximum of %d sectors", sector, maxSectors)
+	}
+	l.numSectors = uint32(sector)
+	return l, nil
+}
+
+// numDataSectors returns the number of sectors needed to hold size bytes.
+func numDataSectors(size int64) int64 {
+	return (size + int64(SectorSize-1)) / int64(SectorSize)
+}
@@ -0,0 +1,37 @@
+package iso9660wrap
+
+import "fmt"
+
+// Interleave records the file in interleaved mode, in file units of
+// unitSize sectors separated by gaps of gapSize sectors, which are left
+// blank, for media or firmware that read such files.  Both must be set.
+// Interleaved files are never shared with other files, and can't be boot
+// images or be recorded in several extents.
+func Interleave(unitSize, gapSize byte) FileOption {
+	return func(f *FileEntry) {
+		f.unitSize, f.gapSize = unitSize, gapSize
+	}
+}
+
+// checkInterleave checks the interleaving of the file f at path.
+func (f *FileEntry) checkInterleave(path string) error {
+	if f.unitSize == 0 && f.gapSize == 0 {
+		return nil
+	} else if f.unitSize == 0 || f.gapSize == 0 {
+		return fmt.Errorf("file %s needs both a file unit size and an interleave gap size to be interleaved", path)
+	} else if f.Size > maxExtentSize {
+		return fmt.Errorf("file %s of %d bytes can't be interleaved, since it needs several extents", path, f.Size)
+	}
+	return nil
+}
+
+// dataSectors returns the number of sectors of the extent of f, which for
+// an interleaved file includes the gaps between its file units.
+func (f *FileEntry) dataSectors() int64 {
+	n := numDataSectors(f.Size)
+	if f.unitSize == 0 || n == 0 {
+		return n
+	}
+	units := (n + int64(f.unitSize) - 1) / int64(f.unitSize)
+	return n + (units-1)*int64(f.gapSize)
+}
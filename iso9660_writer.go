@@ -1,7 +1,10 @@
 package iso9660wrap
 
 import (
+	"bufio"
+	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
 	"strings"
@@ -10,23 +13,43 @@ import (
 
 const SectorSize uint32 = 2048
 
+// SectorWriter writes the contents of a single sector.  Once a write fails,
+// all further writes are ignored and the error is available from Err.
 type SectorWriter struct {
-	w io.Writer
-	p uint32
+	w   io.Writer
+	p   uint32
+	err error
+}
+
+// Err returns the first error encountered by w.
+func (w *SectorWriter) Err() error {
+	return w.err
+}
+
+func (w *SectorWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
 }
 
 func (w *SectorWriter) Write(p []byte) uint32 {
+	if w.err != nil {
+		return 0
+	}
 	if len(p) >= math.MaxUint32 {
-		Panicf("attempted write of length %d is out of sector bounds", len(p))
+		w.fail(fmt.Errorf("%w: attempted write of length %d", ErrSectorBounds, len(p)))
+		return 0
 	}
 	l := uint32(len(p))
 	if l > w.RemainingSpace() {
-		Panicf("attempted write of length %d at offset %d is out of sector bounds", w.p, len(p))
+		w.fail(fmt.Errorf("%w: attempted write of length %d at offset %d", ErrSectorBounds, len(p), w.p))
+		return 0
 	}
 	w.p += l
 	_, err := w.w.Write(p)
 	if err != nil {
-		panic(err)
+		w.fail(err)
+		return 0
 	}
 	return l
 }
@@ -40,14 +63,29 @@ func (w *SectorWriter) WriteUnspecifiedDateTime() uint32 {
 	return w.Write(b)
 }
 
+// WriteDateTime writes t as a volume descriptor date and time field, in t's
+// time zone.  Times in zones whose offset can't be recorded are written in
+// UTC; pass t.UTC() to always record UTC.
 func (w *SectorWriter) WriteDateTime(t time.Time) uint32 {
-	f := t.UTC().Format("20060102150405")
-	f += "00"   // 1/100
-	f += "\x00" // UTC offset
-	if len(f) != 17 {
-		Panicf("date and time field %q is of unexpected length %d", f, len(f))
+	t, offset := gmtOffset(t)
+	f := t.Format("20060102150405")
+	f += fmt.Sprintf("%02d", t.Nanosecond()/1e7) // 1/100
+	if len(f) != 16 {
+		w.fail(fmt.Errorf("date and time field %q is of unexpected length %d", f, len(f)))
+		return 0
+	}
+	return w.WriteString(f) + w.Write([]byte{offset})
+}
+
+// gmtOffset returns t, or t in UTC if its zone offset can't be recorded,
+// along with the offset from GMT in 15 minute intervals that ISO9660 date
+// fields hold.
+func gmtOffset(t time.Time) (time.Time, byte) {
+	_, offset := t.Zone()
+	if offset%(15*60) != 0 || offset < -48*15*60 || offset > 52*15*60 {
+		return t.UTC(), 0
 	}
-	return w.WriteString(f)
+	return t, byte(int8(offset / (15 * 60)))
 }
 
 func (w *SectorWriter) WriteString(str string) uint32 {
@@ -55,17 +93,23 @@ func (w *SectorWriter) WriteString(str string) uint32 {
 }
 
 func (w *SectorWriter) WritePaddedString(str string, length uint32) uint32 {
+	if uint32(len(str)) > length {
+		w.fail(fmt.Errorf("padded string %q exceeds length %d", str, length))
+		return 0
+	}
 	l := w.WriteString(str)
-	if l > 32 {
-		Panicf("padded string %q exceeds length %d", str, length)
-	} else if l < 32 {
-		w.WriteString(strings.Repeat(" ", int(32-l)))
+	if l < length {
+		w.WriteString(strings.Repeat(" ", int(length-l)))
 	}
-	return 32
+	return length
 }
 
-func (w *SectorWriter) WriteByte(b byte) uint32 {
-	return w.Write([]byte{b})
+// WriteByte writes a single byte.  Unlike the other write methods it returns
+// an error rather than the length written, so that SectorWriter implements
+// io.ByteWriter.
+func (w *SectorWriter) WriteByte(b byte) error {
+	w.Write([]byte{b})
+	return w.err
 }
 
 func (w *SectorWriter) WriteWord(bo binary.ByteOrder, word uint16) uint32 {
@@ -101,11 +145,15 @@ func (w *SectorWriter) WriteBothEndianDWord(dword uint32) uint32 {
 }
 
 func (w *SectorWriter) WriteZeros(c int) uint32 {
-	return w.Write(make([]byte, c))
+	if c > len(zeroSector) {
+		// more than fits in a sector
+		return w.Write(make([]byte, c))
+	}
+	return w.Write(zeroSector[:c])
 }
 
 func (w *SectorWriter) PadWithZeros() uint32 {
-	return w.Write(make([]byte, w.RemainingSpace()))
+	return w.Write(zeroSector[:w.RemainingSpace()])
 }
 
 func (w *SectorWriter) RemainingSpace() uint32 {
@@ -119,6 +167,15 @@ func (w *SectorWriter) Reset() {
 type ISO9660Writer struct {
 	sw        *SectorWriter
 	sectorNum uint32
+
+	// ctx, if set, is checked before moving on to the next sector
+	ctx context.Context
+
+	// at, if set, lets sectors be patched once written: sector 0 is at
+	// offset origin of at, and buf holds what is not yet written to it
+	at     io.WriterAt
+	origin int64
+	buf    *bufio.Writer
 }
 
 func (w *ISO9660Writer) CurrentSector() uint32 {
@@ -126,8 +183,18 @@ func (w *ISO9660Writer) CurrentSector() uint32 {
 }
 
 func (w *ISO9660Writer) NextSector() *SectorWriter {
+	if w.sw.err != nil {
+		return w.sw
+	}
+	if w.ctx != nil {
+		if err := w.ctx.Err(); err != nil {
+			w.sw.fail(err)
+			return w.sw
+		}
+	}
 	if w.sw.RemainingSpace() == SectorSize {
-		Panicf("internal error: tried to leave sector %d empty", w.sectorNum)
+		w.sw.fail(fmt.Errorf("%w: tried to leave sector %d empty", ErrInternal, w.sectorNum))
+		return w.sw
 	}
 	w.sw.PadWithZeros()
 	w.sw.Reset()
@@ -139,10 +206,71 @@ func (w *ISO9660Writer) Finish() {
 	if w.sw.RemainingSpace() != SectorSize {
 		w.sw.PadWithZeros()
 	}
-	w.sw = nil
+}
+
+// Err returns the first error encountered while writing, including the
+// error of the context the writer was created with.
+func (w *ISO9660Writer) Err() error {
+	return w.sw.err
 }
 
 func NewISO9660Writer(w io.Writer) *ISO9660Writer {
 	// start at the end of the last reserved sector
-	return &ISO9660Writer{&SectorWriter{w, SectorSize}, 16 - 1}
+	return &ISO9660Writer{sw: &SectorWriter{w: w, p: SectorSize}, sectorNum: 16 - 1}
+}
+
+// NewISO9660WriterAt returns an ISO9660Writer that writes sectors in order
+// to w, sector 16 at offset, like NewISO9660Writer, but can also patch the
+// sectors it has written with WriteSectorAt.  This suits structures whose
+// contents are only known once the data following them is written.  Writes
+// are buffered until Flush.
+func NewISO9660WriterAt(w io.WriterAt, offset int64) *ISO9660Writer {
+	buf := bufio.NewWriterSize(&offsetWriter{w: w, off: offset}, outputBufferSize)
+	return newPatchingWriter(buf, w, offset-int64(primaryVolumeSectorNum)*int64(SectorSize))
+}
+
+// newPatchingWriter returns an ISO9660Writer writing to buf, which buffers
+// writes to at, where sector 0 is at offset origin.
+func newPatchingWriter(buf *bufio.Writer, at io.WriterAt, origin int64) *ISO9660Writer {
+	w := NewISO9660Writer(buf)
+	w.at, w.origin, w.buf = at, origin, buf
+	return w
+}
+
+// WriteSectorAt overwrites the bytes of sector from offset on with b.  The
+// bytes must have been written already, by a writer from
+// NewISO9660WriterAt.
+func (w *ISO9660Writer) WriteSectorAt(sector, offset uint32, b []byte) error {
+	if w.at == nil {
+		return fmt.Errorf("sectors written to an io.Writer can't be patched")
+	}
+	end := uint64(offset) + uint64(len(b))
+	if sector > w.sectorNum || end > uint64(SectorSize) || sector == w.sectorNum && end > uint64(SectorSize-w.sw.RemainingSpace()) {
+		return fmt.Errorf("%w: attempted patch of %d bytes at offset %d of sector %d", ErrSectorBounds, len(b), offset, sector)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := w.at.WriteAt(b, w.origin+int64(sector)*int64(SectorSize)+int64(offset))
+	return err
+}
+
+// Flush writes the data buffered by a writer from NewISO9660WriterAt.
+func (w *ISO9660Writer) Flush() error {
+	if w.buf == nil {
+		return nil
+	}
+	return w.buf.Flush()
+}
+
+// offsetWriter writes to w in order, starting at off.
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
 }
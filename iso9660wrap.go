@@ -1,140 +1,161 @@
+// Package iso9660wrap writes ISO9660 images, from a single wrapped file up
+// to bootable hybrid images with Rock Ridge and Joliet names, and reads and
+// checks existing ones.
+//
+// Writers report failures as errors rather than panics.  The write methods
+// of a SectorWriter return the length written, and their errors are
+// available from its Err method, except for WriteByte, which returns its
+// error as io.ByteWriter does.
 package iso9660wrap
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"math"
+	"io/fs"
 	"os"
 	"strings"
 	"time"
 )
 
+// Panicf panics with an error formatted from format and v.
+//
+// Deprecated: the package reports errors through return values.
 func Panicf(format string, v ...interface{}) {
 	panic(fmt.Errorf(format, v...))
 }
 
-const volumeDescriptorSetMagic = "\x43\x44\x30\x30\x31\x01"
+// standardIdentifier starts every volume descriptor after its type, and is
+// followed by the version of the descriptor, which is 2 only for enhanced
+// volume descriptors.
+const standardIdentifier = "\x43\x44\x30\x30\x31"
+
+const volumeDescriptorSetMagic = standardIdentifier + "\x01"
 
 const primaryVolumeSectorNum uint32 = 16
-const numVolumeSectors uint32 = 2 // primary + terminator
-const littleEndianPathTableSectorNum uint32 = primaryVolumeSectorNum + numVolumeSectors
-const bigEndianPathTableSectorNum uint32 = littleEndianPathTableSectorNum + 1
-const numPathTableSectors = 2 // no secondaries
-const rootDirectorySectorNum uint32 = primaryVolumeSectorNum + numVolumeSectors + numPathTableSectors
 
 // WriteFile writes the contents of infh to an iso at outfh with the name provided
-func WriteFile(outfh, infh *os.File) error {
+func WriteFile(outfh, infh *os.File, opts ...Option) error {
+	return WriteFSFile(outfh, infh, opts...)
+}
+
+// WriteFSFile is like WriteFile, but takes any fs.File, such as a file opened
+// from an fs.FS or one held in memory, and writes the image to any
+// io.Writer.  The name and size of the file are those its Stat reports.  A
+// file that supports ReadAt and Seek, as an *os.File does, may be read again
+// as AddReader describes; others are read once.
+func WriteFSFile(outfh io.Writer, infh fs.File, opts ...Option) error {
 	fileSize, filename, err := getInputFileSizeAndName(infh)
 	if err != nil {
 		return err
 	}
-	filename = strings.ToUpper(filename)
-	if !filenameSatisfiesISOConstraints(filename) {
-		return fmt.Errorf("Input file name %s does not satisfy the ISO9660 character set constraints", filename)
-	}
-
-	buf := make([]byte, fileSize, fileSize)
-	_, err = infh.Read(buf)
+	iw := NewImageWriter(append([]Option{WithVolumeID(truncate(strings.ToUpper(filename), 32))}, opts...)...)
+	err = iw.AddReader(filename, fileSize, infh)
 	if err != nil {
 		return err
 	}
-
-	return WriteBuffer(outfh, buf, filename)
+	return iw.Finalize(outfh)
 }
 
-// WriteBuffer writes the contents of buf to an iso at outfh with the name provided
-func WriteBuffer(outfh io.Writer, buf []byte, filename string) error {
-	fileSize := uint32(len(buf))
-	r := bytes.NewReader(buf)
-
-	// reserved sectors
-	reservedAreaLength := int64(16 * SectorSize)
-	_, err := outfh.Write(make([]byte,reservedAreaLength))
-	if err != nil {
-		return fmt.Errorf("could not write to output file: %s", err)
-	}
-
-	err = nil
-	func() {
-		defer func() {
-			var ok bool
-			e := recover()
-			if e != nil {
-				err, ok = e.(error)
-				if !ok {
-					panic(e)
-				}
-			}
-		}()
+// WriteFiles writes the local files at infiles to an iso at outfh, each in
+// the root directory under its base name.  With no infiles, the image holds
+// just an empty root directory.  outfh is written sequentially, so it may be
+// a pipe, a network connection or an in-memory buffer.  The infiles are
+// stat'ed up front but opened only when their data is written, and each is
+// closed before the next is opened, so any number of them may be given.
+func WriteFiles(outfh io.Writer, infiles []string, opts ...Option) error {
+	return WriteFilesContext(context.Background(), outfh, infiles, opts...)
+}
 
-		bufw := bufio.NewWriter(outfh)
+// WriteFilesContext is like WriteFiles, but stops writing and returns ctx's
+// error once ctx is done.
+func WriteFilesContext(ctx context.Context, outfh io.Writer, infiles []string, opts ...Option) error {
+	iw := NewImageWriter(opts...)
+	for _, infile := range infiles {
+		err := iw.AddFile(infile)
+		if err != nil {
+			return err
+		}
+	}
+	return iw.FinalizeContext(ctx, outfh)
+}
 
-		w := NewISO9660Writer(bufw)
+// WriteBuffer writes the contents of buf to an iso at outfh with the name provided
+func WriteBuffer(outfh io.Writer, buf []byte, filename string, opts ...Option) error {
+	return WriteBufferContext(context.Background(), outfh, buf, filename, opts...)
+}
 
-		writePrimaryVolumeDescriptor(w, fileSize, filename)
-		writeVolumeDescriptorSetTerminator(w)
-		writePathTable(w, binary.LittleEndian)
-		writePathTable(w, binary.BigEndian)
-		writeData(w, r, fileSize, filename)
+// WriteBufferContext is like WriteBuffer, but stops writing and returns ctx's
+// error once ctx is done.
+func WriteBufferContext(ctx context.Context, outfh io.Writer, buf []byte, filename string, opts ...Option) error {
+	return WriteReaderContext(ctx, outfh, bytes.NewReader(buf), int64(len(buf)), filename, opts...)
+}
 
-		w.Finish()
+// WriteReader writes size bytes read from r to an iso at outfh with the name
+// provided, like WriteBuffer, streaming them rather than holding them in
+// memory.  r is read once, while the image is written, unless it supports
+// ReadAt and Seek as AddReader describes.
+func WriteReader(outfh io.Writer, r io.Reader, size int64, filename string, opts ...Option) error {
+	return WriteReaderContext(context.Background(), outfh, r, size, filename, opts...)
+}
 
-		err := bufw.Flush()
-		if err != nil {
-			panic(err)
-		}
-	}()
+// WriteReaderContext is like WriteReader, but stops writing and returns
+// ctx's error once ctx is done.
+func WriteReaderContext(ctx context.Context, outfh io.Writer, r io.Reader, size int64, filename string, opts ...Option) error {
+	iw := NewImageWriter(append([]Option{WithVolumeID(truncate(filename, 32))}, opts...)...)
+	iw.rawNames = true
+	err := iw.AddReader(filename, size, r)
 	if err != nil {
-		return fmt.Errorf("could not write to output file: %s", err)
+		return err
 	}
-	return nil
+	return iw.FinalizeContext(ctx, outfh)
 }
 
-func writePrimaryVolumeDescriptor(w *ISO9660Writer, fileSize uint32, filename string) {
-	if len(filename) > 32 {
-		filename = filename[:32]
-	}
-	now := time.Now()
-
+func writePrimaryVolumeDescriptor(w *ISO9660Writer, o *options, l *imageLayout, now time.Time) error {
 	sw := w.NextSector()
-	if w.CurrentSector() != primaryVolumeSectorNum {
-		Panicf("internal error: unexpected primary volume sector %d", w.CurrentSector())
+	if w.CurrentSector() != l.sessionStart+primaryVolumeSectorNum {
+		return internalErrorf("unexpected primary volume sector %d", w.CurrentSector())
 	}
 
 	sw.WriteByte('\x01')
 	sw.WriteString(volumeDescriptorSetMagic)
 	sw.WriteByte('\x00')
 
-	sw.WritePaddedString("", 32)
-	sw.WritePaddedString(filename, 32)
+	sw.WritePaddedString(o.systemID, 32)
+	sw.WritePaddedString(l.volumeID, 32)
 
 	sw.WriteZeros(8)
-	sw.WriteBothEndianDWord(numTotalSectors(fileSize))
+	sw.WriteBothEndianDWord(l.numSectors)
 	sw.WriteZeros(32)
 
-	sw.WriteBothEndianWord(1) // volume set size
-	sw.WriteBothEndianWord(1) // volume sequence number
+	size, sequence := o.volumeSet()
+	sw.WriteBothEndianWord(size)
+	sw.WriteBothEndianWord(sequence)
 	sw.WriteBothEndianWord(uint16(SectorSize))
-	sw.WriteBothEndianDWord(SectorSize) // path table length
+	sw.WriteBothEndianDWord(l.pathTableSize)
 
-	sw.WriteLittleEndianDWord(littleEndianPathTableSectorNum)
+	sw.WriteLittleEndianDWord(l.lPathTableSector)
 	sw.WriteLittleEndianDWord(0) // no secondary path tables
-	sw.WriteBigEndianDWord(bigEndianPathTableSectorNum)
+	sw.WriteBigEndianDWord(l.mPathTableSector)
 	sw.WriteBigEndianDWord(0) // no secondary path tables
 
-	WriteDirectoryRecord(sw, "\x00", rootDirectorySectorNum) // root directory
+	rootRecord := l.dirs[0].record("\x00")
+	_, rootRecord.volume = o.volumeSet()
+	rootRecord.write(sw, now)
 
-	sw.WritePaddedString("", 128) // volume set identifier
-	sw.WritePaddedString("", 128) // publisher identifier
-	sw.WritePaddedString("", 128) // data preparer identifier
-	sw.WritePaddedString("", 128) // application identifier
+	sw.WritePaddedString(o.volumeSetID, 128)
+	sw.WritePaddedString(o.publisherID, 128)
+	sw.WritePaddedString(o.dataPreparerID, 128)
+	sw.WritePaddedString(o.applicationID, 128)
 
-	sw.WritePaddedString("", 37) // copyright file identifier
-	sw.WritePaddedString("", 37) // abstract file identifier
-	sw.WritePaddedString("", 37) // bibliographical file identifier
+	sw.WritePaddedString(l.copyrightFileID, 37)
+	sw.WritePaddedString(l.abstractFileID, 37)
+	sw.WritePaddedString(l.bibliographicFileID, 37)
 
 	sw.WriteDateTime(now)         // volume creation
 	sw.WriteDateTime(now)         // most recent modification
@@ -144,100 +165,215 @@ func writePrimaryVolumeDescriptor(w *ISO9660Writer, fileSize uint32, filename st
 	sw.WriteByte('\x01') // version
 	sw.WriteByte('\x00') // reserved
 
+	if o.xa {
+		// the XA signature goes in the application use field, at offset
+		// 1024 of the descriptor
+		sw.WriteZeros(1024 - 883)
+		sw.WriteString(xaSignature)
+	}
 	sw.PadWithZeros() // 512 (reserved for app) + 653 (zeros)
+	return nil
 }
 
-func writeVolumeDescriptorSetTerminator(w *ISO9660Writer) {
+func writeVolumeDescriptorSetTerminator(w *ISO9660Writer, l *imageLayout) error {
 	sw := w.NextSector()
-	if w.CurrentSector() != primaryVolumeSectorNum+1 {
-		Panicf("internal error: unexpected volume descriptor set terminator sector %d", w.CurrentSector())
+	if w.CurrentSector() != l.terminatorSector {
+		return internalErrorf("unexpected volume descriptor set terminator sector %d", w.CurrentSector())
 	}
 
 	sw.WriteByte('\xFF')
 	sw.WriteString(volumeDescriptorSetMagic)
 
 	sw.PadWithZeros()
+	return nil
 }
 
-func writePathTable(w *ISO9660Writer, bo binary.ByteOrder) {
-	sw := w.NextSector()
-	sw.WriteByte(1) // name length
-	sw.WriteByte(0) // number of sectors in extended attribute record
-	sw.WriteDWord(bo, rootDirectorySectorNum)
-	sw.WriteWord(bo, 1) // parent directory recno (root directory)
-	sw.WriteByte(0)     // identifier (root directory)
-	sw.WriteByte(1)     // padding
-	sw.PadWithZeros()
+// pathTable returns the path table for dirs, which must be in path table
+// order, with its numbers recorded in byte order bo.
+func pathTable(bo binary.ByteOrder, dirs []*directoryEntry) []byte {
+	var buf bytes.Buffer
+	b := make([]byte, 4)
+	for _, d := range dirs {
+		name := d.isoName()
+		buf.WriteByte(byte(len(name)))
+		buf.WriteByte(0) // number of sectors in extended attribute record
+		bo.PutUint32(b, d.sector)
+		buf.Write(b)
+		bo.PutUint16(b, d.isoParent().number)
+		buf.Write(b[:2])
+		buf.WriteString(name)
+		if len(name)%2 == 1 {
+			buf.WriteByte(0) // padding
+		}
+	}
+	return buf.Bytes()
 }
 
-func writeData(w *ISO9660Writer, infh io.Reader, fileSize uint32, filename string) {
-	sw := w.NextSector()
-	if w.CurrentSector() != rootDirectorySectorNum {
-		Panicf("internal error: unexpected root directory sector %d", w.CurrentSector())
-	}
-
-	WriteDirectoryRecord(sw, "\x00", w.CurrentSector())
-	WriteDirectoryRecord(sw, "\x01", rootDirectorySectorNum)
-	WriteFileRecordHeader(sw, filename, w.CurrentSector()+1, fileSize)
-
-	// Now stream the data.  Note that the first buffer is never of SectorSize,
-	// since we've already filled a part of the sector.
-	b := make([]byte, SectorSize)
-	total := uint32(0)
-	for {
-		l, err := infh.Read(b)
-		if err != nil && err != io.EOF {
-			Panicf("could not read from input file: %s", err)
+// pathTableSize returns the length in bytes of the path table for dirs.
+func pathTableSize(dirs []*directoryEntry) uint32 {
+	var size uint32
+	for _, d := range dirs {
+		name := d.isoName()
+		size += 8 + uint32(len(name)+len(name)%2)
+	}
+	return size
+}
+
+func writePathTable(w *ISO9660Writer, bo binary.ByteOrder, sector uint32, dirs []*directoryEntry) error {
+	if w.CurrentSector()+1 != sector {
+		return internalErrorf("unexpected path table sector %d (expected %d)", w.CurrentSector()+1, sector)
+	}
+	writeBytes(w, pathTable(bo, dirs))
+	return nil
+}
+
+// writeBytes writes data to the sectors following the current one, padding
+// the last of them with zeros.
+func writeBytes(w *ISO9660Writer, data []byte) {
+	for len(data) > 0 {
+		n := len(data)
+		if n > int(SectorSize) {
+			n = int(SectorSize)
 		}
-		if l > 0 {
+		sw := w.NextSector()
+		sw.Write(data[:n])
+		data = data[n:]
+	}
+}
+
+func writeDirectory(w *ISO9660Writer, d *directoryEntry, o *options, t time.Time) error {
+	sw := w.NextSector()
+	if w.CurrentSector() != d.sector {
+		return internalErrorf("unexpected directory sector %d (expected %d)", w.CurrentSector(), d.sector)
+	}
+
+	_, volume := o.volumeSet()
+	for _, r := range d.records(o) {
+		if r.length() > sw.RemainingSpace() {
 			sw = w.NextSector()
-			sw.Write(b[:l])
-			total += uint32(l)
 		}
-		if err == io.EOF {
-			break
+		r.volume = volume
+		r.write(sw, t)
+	}
+
+	last := d.sector + d.size/SectorSize - 1
+	if w.CurrentSector() != last {
+		return internalErrorf("unexpected last directory sector %d (expected %d)", w.CurrentSector(), last)
+	}
+	return nil
+}
+
+// writeFileData writes the data of f, whose path in the image is path,
+// reading it from pf if it was read ahead.  If verify is set, the digest of
+// the data is recorded for verifyImage.  The data is also written to tee, if
+// it is set.
+func writeFileData(w *ISO9660Writer, f *FileEntry, path string, pf *prefetcher, p *progressReporter, verify bool, tee io.Writer) error {
+	infh, err := pf.reader(f)
+	if err != nil {
+		return &InputError{path, err}
+	}
+	defer infh.Close()
+	src := io.Reader(infh)
+	var h hash.Hash
+	if verify {
+		h = sha256.New()
+		src = io.TeeReader(infh, h)
+	}
+	if tee != nil {
+		src = io.TeeReader(src, tee)
+	}
+
+	// Copying in large chunks lets the input be read in large chunks too;
+	// the destination splits them into sectors.
+	dst := &fileDataWriter{w: w, first: f.sector + f.xarSectors(), path: path, p: p, unitSize: uint32(f.unitSize), gapSize: uint32(f.gapSize)}
+	buf := chunkPool.Get().(*[prefetchChunkSize]byte)
+	defer chunkPool.Put(buf)
+	if _, err := io.CopyBuffer(dst, src, buf[:]); err != nil && err != errWriteFailed {
+		if errors.Is(err, ErrInternal) {
+			return err
 		}
+		return &InputError{path, err}
+	} else if w.Err() != nil {
+		return nil
+	}
+	p.report(path)
+	if dst.total != f.Size {
+		return &InputError{path, fmt.Errorf("%w (expected to read %d, read %d)", ErrInputSizeChanged, f.Size, dst.total)}
 	}
-	if total != fileSize {
-		Panicf("input file size changed while the ISO file was being created (expected to read %d, read %d)", fileSize, total)
-	} else if w.CurrentSector() != numTotalSectors(fileSize)-1 {
-		Panicf("internal error: unexpected last sector number (expected %d, actual %d)",
-			numTotalSectors(fileSize)-1, w.CurrentSector())
+	if h != nil {
+		var digest [sha256.Size]byte
+		copy(digest[:], h.Sum(nil))
+		f.written = &digest
 	}
+	return nil
 }
 
-func numTotalSectors(fileSize uint32) uint32 {
-	var numDataSectors uint32
-	numDataSectors = (fileSize + (SectorSize - 1)) / SectorSize
-	return 1 + rootDirectorySectorNum + numDataSectors
+// errWriteFailed stops copying the data of a file once writing to the image
+// failed, which the ISO9660Writer reports.
+var errWriteFailed = errors.New("write failed")
+
+// fileDataWriter writes the data of a file to consecutive sectors starting
+// at first, however the writes are split, leaving gaps of gapSize blank
+// sectors after every unitSize sectors of an interleaved file.
+type fileDataWriter struct {
+	w     *ISO9660Writer
+	sw    *SectorWriter
+	first uint32
+	total int64
+	path  string
+	p     *progressReporter
+
+	unitSize, gapSize uint32
+	sectors           uint32
 }
 
-func getInputFileSizeAndName(fh *os.File) (uint32, string, error) {
+func (d *fileDataWriter) Write(b []byte) (int, error) {
+	n := 0
+	for len(b) > 0 {
+		if d.sw == nil || d.sw.RemainingSpace() == 0 {
+			if d.sw != nil && d.unitSize != 0 && d.sectors%d.unitSize == 0 {
+				for i := uint32(0); i < d.gapSize; i++ {
+					d.w.NextSector().PadWithZeros()
+				}
+			}
+			d.sw = d.w.NextSector()
+			d.sectors++
+			if d.w.Err() != nil {
+				return n, errWriteFailed
+			}
+			if d.total == 0 && d.w.CurrentSector() != d.first {
+				return n, internalErrorf("unexpected first sector %d for file %s (expected %d)", d.w.CurrentSector(), d.path, d.first)
+			}
+		}
+		chunk := b
+		if uint32(len(chunk)) > d.sw.RemainingSpace() {
+			chunk = chunk[:d.sw.RemainingSpace()]
+		}
+		l := int(d.sw.Write(chunk))
+		if d.w.Err() != nil {
+			return n, errWriteFailed
+		}
+		n += l
+		d.total += int64(l)
+		b = b[l:]
+		if d.sw.RemainingSpace() == 0 && d.sectors%progressInterval == 0 {
+			d.p.report(d.path)
+		}
+	}
+	return n, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func getInputFileSizeAndName(fh fs.File) (int64, string, error) {
 	fi, err := fh.Stat()
 	if err != nil {
 		return 0, "", err
 	}
-	if fi.Size() >= math.MaxUint32 {
-		return 0, "", fmt.Errorf("file size %d is too large", fi.Size())
-	}
-	return uint32(fi.Size()), fi.Name(), nil
-}
-
-func filenameSatisfiesISOConstraints(filename string) bool {
-	invalidCharacter := func(r rune) bool {
-		// According to ISO9660, only capital letters, digits, and underscores
-		// are permitted.  Some sources say a dot is allowed as well.  I'm too
-		// lazy to figure it out right now.
-		if r >= 'A' && r <= 'Z' {
-			return false
-		} else if r >= '0' && r <= '9' {
-			return false
-		} else if r == '_' {
-			return false
-		} else if r == '.' {
-			return false
-		}
-		return true
-	}
-	return strings.IndexFunc(filename, invalidCharacter) == -1
+	return fi.Size(), fi.Name(), nil
 }
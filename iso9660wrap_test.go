@@ -0,0 +1,142 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// benchmarkFileSize is large enough that copying file data dominates the
+// time spent laying out and writing the descriptors.
+const benchmarkFileSize = 64 << 20
+
+func BenchmarkWriteFile(b *testing.B) {
+	dir := b.TempDir()
+	in := filepath.Join(dir, "input.bin")
+	if err := ioutil.WriteFile(in, bytes.Repeat([]byte("iso9660wrap"), benchmarkFileSize/11), 0644); err != nil {
+		b.Fatal(err)
+	}
+	infh, err := os.Open(in)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer infh.Close()
+	info, err := infh.Stat()
+	if err != nil {
+		b.Fatal(err)
+	}
+	outfh, err := os.Create(filepath.Join(dir, "output.iso"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer outfh.Close()
+
+	b.SetBytes(info.Size())
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := infh.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := outfh.Seek(0, io.SeekStart); err != nil {
+			b.Fatal(err)
+		}
+		if err := WriteFile(outfh, infh); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkImageWriter(b *testing.B) {
+	b.SetBytes(benchmarkFileSize)
+	for i := 0; i < b.N; i++ {
+		iw := NewImageWriter()
+		// a reader without ReadAt, which is read once as it is copied
+		r := io.LimitReader(zeroReader{}, benchmarkFileSize)
+		if err := iw.AddReader("DATA.BIN", benchmarkFileSize, r); err != nil {
+			b.Fatal(err)
+		}
+		if err := iw.Finalize(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestHardLinks(t *testing.T) {
+	src := t.TempDir()
+	if err := os.Mkdir(filepath.Join(src, "SUB"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, data string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(src, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(name, target string) {
+		t.Helper()
+		if err := os.Link(filepath.Join(src, target), filepath.Join(src, filepath.FromSlash(name))); err != nil {
+			t.Skipf("can't create hard links: %v", err)
+		}
+	}
+	data := strings.Repeat("linked", 2000)
+	write("A.BIN", data)
+	link("B.BIN", "A.BIN")
+	link("SUB/D.BIN", "A.BIN")
+	write("C.BIN", data)
+	write("BOOT.BIN", strings.Repeat("boot", 1000))
+	link("BOOTLINK.BIN", "BOOT.BIN")
+	if fi, err := os.Stat(filepath.Join(src, "A.BIN")); err != nil || sourceFileID(fi) == nil {
+		t.Skip("hard links are not detected on this system")
+	}
+
+	iw := NewImageWriter()
+	if err := iw.AddTree(src, "/"); err != nil {
+		t.Fatal(err)
+	}
+	// a boot image that gets a boot info table is written on its own
+	if err := iw.AddBootImage("BOOT.BIN", LoadSize(4), BootInfoTable()); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, iw)
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lba := map[string]uint32{}
+	for _, path := range []string{"A.BIN", "B.BIN", "SUB/D.BIN", "C.BIN", "BOOT.BIN", "BOOTLINK.BIN"} {
+		info, err := ir.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lba[path] = info.LBA
+	}
+	if lba["A.BIN"] != lba["B.BIN"] || lba["A.BIN"] != lba["SUB/D.BIN"] {
+		t.Errorf("hard links are at sectors %d, %d and %d, want a single extent", lba["A.BIN"], lba["B.BIN"], lba["SUB/D.BIN"])
+	}
+	if lba["C.BIN"] == lba["A.BIN"] || lba["BOOT.BIN"] == lba["BOOTLINK.BIN"] {
+		t.Errorf("a copy or a boot image shares the data of another file: %v", lba)
+	}
+	tree := readTree(t, ir)
+	for _, path := range []string{"A.BIN", "B.BIN", "SUB/D.BIN", "C.BIN"} {
+		if tree[path] != data {
+			t.Errorf("%s holds %d bytes", path, len(tree[path]))
+		}
+	}
+	if tree["BOOTLINK.BIN"] != strings.Repeat("boot", 1000) {
+		t.Error("the boot info table of BOOT.BIN was written to BOOTLINK.BIN")
+	}
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), tree)
+}
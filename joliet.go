@@ -0,0 +1,145 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxJolietNameLength is the number of UCS-2 characters a Joliet identifier
+// holds, not counting the version of a file.
+const maxJolietNameLength = 64
+
+// jolietForbidden are the characters Joliet doesn't permit in identifiers
+// besides the control characters.
+const jolietForbidden = "*/:;?\\"
+
+// WithJoliet adds a Joliet supplementary volume, as mkisofs -J does, which
+// records names as they were added in UCS-2 for Windows and most other
+// systems.  Names are normalized to NFC, so that the decomposed names of
+// macOS file systems read the same as those typed on other systems.  Names
+// with characters beyond the Basic Multilingual Plane, such as emoji, are an
+// error, since UCS-2 has no room for them and readers differ on surrogate
+// pairs.  The characters Joliet forbids, such as '*', ':' and '?', become
+// underscores, and names longer than 64 characters are shortened, keeping
+// the extension of a file.
+func WithJoliet() Option {
+	return WithSupplementaryVolume(SupplementaryVolume{
+		EscapeSequences: "%/E", // UCS-2 level 3
+		EncodeName:      jolietName,
+		EncodeID:        jolietID,
+	})
+}
+
+// jolietName returns the Joliet identifier of an entry added under name.
+func jolietName(name string, dir bool) (string, error) {
+	if !utf8.ValidString(name) {
+		return "", fmt.Errorf("name %q is not valid UTF-8", name)
+	}
+	for _, r := range name {
+		if r > 0xFFFF {
+			return "", fmt.Errorf("name %q has the character %U, which UCS-2 can't record", name, r)
+		}
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(jolietForbidden, r) {
+			return '_'
+		}
+		return r
+	}, composeNFC(name))
+
+	u := utf16.Encode([]rune(name))
+	if len(u) > maxJolietNameLength {
+		var ext []uint16
+		if i := strings.LastIndexByte(name, '.'); !dir && i > 0 {
+			ext = utf16.Encode([]rune(name[i:]))
+		}
+		if len(ext) > maxJolietNameLength/2 {
+			ext = nil
+		}
+		base := u[:maxJolietNameLength-len(ext)]
+		u = append(append([]uint16(nil), base...), ext...)
+	}
+	if !dir {
+		u = append(u, ';', '1')
+	}
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.BigEndian.PutUint16(b[2*i:], c)
+	}
+	return string(b), nil
+}
+
+// jolietID returns the length bytes of a descriptor field holding id in
+// UCS-2, padded with spaces.  Characters UCS-2 can't record become
+// underscores.
+func jolietID(id string, length int) []byte {
+	b := make([]byte, length)
+	u := utf16.Encode([]rune(strings.Map(func(r rune) rune {
+		if r > 0xFFFF {
+			return '_'
+		}
+		return r
+	}, id)))
+	for i := 0; 2*i+1 < length; i++ {
+		c := uint16(' ')
+		if i < len(u) {
+			c = u[i]
+		}
+		binary.BigEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// Hangul syllables are composed from their jamo arithmetically, as Unicode
+// specifies.
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// composeNFC composes the characters of s followed by combining characters,
+// such as the "e" and U+0301 of macOS file names, into the precomposed
+// characters NFC prescribes.  Combining characters are expected in
+// canonical order, as decomposed names have them; a combining character
+// that doesn't compose blocks those after it.
+func composeNFC(s string) string {
+	out := make([]rune, 0, len(s))
+	starter, blocked := -1, false
+	for _, r := range s {
+		if starter >= 0 && !blocked {
+			last := out[starter]
+			if c, ok := compositions[[2]rune{last, r}]; ok {
+				out[starter] = c
+				continue
+			}
+			if starter == len(out)-1 {
+				if l := last - hangulLBase; l >= 0 && l < hangulLCount && r >= hangulVBase && r < hangulVBase+hangulVCount {
+					out[starter] = hangulSBase + (l*hangulVCount+r-hangulVBase)*hangulTCount
+					continue
+				}
+				if sIndex := last - hangulSBase; sIndex >= 0 && sIndex < hangulSCount && sIndex%hangulTCount == 0 && r > hangulTBase && r < hangulTBase+hangulTCount {
+					out[starter] = last + r - hangulTBase
+					continue
+				}
+			}
+		}
+		out = append(out, r)
+		if unicode.In(r, unicode.Mn, unicode.Mc) {
+			blocked = true
+		} else {
+			starter, blocked = len(out)-1, false
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,99 @@
+package iso9660wrap
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestJolietName(t *testing.T) {
+	cjk := strings.Repeat("漢", 64)
+	for _, tc := range []struct {
+		desc string
+		name string
+		dir  bool
+		want string // decoded, without the version
+		err  string
+	}{
+		{desc: "ascii", name: "README.txt", want: "README.txt"},
+		{desc: "nfd acute", name: "Cafe\u0301.txt", want: "Café.txt"},
+		{desc: "nfd ring", name: "A\u030angstro\u0308m", dir: true, want: "Ångström"},
+		{desc: "nfd two marks", name: "a\u0323\u0302", want: "ậ"},
+		{desc: "nfd kana", name: "か\u3099ヒ\u309a.txt", want: "がピ.txt"},
+		{desc: "hangul jamo", name: "\u1112\u1161\u11ab\u1100\u1173\u11af", want: "한글"},
+		{desc: "nfc unchanged", name: "été", want: "été"},
+		{desc: "cjk at limit", name: cjk, want: cjk},
+		{desc: "cjk dir at limit", name: cjk, dir: true, want: cjk},
+		{desc: "cjk over limit", name: cjk + "字", want: cjk},
+		{desc: "cjk over limit keeps extension", name: cjk + ".txt", want: cjk[:len("漢")*60] + ".txt"},
+		{desc: "cjk dir over limit", name: cjk + ".d", dir: true, want: cjk},
+		{desc: "nfd at limit once composed", name: strings.Repeat("e\u0301", 64), want: strings.Repeat("é", 64)},
+		{desc: "forbidden", name: `a*b:c?d;e\f.txt`, want: "a_b_c_d_e_f.txt"},
+		{desc: "forbidden slash", name: "a/b", dir: true, want: "a_b"},
+		{desc: "control", name: "tab\there\x7f", want: "tab_here\x7f"},
+		{desc: "emoji", name: "smile\U0001F600.txt", err: "U+1F600"},
+		{desc: "cjk extension b", name: "\U0002000B", dir: true, err: "U+2000B"},
+		{desc: "surrogate", name: "\xed\xa0\x80.txt", err: "not valid UTF-8"},
+		{desc: "low surrogate", name: "a\xed\xbf\xbf", err: "not valid UTF-8"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			id, err := jolietName(tc.name, tc.dir)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("jolietName(%q) = %q, %v, want an error containing %q", tc.name, decodeJoliet(id, tc.dir), err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(id) > 2*(maxJolietNameLength+2) {
+				t.Errorf("identifier is %d bytes long", len(id))
+			}
+			if !tc.dir && !strings.HasSuffix(id, "\x00;\x001") {
+				t.Errorf("identifier %q has no version", id)
+			}
+			if got := decodeJoliet(id, tc.dir); got != tc.want {
+				t.Errorf("jolietName(%q) = %q, want %q", tc.name, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestJolietRoundTrip(t *testing.T) {
+	cjk := strings.Repeat("文", 70)
+	iw := NewImageWriter(WithJoliet(), WithNameMangling())
+	for name, data := range map[string]string{
+		"Cafe\u0301.txt": "café",
+		"日本語/readme.md":  "日本語",
+		cjk + ".txt":     "long",
+		"what?.txt":      "forbidden",
+	} {
+		if err := iw.AddBytes(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	img := writeImage(t, iw)
+
+	want := map[string]string{
+		"Café.txt":                 "café",
+		"what_.txt":                "forbidden",
+		"日本語/":                     "",
+		"日本語/readme.md":            "日本語",
+		cjk[:len("文")*60] + ".txt": "long",
+	}
+	ir, err := ReadImage(img, UseNames(JolietNames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTrees(t, "ReadImage", readTree(t, ir), want)
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), want)
+
+	iw = NewImageWriter(WithJoliet(), WithNameMangling())
+	if err := iw.AddBytes("smile\U0001F600.txt", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.Finalize(ioutil.Discard); err == nil || !strings.Contains(err.Error(), "U+1F600") {
+		t.Errorf("writing a name beyond the Basic Multilingual Plane returned %v", err)
+	}
+}
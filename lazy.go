@@ -0,0 +1,201 @@
+package iso9660wrap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// ReaderAt returns an io.ReaderAt over the bytes WriteTo writes, which reads
+// the data of files from their sources when it is asked for, so that parts
+// of the image can be served, say to an HTTP client or a hypervisor, without
+// the image being written anywhere.  The volume descriptors, path tables
+// and directories are laid out up front and held in memory, as are the boot
+// images that get a boot info table.  Each read opens the sources it needs,
+// and sources that can't seek are read from their start.  Reads may be made
+// concurrently.
+func (im *Image) ReaderAt() (io.ReaderAt, error) {
+	return im.iw.lazyImage()
+}
+
+// lazyImage is an image whose file data is read from the sources of its
+// files on demand.  Offsets are counted from the start of the session.
+type lazyImage struct {
+	size int64
+	// sectors holds the sectors of everything but the data read on
+	// demand, leaving out sectors of zeros
+	sectors map[uint32][]byte
+	// files holds the extents read on demand, in ascending order
+	files []lazyFile
+}
+
+// lazyFile is size bytes of the data of f from offset off on, at offset
+// start of the image.
+type lazyFile struct {
+	f     *FileEntry
+	path  string
+	start int64
+	off   int64
+	size  int64
+}
+
+// lazyImage lays out the image and records everything but the data read
+// from the sources of files.
+func (iw *ImageWriter) lazyImage() (*lazyImage, error) {
+	err := iw.options.validate()
+	if err != nil {
+		return nil, err
+	}
+	now, err := iw.options.recordingTime()
+	if err != nil {
+		return nil, err
+	}
+	l, err := iw.layout()
+	if err != nil {
+		return nil, err
+	}
+	area, err := iw.systemArea(l, now)
+	if err != nil {
+		return nil, err
+	}
+	lz := &lazyImage{
+		size:    int64(l.numSectors-l.sessionStart) * int64(SectorSize),
+		sectors: map[uint32][]byte{},
+	}
+	rec := &sectorRecorder{lz: lz}
+	rec.Write(area)
+	bufw := bufio.NewWriterSize(rec, outputBufferSize)
+	w := NewISO9660Writer(bufw)
+	w.sectorNum += l.sessionStart
+
+	iw.lazy = lz
+	defer func() { iw.lazy = nil }()
+	err = iw.write(w, l, now)
+	if werr := w.Err(); werr != nil {
+		return nil, werr
+	} else if err != nil {
+		return nil, err
+	}
+	bufw.Flush()
+	return lz, nil
+}
+
+// skip records the data of f, whose path in the image is path, as read on
+// demand, and leaves its sectors blank.
+func (lz *lazyImage) skip(w *ISO9660Writer, f *FileEntry, path string, l *imageLayout) {
+	start := int64(f.sector+f.xarSectors()-l.sessionStart) * int64(SectorSize)
+	if f.unitSize == 0 {
+		if f.Size > 0 {
+			lz.files = append(lz.files, lazyFile{f: f, path: path, start: start, size: f.Size})
+		}
+	} else {
+		// the file units of an interleaved file, which fits in an extent,
+		// are read separately
+		off := int64(0)
+		for _, e := range interleavedExtents(0, uint32(f.Size), uint32(f.unitSize), uint32(f.gapSize)) {
+			if e.size > 0 {
+				lz.files = append(lz.files, lazyFile{f: f, path: path, start: start + int64(e.sector)*int64(SectorSize), off: off, size: int64(e.size)})
+				off += int64(e.size)
+			}
+		}
+	}
+	for i := f.dataSectors(); i > 0; i-- {
+		w.NextSector().PadWithZeros()
+	}
+}
+
+func (lz *lazyImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("read at negative offset %d", off)
+	}
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= lz.size {
+			return n, io.EOF
+		}
+		b := p[n:]
+		i := sort.Search(len(lz.files), func(i int) bool {
+			return lz.files[i].start+lz.files[i].size > pos
+		})
+		if i < len(lz.files) && lz.files[i].start <= pos {
+			lf := &lz.files[i]
+			if left := lf.start + lf.size - pos; int64(len(b)) > left {
+				b = b[:left]
+			}
+			if err := lf.readAt(b, lf.off+pos-lf.start); err != nil {
+				return n, err
+			}
+		} else {
+			// files start on sector boundaries, so the rest of the sector
+			// is not read on demand
+			sector, within := uint32(pos/int64(SectorSize)), pos%int64(SectorSize)
+			if left := int64(SectorSize) - within; int64(len(b)) > left {
+				b = b[:left]
+			}
+			if data, ok := lz.sectors[sector]; ok {
+				copy(b, data[within:])
+			} else {
+				copy(b, zeroSector[:len(b)])
+			}
+		}
+		n += len(b)
+	}
+	return n, nil
+}
+
+// readAt reads the data of the file from offset off into b.
+func (lf *lazyFile) readAt(b []byte, off int64) error {
+	r, err := lf.f.reader()
+	if err != nil {
+		return &InputError{lf.path, err}
+	}
+	defer r.Close()
+	if ra, ok := r.(io.ReaderAt); ok {
+		_, err = ra.ReadAt(b, off)
+	} else {
+		if s, ok := r.(io.Seeker); ok {
+			_, err = s.Seek(off, io.SeekStart)
+		} else {
+			_, err = io.CopyN(ioutil.Discard, r, off)
+		}
+		if err == nil {
+			_, err = io.ReadFull(r, b)
+		}
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("%w (expected %d bytes)", ErrInputSizeChanged, lf.f.Size)
+	}
+	if err != nil {
+		return &InputError{lf.path, err}
+	}
+	return nil
+}
+
+// sectorRecorder records the sectors written to it in a lazyImage.
+type sectorRecorder struct {
+	lz  *lazyImage
+	cur [SectorSize]byte
+	// n is the number of bytes of the sector being written
+	n      int
+	sector uint32
+}
+
+func (r *sectorRecorder) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		c := copy(r.cur[r.n:], p)
+		r.n += c
+		p = p[c:]
+		if r.n == len(r.cur) {
+			if r.cur != zeroSector {
+				r.lz.sectors[r.sector] = append([]byte(nil), r.cur[:]...)
+			}
+			r.sector++
+			r.n = 0
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,129 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// lazyTestImage returns an ImageWriter whose files come from each kind of
+// source Image.ReaderAt reads on demand.
+func lazyTestImage(t *testing.T) *ImageWriter {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "disk.txt")
+	if err := ioutil.WriteFile(src, bytes.Repeat([]byte("from disk\n"), 500), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the image is built once for each request, with the same timestamps
+	iw := NewImageWriter(WithRockRidge(), WithJoliet(), WithTimestamp(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))
+	if err := iw.AddFileAs(src, "DISK/DISK.TXT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("BOOT/LOADER.BIN", bytes.Repeat([]byte("loader"), 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBootImage("BOOT/LOADER.BIN", LoadSize(4), BootInfoTable()); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddReader("READER.BIN", 10000, bytes.NewReader(bytes.Repeat([]byte{0xA5}, 10000))); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("UNITS.BIN", bytes.Repeat([]byte("0123456789abcdef"), 1000), Interleave(2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("EMPTY.TXT", nil); err != nil {
+		t.Fatal(err)
+	}
+	return iw
+}
+
+func TestReaderAt(t *testing.T) {
+	iw := lazyTestImage(t)
+	im, err := iw.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, err := im.ReaderAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	if n, err := im.WriteTo(&want); err != nil {
+		t.Fatal(err)
+	} else if n != im.Size() || int64(want.Len()) != im.Size() {
+		t.Fatalf("WriteTo wrote %d bytes, want %d", n, im.Size())
+	}
+
+	got := make([]byte, im.Size())
+	if n, err := ra.ReadAt(got, 0); err != nil || n != len(got) {
+		t.Fatalf("ReadAt of the whole image read %d bytes: %v", n, err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Fatal("ReadAt doesn't read what WriteTo writes")
+	}
+	// reads of an odd size start and end within files and sectors
+	for off := int64(0); off < im.Size(); off += 3001 {
+		b := make([]byte, 3001)
+		n, err := ra.ReadAt(b, off)
+		if end := off + int64(n); end == im.Size() && err != io.EOF || end < im.Size() && err != nil {
+			t.Fatalf("ReadAt at %d read %d bytes: %v", off, n, err)
+		}
+		if !bytes.Equal(b[:n], want.Bytes()[off:off+int64(n)]) {
+			t.Fatalf("ReadAt at %d doesn't read what WriteTo writes", off)
+		}
+	}
+	if n, err := ra.ReadAt(make([]byte, 1), im.Size()); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt at the end read %d bytes: %v", n, err)
+	}
+	if _, err := ra.ReadAt(make([]byte, 1), -1); err == nil {
+		t.Error("ReadAt at a negative offset succeeded")
+	}
+
+	checkValid(t, ra)
+	ir, err := NewReader(ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTrees(t, "ReaderAt", readTree(t, ir), readTree(t, mustReadImage(t, want.Bytes())))
+}
+
+func TestReaderAtInputSizeChanged(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "file.txt")
+	if err := ioutil.WriteFile(src, bytes.Repeat([]byte("x"), 5000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	iw := NewImageWriter()
+	if err := iw.AddFile(src); err != nil {
+		t.Fatal(err)
+	}
+	im, err := iw.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, err := im.ReaderAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(src, 100); err != nil {
+		t.Fatal(err)
+	}
+	var ie *InputError
+	if _, err := ra.ReadAt(make([]byte, im.Size()), 0); !errors.As(err, &ie) || !errors.Is(err, ErrInputSizeChanged) {
+		t.Errorf("ReadAt of a truncated file returned %v, want an InputError for ErrInputSizeChanged", err)
+	}
+}
+
+// mustReadImage returns the Reader of the image img.
+func mustReadImage(t *testing.T, img []byte) *Reader {
+	t.Helper()
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ir
+}
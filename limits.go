@@ -0,0 +1,37 @@
+package iso9660wrap
+
+// Readers guard against hostile images, such as uploads a service inspects,
+// by checking every extent against the volume space, which must lie within
+// the image, by refusing directories recorded more than once, which would
+// make a walk loop, and by the limits below.
+
+const (
+	// defaultMaxReadDepth is far deeper than ISO9660 permits, leaving room
+	// for directories relocated with Rock Ridge.
+	defaultMaxReadDepth = 64
+	// defaultMemoryLimit bounds the directory data a Reader holds at once.
+	defaultMemoryLimit = 64 << 20
+	// maxBootCatalogSize bounds the boot catalog a Reader reads, which is
+	// a single sector in images this package writes and rarely more.
+	maxBootCatalogSize = 16 * int64(SectorSize)
+)
+
+// MaxDepth limits the number of levels of directories a Reader descends to,
+// counting the root directory as the first, to depth.  The default is 64.
+// Walk fails with ErrLimitExceeded at directories nested deeper.
+func MaxDepth(depth int) ReaderOption {
+	return func(o *readerOptions) {
+		o.maxDepth = depth
+	}
+}
+
+// MemoryLimit limits the size of the directories a Reader holds the
+// entries of at a time to limit bytes, which is the size of the directories
+// from the root directory to the one being read.  The memory a Reader uses
+// grows in proportion to it.  The default is 64 MiB.  Reading a directory
+// beyond the limit fails with ErrLimitExceeded.
+func MemoryLimit(limit int64) ReaderOption {
+	return func(o *readerOptions) {
+		o.memoryLimit = limit
+	}
+}
@@ -0,0 +1,283 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// Manifest declares an image: its volume metadata, naming and extension
+// settings, boot images and file tree.  It is read from JSON or YAML with
+// ReadManifest, for example
+//
+//	{
+//		"volumeID": "INSTALLER",
+//		"rockRidge": true,
+//		"files": [
+//			{"source": "build/rootfs", "path": "/"},
+//			{"source": "isolinux.bin", "path": "isolinux/isolinux.bin"},
+//			{"path": "empty"}
+//		],
+//		"boot": [
+//			{"path": "isolinux/isolinux.bin", "loadSize": 4, "bootInfoTable": true}
+//		]
+//	}
+//
+// or the same in YAML:
+//
+//	volumeID: INSTALLER
+//	rockRidge: true
+//	files:
+//	  - {source: build/rootfs, path: /}
+//	  - source: isolinux.bin
+//	    path: isolinux/isolinux.bin
+//	  - path: empty
+//	boot:
+//	  - path: isolinux/isolinux.bin
+//	    loadSize: 4
+//	    bootInfoTable: true
+type Manifest struct {
+	SystemID        string `json:"systemID,omitempty"`
+	VolumeID        string `json:"volumeID,omitempty"`
+	VolumeSetID     string `json:"volumeSetID,omitempty"`
+	PublisherID     string `json:"publisherID,omitempty"`
+	DataPreparerID  string `json:"dataPreparerID,omitempty"`
+	ApplicationID   string `json:"applicationID,omitempty"`
+	CopyrightFileID string `json:"copyrightFileID,omitempty"`
+
+	AbstractFileID      string `json:"abstractFileID,omitempty"`
+	BibliographicFileID string `json:"bibliographicFileID,omitempty"`
+
+	// Timestamp, in RFC 3339 format, is passed to WithTimestamp.
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+
+	InterchangeLevel int  `json:"interchangeLevel,omitempty"`
+	RelaxedNames     bool `json:"relaxedNames,omitempty"`
+	PreserveCase     bool `json:"preserveCase,omitempty"`
+	FileVersions     bool `json:"fileVersions,omitempty"`
+	NameMangling     bool `json:"nameMangling,omitempty"`
+	TransTable       bool `json:"transTable,omitempty"`
+	RockRidge        bool `json:"rockRidge,omitempty"`
+	Joliet           bool `json:"joliet,omitempty"`
+	Deduplication    bool `json:"deduplication,omitempty"`
+
+	// Exclude and IncludeOnly filter the directories of Files, as
+	// WithExclude and WithIncludeOnly do.
+	Exclude     []string `json:"exclude,omitempty"`
+	IncludeOnly []string `json:"includeOnly,omitempty"`
+
+	Files []ManifestFile `json:"files"`
+	Boot  []ManifestBoot `json:"boot,omitempty"`
+}
+
+// ManifestFile is an entry of the file tree of a Manifest.
+type ManifestFile struct {
+	// Source is the local file or directory to add, relative to the
+	// directory of the manifest.  The contents of a directory are added
+	// below Path.  Without a source, Path is created as an empty
+	// directory.
+	Source string `json:"source,omitempty"`
+	// Path is the path in the image.
+	Path string `json:"path"`
+
+	Hidden     bool       `json:"hidden,omitempty"`
+	Associated bool       `json:"associated,omitempty"`
+	ModTime    *time.Time `json:"modTime,omitempty"`
+	// Describes is "copyright", "abstract" or "bibliographic" for a file
+	// the volume descriptors refer to, as CopyrightFile and its siblings
+	// mark it.
+	Describes string `json:"describes,omitempty"`
+}
+
+// ManifestBoot is a boot image of a Manifest, as added with AddBootImage.
+type ManifestBoot struct {
+	// Path is the path of the boot image in the image.
+	Path string `json:"path"`
+	// Platform is "bios", the default, "efi", "powerpc" or "mac".
+	Platform string `json:"platform,omitempty"`
+	// Emulation is "none", the default, "floppy1200", "floppy1440",
+	// "floppy2880" or "harddisk".
+	Emulation     string `json:"emulation,omitempty"`
+	LoadSegment   uint16 `json:"loadSegment,omitempty"`
+	LoadSize      uint16 `json:"loadSize,omitempty"`
+	BootInfoTable bool   `json:"bootInfoTable,omitempty"`
+}
+
+var manifestPlatforms = map[string]BootPlatform{
+	"":        PlatformBIOS,
+	"bios":    PlatformBIOS,
+	"efi":     PlatformEFI,
+	"powerpc": PlatformPowerPC,
+	"mac":     PlatformMac,
+}
+
+var manifestEmulations = map[string]BootMedia{
+	"":           NoEmulation,
+	"none":       NoEmulation,
+	"floppy1200": Floppy1200,
+	"floppy1440": Floppy1440,
+	"floppy2880": Floppy2880,
+	"harddisk":   HardDisk,
+}
+
+var manifestDescribes = map[string]func() FileOption{
+	"copyright":     CopyrightFile,
+	"abstract":      AbstractFile,
+	"bibliographic": BibliographicFile,
+}
+
+// ReadManifest reads a Manifest in JSON or YAML from r.  Manifests starting
+// with a brace are read as JSON.  YAML manifests may use block and
+// single-line flow collections, plain and quoted scalars and comments, but
+// not anchors, tags or multi-line scalars; strings that YAML would read as
+// numbers or booleans, such as a volume ID of 2024, need quotes.  Unknown
+// fields are rejected, so that misspelt settings don't go unnoticed.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	isYAML := false
+	if t := bytes.TrimLeft(b, " \t\r\n"); len(t) == 0 || t[0] != '{' {
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, fmt.Errorf("invalid manifest: %w", err)
+		}
+		isYAML = true
+	}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	m := &Manifest{}
+	if err := d.Decode(m); err != nil {
+		var te *json.UnmarshalTypeError
+		if isYAML && errors.As(err, &te) && te.Type.Kind() == reflect.String {
+			return nil, fmt.Errorf("invalid manifest: %w; quote the value of %s to make it a string", err, te.Field)
+		}
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return m, nil
+}
+
+// Options returns the options the manifest declares.
+func (m *Manifest) Options() []Option {
+	opts := []Option{
+		WithSystemID(m.SystemID),
+		WithVolumeID(m.VolumeID),
+		WithVolumeSetID(m.VolumeSetID),
+		WithPublisherID(m.PublisherID),
+		WithDataPreparerID(m.DataPreparerID),
+		WithApplicationID(m.ApplicationID),
+		WithCopyrightFileID(m.CopyrightFileID),
+		WithAbstractFileID(m.AbstractFileID),
+		WithBibliographicFileID(m.BibliographicFileID),
+		WithInterchangeLevel(m.InterchangeLevel),
+	}
+	if m.Timestamp != nil {
+		opts = append(opts, WithTimestamp(*m.Timestamp))
+	}
+	if len(m.Exclude) > 0 {
+		opts = append(opts, WithExclude(m.Exclude...))
+	}
+	if len(m.IncludeOnly) > 0 {
+		opts = append(opts, WithIncludeOnly(m.IncludeOnly...))
+	}
+	flags := []struct {
+		set bool
+		opt func() Option
+	}{
+		{m.RelaxedNames, WithRelaxedNames},
+		{m.PreserveCase, WithPreserveCase},
+		{m.FileVersions, WithFileVersions},
+		{m.NameMangling, WithNameMangling},
+		{m.TransTable, WithTransTable},
+		{m.RockRidge, WithRockRidge},
+		{m.Joliet, WithJoliet},
+		{m.Deduplication, WithDeduplication},
+	}
+	for _, f := range flags {
+		if f.set {
+			opts = append(opts, f.opt())
+		}
+	}
+	return opts
+}
+
+// ImageWriter returns an ImageWriter for the image the manifest declares,
+// resolving relative sources against dir.  opts apply on top of the options
+// of the manifest.
+func (m *Manifest) ImageWriter(dir string, opts ...Option) (*ImageWriter, error) {
+	iw := NewImageWriter(append(m.Options(), opts...)...)
+	for _, f := range m.Files {
+		if err := iw.addManifestFile(dir, f); err != nil {
+			return nil, err
+		}
+	}
+	for _, b := range m.Boot {
+		platform, ok := manifestPlatforms[b.Platform]
+		if !ok {
+			return nil, fmt.Errorf("boot image %s: unknown platform %q", b.Path, b.Platform)
+		}
+		media, ok := manifestEmulations[b.Emulation]
+		if !ok {
+			return nil, fmt.Errorf("boot image %s: unknown emulation %q", b.Path, b.Emulation)
+		}
+		bootOpts := []BootOption{Platform(platform), Emulate(media)}
+		if b.LoadSegment != 0 {
+			bootOpts = append(bootOpts, LoadSegment(b.LoadSegment))
+		}
+		if b.LoadSize != 0 {
+			bootOpts = append(bootOpts, LoadSize(b.LoadSize))
+		}
+		if b.BootInfoTable {
+			bootOpts = append(bootOpts, BootInfoTable())
+		}
+		if err := iw.AddBootImage(b.Path, bootOpts...); err != nil {
+			return nil, err
+		}
+	}
+	return iw, nil
+}
+
+func (iw *ImageWriter) addManifestFile(dir string, f ManifestFile) error {
+	if f.Source == "" {
+		return iw.AddDir(f.Path)
+	}
+	source := f.Source
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(dir, source)
+	}
+	fi, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		if f.Hidden || f.Associated || f.ModTime != nil || f.Describes != "" {
+			return fmt.Errorf("manifest entry %s: file flags and times can't be set on directory %s", f.Path, f.Source)
+		}
+		return iw.AddTree(source, f.Path)
+	}
+	var opts []FileOption
+	if f.Hidden {
+		opts = append(opts, Hidden())
+	}
+	if f.Associated {
+		opts = append(opts, Associated())
+	}
+	if f.ModTime != nil {
+		opts = append(opts, ModTime(*f.ModTime))
+	}
+	if f.Describes != "" {
+		opt, ok := manifestDescribes[f.Describes]
+		if !ok {
+			return fmt.Errorf("manifest entry %s: describes %q is not copyright, abstract or bibliographic", f.Path, f.Describes)
+		}
+		opts = append(opts, opt())
+	}
+	return iw.AddFileAs(source, f.Path, opts...)
+}
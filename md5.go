@@ -0,0 +1,198 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The layout of the checksum implanted by implantisomd5 from the isomd5sum
+// package, which Fedora and RHEL installers check with checkisomd5.
+const (
+	md5AppDataOffset   = 883 // application use area of the PVD
+	md5AppDataSize     = 512
+	md5SkipSectors     = 15
+	md5FragmentCount   = 20
+	md5FragmentSumSize = 60
+	md5BufferSize      = 16 * 2048
+)
+
+// ImplantMD5 embeds an MD5 checksum of the image in f into the application
+// use area of its primary volume descriptor, in the format written by
+// implantisomd5, so that installers can check the media with checkisomd5 or
+// VerifyMD5.  supported sets the RHLISOSTATUS flag that marks the media as
+// supported.  f is typically the *os.File the image was just written to.
+func ImplantMD5(f interface {
+	io.ReaderAt
+	io.WriterAt
+}, supported bool) error {
+	pvd, size, err := readPVDInfo(f)
+	if err != nil {
+		return err
+	}
+	sum, fragments, err := md5Sums(f, pvd, size-md5SkipSectors*int64(SectorSize), md5FragmentCount)
+	if err != nil {
+		return err
+	}
+	for i, c := range fragments {
+		if c == 0 {
+			// fragments shorter than the read buffer are never summed
+			fragments[i] = '0'
+		}
+	}
+	status := 0
+	if supported {
+		status = 1
+	}
+	appData := fmt.Sprintf("ISO MD5SUM = %x;SKIPSECTORS = %d;RHLISOSTATUS=%d;FRAGMENT SUMS = %s;FRAGMENT COUNT = %d;THIS IS NOT THE SAME AS RUNNING MD5SUM ON THIS ISO!!",
+		sum, md5SkipSectors, status, fragments, md5FragmentCount)
+	appData += strings.Repeat(" ", md5AppDataSize-len(appData))
+	_, err = f.WriteAt([]byte(appData), pvd+md5AppDataOffset)
+	return err
+}
+
+// VerifyMD5 checks the image in r against the checksum embedded with
+// ImplantMD5 or implantisomd5, as checkisomd5 does.  It returns an error
+// wrapping ErrChecksumMismatch if the image doesn't match, and ErrNoChecksum
+// if no checksum is embedded.
+func VerifyMD5(r io.ReaderAt) error {
+	pvd, size, err := readPVDInfo(r)
+	if err != nil {
+		return err
+	}
+	appData := make([]byte, md5AppDataSize)
+	if _, err := r.ReadAt(appData, pvd+md5AppDataOffset); err != nil {
+		return err
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Split(string(appData), ";") {
+		if i := strings.IndexByte(field, '='); i >= 0 {
+			fields[strings.TrimSpace(field[:i])] = strings.TrimSpace(field[i+1:])
+		}
+	}
+	want, err := hex.DecodeString(fields["ISO MD5SUM"])
+	if err != nil || len(want) != md5.Size {
+		return ErrNoChecksum
+	}
+	skip, err := strconv.ParseInt(fields["SKIPSECTORS"], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid SKIPSECTORS in implanted MD5 checksum: %w", err)
+	}
+	wantFragments := []byte(fields["FRAGMENT SUMS"])
+	count := 0
+	if v, ok := fields["FRAGMENT COUNT"]; ok {
+		count, err = strconv.Atoi(v)
+		if err != nil || count <= 0 || count > md5FragmentSumSize {
+			return fmt.Errorf("invalid FRAGMENT COUNT %q in implanted MD5 checksum", v)
+		}
+	}
+	sum, fragments, err := md5Sums(r, pvd, size-skip*int64(SectorSize), count)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(sum[:], want) {
+		return fmt.Errorf("%w: image MD5 is %x, implanted MD5 is %x", ErrChecksumMismatch, sum, want)
+	}
+	for i, c := range fragments {
+		if c != 0 && i < len(wantFragments) && c != wantFragments[i] {
+			return fmt.Errorf("%w: fragment %d", ErrChecksumMismatch, i/(md5FragmentSumSize/count)+1)
+		}
+	}
+	return nil
+}
+
+// readPVDInfo returns the offset of the primary volume descriptor of the
+// image in r and the size of the volume in bytes.
+func readPVDInfo(r io.ReaderAt) (int64, int64, error) {
+	return readSessionPVDInfo(r, 0)
+}
+
+// readSessionPVDInfo is readPVDInfo for the session of a multisession image
+// that starts at sector session.
+func readSessionPVDInfo(r io.ReaderAt, session uint32) (int64, int64, error) {
+	sector := make([]byte, SectorSize)
+	for n := int64(session) + int64(primaryVolumeSectorNum); ; n++ {
+		offset := n * int64(SectorSize)
+		if _, err := r.ReadAt(sector, offset); err != nil {
+			return 0, 0, fmt.Errorf("reading volume descriptor %d: %w", n, err)
+		}
+		if string(sector[1:6]) != standardIdentifier {
+			return 0, 0, fmt.Errorf("not an ISO9660 image")
+		}
+		switch sector[0] {
+		case 1:
+			return offset, int64(binary.LittleEndian.Uint32(sector[80:])) * int64(SectorSize), nil
+		case 255:
+			return 0, 0, fmt.Errorf("image has no primary volume descriptor")
+		}
+	}
+}
+
+// md5Sums returns the MD5 checksum of the first total bytes of r, with the
+// application use area of the primary volume descriptor at pvd read as
+// spaces, along with the fragment sums over count fragments.  Fragment sums
+// are taken whenever a read of md5BufferSize bytes starts in a new fragment,
+// which leaves the sums of skipped fragments zero, exactly like isomd5sum.
+func md5Sums(r io.ReaderAt, pvd, total int64, count int) ([md5.Size]byte, []byte, error) {
+	var sum [md5.Size]byte
+	if total <= 0 {
+		return sum, nil, fmt.Errorf("image is too small for an implanted MD5 checksum")
+	}
+	fragments := make([]byte, md5FragmentSumSize)
+	fragmentSize := total
+	digits := 0
+	if count > 0 {
+		fragmentSize = total / int64(count+1)
+		digits = md5FragmentSumSize / count
+	}
+	if fragmentSize == 0 {
+		fragmentSize = 1
+	}
+	h := md5.New()
+	buf := make([]byte, md5BufferSize)
+	previous := int64(0)
+	for offset := int64(0); offset < total; {
+		n := total - offset
+		if n > int64(len(buf)) {
+			n = int64(len(buf))
+		}
+		b := buf[:n]
+		if _, err := r.ReadAt(b, offset); err != nil {
+			return sum, nil, err
+		}
+		// clear the application use area that holds the checksum
+		for i := pvd + md5AppDataOffset; i < pvd+md5AppDataOffset+md5AppDataSize; i++ {
+			if i >= offset && i < offset+n {
+				b[i-offset] = ' '
+			}
+		}
+		h.Write(b)
+		if current := offset / fragmentSize; current != previous {
+			if current <= int64(count) {
+				copy(fragments[(current-1)*int64(digits):], fragmentDigits(h, digits))
+			}
+			previous = current
+		}
+		offset += n
+	}
+	copy(sum[:], h.Sum(nil))
+	return sum, fragments, nil
+}
+
+// fragmentDigits returns the fragment sum of the data hashed so far by h.
+// isomd5sum keeps the first hex digit of each of the first digits bytes of
+// the MD5 checksum, printed without leading zeros.
+func fragmentDigits(h hash.Hash, digits int) []byte {
+	sum := h.Sum(nil)
+	d := make([]byte, digits)
+	for i := range d {
+		d[i] = strconv.FormatUint(uint64(sum[i]), 16)[0]
+	}
+	return d
+}
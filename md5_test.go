@@ -0,0 +1,89 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImplantMD5RoundTrip(t *testing.T) {
+	iw := NewImageWriter(WithRockRidge())
+	for i := 0; i < 8; i++ {
+		if err := iw.AddBytes(fmt.Sprintf("data/part%d.bin", i), bytes.Repeat([]byte{byte('a' + i)}, 256<<10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	iso := filepath.Join(t.TempDir(), "image.iso")
+	f, err := os.Create(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := iw.Finalize(f); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyMD5(f); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("VerifyMD5 before implanting returned %v, want ErrNoChecksum", err)
+	}
+	if err := ImplantMD5(f, true); err != nil {
+		t.Fatal(err)
+	}
+	img, err := ioutil.ReadFile(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the application use area holds the fields checkisomd5 parses, with the
+	// sum over the image less its last 15 sectors, the area read as spaces
+	pvd := int(primaryVolumeSectorNum * SectorSize)
+	appData := string(img[pvd+md5AppDataOffset : pvd+md5AppDataOffset+md5AppDataSize])
+	blanked := append([]byte(nil), img[:len(img)-md5SkipSectors*int(SectorSize)]...)
+	copy(blanked[pvd+md5AppDataOffset:], strings.Repeat(" ", md5AppDataSize))
+	prefix := fmt.Sprintf("ISO MD5SUM = %x;SKIPSECTORS = 15;RHLISOSTATUS=1;FRAGMENT SUMS = ", md5.Sum(blanked))
+	if !strings.HasPrefix(appData, prefix) {
+		t.Fatalf("application use area is %q, want it to start with %q", appData, prefix)
+	}
+	rest := appData[len(prefix):]
+	if i := strings.IndexByte(rest, ';'); i != md5FragmentSumSize || strings.Trim(rest[:i], "0123456789abcdef") != "" {
+		t.Errorf("fragment sums are %q, want %d hex digits", rest[:i], md5FragmentSumSize)
+	}
+	if !strings.HasPrefix(rest[md5FragmentSumSize:], ";FRAGMENT COUNT = 20;THIS IS NOT THE SAME AS RUNNING MD5SUM ON THIS ISO!!") || len(appData) != md5AppDataSize {
+		t.Errorf("application use area ends with %q", rest[md5FragmentSumSize:])
+	}
+
+	if err := VerifyMD5(bytes.NewReader(img)); err != nil {
+		t.Errorf("VerifyMD5: %v", err)
+	}
+	checkValid(t, bytes.NewReader(img))
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := readTree(t, ir)
+	if got := tree["data/part3.bin"]; got != strings.Repeat("d", 256<<10) {
+		t.Errorf("data/part3.bin holds %d bytes starting %q", len(got), head([]byte(got)))
+	}
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), tree)
+
+	// the last 15 sectors are not summed, but every other byte is
+	tail := append([]byte(nil), img...)
+	tail[len(tail)-1] ^= 0xFF
+	if err := VerifyMD5(bytes.NewReader(tail)); err != nil {
+		t.Errorf("VerifyMD5 with a change in the skipped sectors: %v", err)
+	}
+	info, err := ir.Stat("data/part3.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := append([]byte(nil), img...)
+	corrupt[int64(info.LBA)*int64(SectorSize)+1000] ^= 0xFF
+	if err := VerifyMD5(bytes.NewReader(corrupt)); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("VerifyMD5 with a corrupted file returned %v, want ErrChecksumMismatch", err)
+	}
+}
@@ -0,0 +1,361 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxRelaxedIdentifierLength is the longest identifier accepted in relaxed
+// mode, matching mkisofs -max-iso9660-filenames.
+const maxRelaxedIdentifierLength = 37
+
+// Interchange level 2 limits the name and extension of a file identifier to
+// 30 characters together, not counting the dot and the version, and a
+// directory identifier to 31 characters.
+const (
+	maxFileIdentifierLength = 30
+	maxDirIdentifierLength  = 31
+)
+
+// WithInterchangeLevel restricts the image to ISO9660 interchange level 1, 2
+// or 3.  Level 1 limits file names to the 8.3 format and directory names to 8
+// characters, level 2 allows file names of up to 30 characters besides the
+// dot and directory names of up to 31, and only level 3 allows a file to be
+// recorded in several extents, which files larger than 4 GiB require.
+// Without this option, names follow the level 2 limits while large files are
+// still accepted.  At level 2, WithNameMangling shortens names to the level 2
+// limits rather than to the 8.3 format.
+func WithInterchangeLevel(level int) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithRelaxedNames accepts identifiers that don't conform to the ISO9660
+// character set, like mkisofs -relaxed-filenames and -max-iso9660-filenames
+// do: any printable ASCII character other than '/' and ';' is permitted, and
+// identifiers may be up to 37 characters long.  Other characters are
+// converted as SanitizeName converts them, so "Café Menu" is recorded as
+// CAFE_MENU.  Names are still upper-cased unless WithPreserveCase is given
+// as well.  Readers that insist on strict conformance may reject such
+// images.
+func WithRelaxedNames() Option {
+	return func(o *options) {
+		o.relaxedNames = true
+	}
+}
+
+// WithPreserveCase records file and directory names in the case they were
+// given in rather than upper-casing them, for consumers that look for exact
+// lower-case names such as cloud-init's "meta-data" (whose '-' also needs
+// WithRelaxedNames).  Lower-case letters are not d-characters, so strictly
+// conforming readers may reject such images; apart from that, names are
+// validated as usual.
+func WithPreserveCase() Option {
+	return func(o *options) {
+		o.preserveCase = true
+	}
+}
+
+// WithFileVersions appends the version number ";1" to every file identifier,
+// as most ISO9660 authoring tools do and some readers expect.  Directory
+// identifiers never carry a version.
+func WithFileVersions() Option {
+	return func(o *options) {
+		o.fileVersions = true
+	}
+}
+
+func (iw *ImageWriter) checkFileName(filename string) error {
+	if iw.rawNames {
+		if len(filename) > 30 {
+			return fmt.Errorf("file name %s is longer than 30 characters", filename)
+		}
+		return nil
+	}
+	if iw.relaxedNames {
+		return checkRelaxedIdentifier("file", filename)
+	}
+	if !filenameSatisfiesISOConstraints(iw.foldCase(filename)) {
+		return fmt.Errorf("Input file name %s does not satisfy the ISO9660 character set constraints", filename)
+	}
+	if iw.level != 0 && strings.Count(filename, ".") > 1 {
+		return fmt.Errorf("file name %s contains more than one dot", filename)
+	}
+	if iw.level == 1 {
+		name, ext, _ := splitIdentifier(filename)
+		if len(name) > 8 || len(ext) > 3 {
+			return fmt.Errorf("file name %s does not fit the 8.3 format of interchange level 1", filename)
+		}
+	}
+	n := len(filename)
+	if strings.Contains(filename, ".") {
+		n-- // the separator between name and extension doesn't count
+	}
+	if n > maxFileIdentifierLength {
+		return fmt.Errorf("file name %s is longer than %d characters", filename, maxFileIdentifierLength)
+	}
+	return nil
+}
+
+func (iw *ImageWriter) checkDirName(dirname string) error {
+	if iw.rawNames {
+		if len(dirname) > 30 {
+			return fmt.Errorf("directory name %s is longer than 30 characters", dirname)
+		}
+		return nil
+	}
+	if iw.relaxedNames {
+		return checkRelaxedIdentifier("directory", dirname)
+	}
+	if !dirnameSatisfiesISOConstraints(iw.foldCase(dirname)) {
+		return fmt.Errorf("directory name %s does not satisfy the ISO9660 character set constraints", dirname)
+	}
+	if iw.level == 1 && len(dirname) > 8 {
+		return fmt.Errorf("directory name %s is longer than the 8 characters of interchange level 1", dirname)
+	}
+	if len(dirname) > maxDirIdentifierLength {
+		return fmt.Errorf("directory name %s is longer than %d characters", dirname, maxDirIdentifierLength)
+	}
+	return nil
+}
+
+func (iw *ImageWriter) checkFileSize(filename string, size int64) error {
+	if (iw.level == 1 || iw.level == 2) && size > maxExtentSize {
+		return fmt.Errorf("file %s of %d bytes requires interchange level 3", filename, size)
+	}
+	return nil
+}
+
+// foldCase returns identifier as it is validated: names whose case is
+// preserved are held to the same rules as their upper-case forms.
+func (iw *ImageWriter) foldCase(identifier string) string {
+	if iw.preserveCase {
+		return strings.ToUpper(identifier)
+	}
+	return identifier
+}
+
+func checkRelaxedIdentifier(kind, identifier string) error {
+	invalidCharacter := func(r rune) bool {
+		return r <= ' ' || r > '~' || r == '/' || r == ';'
+	}
+	if strings.IndexFunc(identifier, invalidCharacter) != -1 {
+		return fmt.Errorf("%s name %q contains characters not permitted in an ISO9660 identifier", kind, identifier)
+	}
+	if len(identifier) > maxRelaxedIdentifierLength {
+		return fmt.Errorf("%s name %s is longer than %d characters", kind, identifier, maxRelaxedIdentifierLength)
+	}
+	return nil
+}
+
+func filenameSatisfiesISOConstraints(filename string) bool {
+	invalidCharacter := func(r rune) bool {
+		// According to ISO9660, only capital letters, digits, and underscores
+		// are permitted.  Some sources say a dot is allowed as well.  I'm too
+		// lazy to figure it out right now.
+		if r >= 'A' && r <= 'Z' {
+			return false
+		} else if r >= '0' && r <= '9' {
+			return false
+		} else if r == '_' {
+			return false
+		} else if r == '.' {
+			return false
+		}
+		return true
+	}
+	return strings.IndexFunc(filename, invalidCharacter) == -1
+}
+
+func dirnameSatisfiesISOConstraints(dirname string) bool {
+	// Directory identifiers have no extension, so unlike file names they may
+	// not contain a dot.
+	return filenameSatisfiesISOConstraints(dirname) && !strings.Contains(dirname, ".")
+}
+
+// WithNameMangling converts file and directory names that are not valid
+// identifiers into valid 8.3-style identifiers instead of rejecting them.
+// Letters with diacritics are transliterated to their base letters, other
+// invalid characters become underscores, and the name and extension are
+// truncated to 8 and 3 characters, or at interchange level 2 to 30
+// characters with the extension kept whole where possible.  When a
+// converted name collides with an existing entry, a numeric suffix such as
+// _1 or _2 is added; the more common ~1 is not used because '~' is not
+// permitted in identifiers.  Combine it with WithRockRidge to keep the
+// original names readable on systems that support Rock Ridge.
+func WithNameMangling() Option {
+	return func(o *options) {
+		o.mangleNames = true
+	}
+}
+
+// fileIdentifier returns the identifier for a file called name in dir.
+func (iw *ImageWriter) fileIdentifier(dir *directoryEntry, name string) (string, error) {
+	filename := iw.identifier(iw.relaxedName(name))
+	err := iw.checkFileName(filename)
+	if err != nil && iw.mangleNames {
+		base, ext := splitExtension(name)
+		if iw.level == 2 {
+			// leave the name at least the 8 characters of level 1
+			ext = mangleComponent(ext, maxFileIdentifierLength-8)
+			n := maxFileIdentifierLength - len(ext)
+			return dir.uniqueIdentifier(mangleComponent(base, n), ext, n), nil
+		}
+		return dir.uniqueIdentifier(mangleComponent(base, 8), mangleComponent(ext, 3), 8), nil
+	}
+	return filename, err
+}
+
+// dirIdentifier returns the identifier for a subdirectory called name in
+// dir.
+func (iw *ImageWriter) dirIdentifier(dir *directoryEntry, name string) (string, error) {
+	dirname := iw.identifier(iw.relaxedName(name))
+	err := iw.checkDirName(dirname)
+	if err != nil && iw.mangleNames {
+		n := 8
+		if iw.level == 2 {
+			n = maxDirIdentifierLength
+		}
+		return dir.uniqueIdentifier(mangleComponent(name, n), "", n), nil
+	}
+	return dirname, err
+}
+
+// ValidateName returns the identifier a file called name, or a directory
+// if dir is set, is recorded under in an image written with opts, or the
+// error adding it fails with.  name is a single path component.  It touches
+// neither the file system nor an image, so the identifier rules can be
+// checked, or fuzzed, on their own.
+func ValidateName(name string, dir bool, opts ...Option) (string, error) {
+	if name == "" || strings.ContainsRune(name, '/') {
+		return "", fmt.Errorf("invalid name %q", name)
+	}
+	iw := NewImageWriter(opts...)
+	if dir {
+		return iw.dirIdentifier(iw.root, name)
+	}
+	return iw.fileIdentifier(iw.root, name)
+}
+
+// uniqueIdentifier returns base.ext, or base_N.ext with the smallest N that
+// does not collide with an existing entry of d.  base is shortened to make
+// room for the suffix within n characters.
+func (d *directoryEntry) uniqueIdentifier(base, ext string, n int) string {
+	join := func(base string) string {
+		if ext == "" {
+			return base
+		}
+		return base + "." + ext
+	}
+	identifier := join(base)
+	for i := 1; d.lookup(identifier); i++ {
+		suffix := fmt.Sprintf("_%d", i)
+		b := base
+		if len(b)+len(suffix) > n {
+			b = b[:n-len(suffix)]
+		}
+		identifier = join(b + suffix)
+	}
+	return identifier
+}
+
+func splitExtension(name string) (base, ext string) {
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// SanitizeName converts name, a single path component, into an identifier
+// of d-characters, the upper-case letters, digits and underscore that
+// ISO9660 permits, without shortening it: letters are upper-cased, letters
+// with diacritics and ligatures are transliterated, such as "é" to "E" and
+// "ß" to "SS", and spaces and any other characters become underscores.  The
+// last dot of a file name is kept to separate its extension, and dir is set
+// for directories, whose names have none.  The result still has to fit the
+// length limits of the image.
+func SanitizeName(name string, dir bool) string {
+	if dir {
+		return sanitize(name, true, isDCharacter)
+	}
+	base, ext := splitExtension(name)
+	if ext == "" && !strings.HasSuffix(name, ".") {
+		return sanitize(base, true, isDCharacter)
+	}
+	return sanitize(base, true, isDCharacter) + "." + sanitize(ext, true, isDCharacter)
+}
+
+// relaxedName converts the characters of name that relaxed identifiers
+// can't hold, if WithRelaxedNames is given.
+func (iw *ImageWriter) relaxedName(name string) string {
+	if !iw.relaxedNames || iw.rawNames {
+		return name
+	}
+	return sanitize(name, false, func(r rune) bool {
+		return r > ' ' && r <= '~' && r != '/' && r != ';'
+	})
+}
+
+func isDCharacter(r rune) bool {
+	return (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_'
+}
+
+// sanitize transliterates the letters of s that valid rejects, upper-casing
+// s first if upper is set, and replaces other such characters with
+// underscores.
+func sanitize(s string, upper bool, valid func(rune) bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		if upper {
+			r = unicode.ToUpper(r)
+		}
+		if valid(r) {
+			b.WriteRune(r)
+		} else if t, ok := transliterations[r]; ok {
+			if !upper && unicode.IsLower(r) {
+				t = strings.ToLower(t)
+			}
+			b.WriteString(t)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// mangleComponent converts s into at most n d-characters.  The result is
+// only empty if s is.
+func mangleComponent(s string, n int) string {
+	m := sanitize(s, true, isDCharacter)
+	if len(m) > n {
+		m = m[:n]
+	}
+	return m
+}
+
+// transliterations maps Latin letters with diacritics and ligatures to the
+// d-characters they are usually written as.
+var transliterations = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Æ': "AE",
+	'Ç': "C", 'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ì': "I", 'Í': "I",
+	'Î': "I", 'Ï': "I", 'Ð': "D", 'Ñ': "N", 'Ò': "O", 'Ó': "O", 'Ô': "O",
+	'Õ': "O", 'Ö': "O", 'Ø': "O", 'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U",
+	'Ý': "Y", 'Þ': "TH", 'ß': "SS",
+	'à': "A", 'á': "A", 'â': "A", 'ã': "A", 'ä': "A", 'å': "A", 'æ': "AE",
+	'ç': "C", 'è': "E", 'é': "E", 'ê': "E", 'ë': "E", 'ì': "I", 'í': "I",
+	'î': "I", 'ï': "I", 'ð': "D", 'ñ': "N", 'ò': "O", 'ó': "O", 'ô': "O",
+	'õ': "O", 'ö': "O", 'ø': "O", 'ù': "U", 'ú': "U", 'û': "U", 'ü': "U",
+	'ý': "Y", 'þ': "TH", 'ÿ': "Y",
+	'Ā': "A", 'ā': "A", 'Ă': "A", 'ă': "A", 'Ą': "A", 'ą': "A",
+	'Ć': "C", 'ć': "C", 'Č': "C", 'č': "C", 'Ď': "D", 'ď': "D", 'Đ': "D", 'đ': "D",
+	'Ē': "E", 'ē': "E", 'Ė': "E", 'ė': "E", 'Ę': "E", 'ę': "E", 'Ě': "E", 'ě': "E",
+	'Ğ': "G", 'ğ': "G", 'Ī': "I", 'ī': "I", 'Į': "I", 'į': "I", 'İ': "I", 'ı': "I",
+	'Ł': "L", 'ł': "L", 'Ń': "N", 'ń': "N", 'Ň': "N", 'ň': "N",
+	'Ō': "O", 'ō': "O", 'Ő': "O", 'ő': "O", 'Œ': "OE", 'œ': "OE",
+	'Ř': "R", 'ř': "R", 'Ś': "S", 'ś': "S", 'Ş': "S", 'ş': "S", 'Š': "S", 'š': "S",
+	'Ţ': "T", 'ţ': "T", 'Ť': "T", 'ť': "T", 'Ū': "U", 'ū': "U", 'Ů': "U", 'ů': "U",
+	'Ű': "U", 'ű': "U", 'Ų': "U", 'ų': "U", 'Ÿ': "Y", 'Ź': "Z", 'ź': "Z",
+	'Ż': "Z", 'ż': "Z", 'Ž': "Z", 'ž': "Z",
+}
@@ -0,0 +1,81 @@
+package iso9660wrap
+
+import (
+	"io"
+	"sync"
+)
+
+// defaultMaxOpenFiles stays well below the default limit of 256 or 1024
+// open files per process of most systems.
+const defaultMaxOpenFiles = 64
+
+// WithMaxOpenFiles limits the number of inputs open at a time to n.  Inputs
+// are opened only while their data is read, and closed once it is, so
+// Finalize holds one or two open at a time however many files an image has;
+// the limit bounds the concurrent reads of the ReaderAt of an Image, which
+// otherwise open one input each.  A read past the limit waits for another
+// to close its input.  The default is 64.
+func WithMaxOpenFiles(n int) Option {
+	return func(o *options) {
+		o.maxOpenFiles = n
+	}
+}
+
+// limitOpen returns open limited to the open files permitted by
+// WithMaxOpenFiles, shared by every file of iw.
+func (iw *ImageWriter) limitOpen(open func() (io.ReadCloser, error)) func() (io.ReadCloser, error) {
+	if iw.openFiles == nil {
+		n := iw.maxOpenFiles
+		if n <= 0 {
+			n = defaultMaxOpenFiles
+		}
+		iw.openFiles = make(chan struct{}, n)
+	}
+	sem := iw.openFiles
+	return func() (io.ReadCloser, error) {
+		sem <- struct{}{}
+		rc, err := open()
+		if err != nil {
+			<-sem
+			return nil, err
+		}
+		lr := &limitedReader{ReadCloser: rc, sem: sem}
+		// readers of lazy images seek or read at offsets where the
+		// input permits it
+		ra, isReaderAt := rc.(io.ReaderAt)
+		s, isSeeker := rc.(io.Seeker)
+		switch {
+		case isReaderAt && isSeeker:
+			return struct {
+				*limitedReader
+				io.ReaderAt
+				io.Seeker
+			}{lr, ra, s}, nil
+		case isReaderAt:
+			return struct {
+				*limitedReader
+				io.ReaderAt
+			}{lr, ra}, nil
+		case isSeeker:
+			return struct {
+				*limitedReader
+				io.Seeker
+			}{lr, s}, nil
+		}
+		return lr, nil
+	}
+}
+
+// limitedReader is an open input that gives back its slot among the open
+// files once it is closed.
+type limitedReader struct {
+	io.ReadCloser
+	sem  chan struct{}
+	once sync.Once
+}
+
+func (r *limitedReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(func() { <-r.sem })
+	return err
+}
@@ -0,0 +1,154 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// countingFS counts the files of a file system that are open, and the most
+// that were open at once.
+type countingFS struct {
+	fstest.MapFS
+	mu        sync.Mutex
+	open, max int
+	// fail is the name of a file whose reads fail
+	fail string
+}
+
+func (c *countingFS) Open(name string) (fs.File, error) {
+	f, err := c.MapFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err != nil || fi.IsDir() {
+		return f, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.open++
+	if c.open > c.max {
+		c.max = c.open
+	}
+	return &countedFile{File: f, fs: c, fail: name == c.fail}, nil
+}
+
+type countedFile struct {
+	fs.File
+	fs     *countingFS
+	fail   bool
+	closed bool
+}
+
+func (f *countedFile) Read(p []byte) (int, error) {
+	if f.fail {
+		return 0, errors.New("read error")
+	}
+	return f.File.Read(p)
+}
+
+func (f *countedFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		f.fs.open--
+	}
+	return f.File.Close()
+}
+
+func newCountingFS(files int) *countingFS {
+	c := &countingFS{MapFS: fstest.MapFS{}}
+	for i := 0; i < files; i++ {
+		c.MapFS[fmt.Sprintf("DIR%d/F%03d.TXT", i%4, i)] = &fstest.MapFile{Data: bytes.Repeat([]byte{byte(i)}, 3000+i)}
+	}
+	return c
+}
+
+func TestMaxOpenFiles(t *testing.T) {
+	for _, prefetch := range []int{0, 1 << 20} {
+		fsys := newCountingFS(300)
+		iw := NewImageWriter(WithMaxOpenFiles(2), WithPrefetch(prefetch))
+		if err := iw.AddFS(fsys); err != nil {
+			t.Fatal(err)
+		}
+		if fsys.max != 0 {
+			t.Fatalf("AddFS opened %d files", fsys.max)
+		}
+		ir, err := ReadImage(writeImage(t, iw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fsys.open != 0 || fsys.max > 2 {
+			t.Errorf("prefetch %d: %d files were open at once and %d are left open", prefetch, fsys.max, fsys.open)
+		}
+		if got := readTree(t, ir)["DIR3/F299.TXT"]; got != string(fsys.MapFS["DIR3/F299.TXT"].Data) {
+			t.Errorf("prefetch %d: DIR3/F299.TXT holds %d bytes", prefetch, len(got))
+		}
+	}
+
+	// concurrent reads of the ReaderAt of an Image wait for open files
+	fsys := newCountingFS(40)
+	iw := NewImageWriter(WithMaxOpenFiles(3))
+	if err := iw.AddFS(fsys); err != nil {
+		t.Fatal(err)
+	}
+	im, err := iw.Image()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ra, err := im.ReaderAt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ir, err := NewReader(ra)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	err = ir.Walk(func(info ISOFileInfo) error {
+		if info.IsDir() {
+			return nil
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, err := ir.Open(info.Path)
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+		return nil
+	})
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fsys.open != 0 || fsys.max > 3 || fsys.max == 0 {
+		t.Errorf("ReaderAt had %d files open at once and left %d open", fsys.max, fsys.open)
+	}
+}
+
+func TestMaxOpenFilesError(t *testing.T) {
+	fsys := newCountingFS(20)
+	fsys.fail = "DIR1/F009.TXT"
+	iw := NewImageWriter(WithMaxOpenFiles(2), WithPrefetch(1<<20))
+	if err := iw.AddFS(fsys); err != nil {
+		t.Fatal(err)
+	}
+	var ie *InputError
+	if err := iw.Finalize(ioutil.Discard); !errors.As(err, &ie) || ie.Path != "/DIR1/F009.TXT" {
+		t.Errorf("Finalize returned %v, want an InputError for DIR1/F009.TXT", err)
+	}
+	if fsys.open != 0 {
+		t.Errorf("%d files are left open after Finalize failed", fsys.open)
+	}
+}
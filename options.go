@@ -0,0 +1,293 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Option configures an image written by an ImageWriter, WriteFile or
+// WriteBuffer.
+type Option func(*options)
+
+type options struct {
+	systemID    string
+	volumeID    string
+	volumeSetID string
+
+	publisherID     string
+	dataPreparerID  string
+	applicationID   string
+	copyrightFileID string
+
+	abstractFileID      string
+	bibliographicFileID string
+
+	contentVolumeID bool
+	volumeIDPrefix  string
+
+	timestamp       time.Time
+	sourceDateEpoch bool
+	location        *time.Location
+
+	progress func(Progress)
+	logger   Logger
+	result   *Result
+	sha256   bool
+	verify   bool
+	sparse   bool
+
+	level        int
+	relaxedNames bool
+	mangleNames  bool
+	preserveCase bool
+	fileVersions bool
+	transTable   bool
+	rockRidge    bool
+	xa           bool
+	svds         []SupplementaryVolume
+	bootRecords  []BootRecord
+
+	volumeSetSize  uint16
+	volumeSequence uint16
+
+	dedup        bool
+	prefetch     int
+	maxOpenFiles int
+
+	sessionStart uint32
+	padding      uint32
+
+	duplicates        DuplicatePolicy
+	symlinks          SymlinkPolicy
+	symlinkWarning    func(name, target string)
+	sourcePermissions bool
+	exclude           []string
+	include           []string
+
+	systemAreaData []byte
+	hybridMBR      bool
+	mbrBootCode    []byte
+	hybridGPT      bool
+	apmPaths       []string
+}
+
+// Logger receives diagnostic messages about the layout of an image.
+// *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger sets a Logger for diagnostic messages.  By default nothing is
+// logged.
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
+
+func (o *options) logf(format string, v ...interface{}) {
+	if o.logger != nil {
+		o.logger.Printf(format, v...)
+	}
+}
+
+// WithVolumeID sets the volume identifier, which most operating systems show
+// as the label of the mounted image.  It may be up to 32 characters long.
+func WithVolumeID(id string) Option {
+	return func(o *options) {
+		o.volumeID = id
+	}
+}
+
+// WithSystemID sets the system identifier, naming the system that can act
+// upon the system area of the image.  It may be up to 32 characters long.
+func WithSystemID(id string) Option {
+	return func(o *options) {
+		o.systemID = id
+	}
+}
+
+// WithVolumeSetID sets the identifier of the volume set the image belongs
+// to.  It may be up to 128 characters long.
+func WithVolumeSetID(id string) Option {
+	return func(o *options) {
+		o.volumeSetID = id
+	}
+}
+
+// WithPublisherID sets the publisher identifier.  It may be up to 128
+// characters long.
+func WithPublisherID(id string) Option {
+	return func(o *options) {
+		o.publisherID = id
+	}
+}
+
+// WithDataPreparerID sets the identifier of the person or entity that
+// prepared the data in the image.  It may be up to 128 characters long.
+func WithDataPreparerID(id string) Option {
+	return func(o *options) {
+		o.dataPreparerID = id
+	}
+}
+
+// WithApplicationID sets the identifier of the application that created the
+// image.  It may be up to 128 characters long.
+func WithApplicationID(id string) Option {
+	return func(o *options) {
+		o.applicationID = id
+	}
+}
+
+// WithCopyrightFileID sets the identifier of the file in the root directory
+// holding the copyright statement for the image.  It may be up to 37
+// characters long.
+func WithCopyrightFileID(id string) Option {
+	return func(o *options) {
+		o.copyrightFileID = id
+	}
+}
+
+// WithTimestamp records t as the creation, modification and recording date
+// of the volume and of every directory record, instead of the current time.
+// Together with fixed inputs this makes the image byte-for-byte reproducible.
+func WithTimestamp(t time.Time) Option {
+	return func(o *options) {
+		o.timestamp = t
+	}
+}
+
+// WithSourceDateEpoch takes the timestamp of the image from the
+// SOURCE_DATE_EPOCH environment variable, as specified by
+// https://reproducible-builds.org/specs/source-date-epoch/.  It has no
+// effect when the variable is unset or when WithTimestamp is also given.
+func WithSourceDateEpoch() Option {
+	return func(o *options) {
+		o.sourceDateEpoch = true
+	}
+}
+
+// WithTimeZone records every date of the volume and its directory records in
+// loc, such as time.Local, along with its offset from GMT.  By default dates
+// are recorded in UTC.
+func WithTimeZone(loc *time.Location) Option {
+	return func(o *options) {
+		o.location = loc
+	}
+}
+
+// inZone returns t in the time zone dates are recorded in.  The zero time
+// is returned unchanged.
+func (o *options) inZone(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	if o.location == nil {
+		return t.UTC()
+	}
+	return t.In(o.location)
+}
+
+// recordingTime returns the time to record for every date in the image.
+func (o *options) recordingTime() (time.Time, error) {
+	t := o.timestamp
+	if t.IsZero() && o.sourceDateEpoch {
+		if v := os.Getenv("SOURCE_DATE_EPOCH"); v != "" {
+			sec, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %s", v, err)
+			}
+			t = time.Unix(sec, 0)
+		}
+	}
+	if t.IsZero() {
+		t = time.Now()
+	}
+	t = o.inZone(t)
+	// directory records store the year as an offset from 1900 in one byte
+	if y := t.Year(); y < 1900 || y > 1900+255 {
+		return time.Time{}, fmt.Errorf("timestamp %s can not be recorded in an ISO9660 image", t)
+	}
+	return t, nil
+}
+
+// fixedTime reports whether the recording time was fixed with WithTimestamp
+// or SOURCE_DATE_EPOCH.
+func (o *options) fixedTime() bool {
+	return !o.timestamp.IsZero() || (o.sourceDateEpoch && os.Getenv("SOURCE_DATE_EPOCH") != "")
+}
+
+// entryTime returns the recording date for an entry whose source was
+// modified at modTime, or the zero time if the entry should record the
+// recording time of the image.  A fixed recording time replaces the
+// modification times of all sources so that builds are reproducible, and
+// times that directory records can't represent are replaced as well.
+func (o *options) entryTime(modTime time.Time) time.Time {
+	if o.fixedTime() {
+		return time.Time{}
+	}
+	if y := o.inZone(modTime).Year(); y < 1900 || y > 1900+255 {
+		return time.Time{}
+	}
+	return modTime
+}
+
+func (o *options) validate() error {
+	fields := []struct {
+		name   string
+		value  string
+		length int
+	}{
+		{"system identifier", o.systemID, 32},
+		{"volume identifier", o.volumeID, 32},
+		{"volume set identifier", o.volumeSetID, 128},
+		{"publisher identifier", o.publisherID, 128},
+		{"data preparer identifier", o.dataPreparerID, 128},
+		{"application identifier", o.applicationID, 128},
+		{"copyright file identifier", o.copyrightFileID, 37},
+		{"abstract file identifier", o.abstractFileID, 37},
+		{"bibliographic file identifier", o.bibliographicFileID, 37},
+	}
+	for _, f := range fields {
+		if len(f.value) > f.length {
+			return fmt.Errorf("%s %q is longer than %d characters", f.name, f.value, f.length)
+		}
+	}
+	if o.contentVolumeID {
+		if o.volumeID != "" {
+			return fmt.Errorf("volume identifier %q can't be given together with one derived from the contents", o.volumeID)
+		} else if len(o.volumeIDPrefix) > maxVolumeIDPrefixLength {
+			return fmt.Errorf("volume identifier prefix %q is longer than %d characters", o.volumeIDPrefix, maxVolumeIDPrefixLength)
+		}
+	}
+	if o.maxOpenFiles < 0 {
+		return fmt.Errorf("invalid limit of %d open files", o.maxOpenFiles)
+	}
+	if o.level < 0 || o.level > 3 {
+		return fmt.Errorf("invalid interchange level %d", o.level)
+	}
+	for i := range o.bootRecords {
+		if err := o.bootRecords[i].validate(); err != nil {
+			return err
+		}
+	}
+	if size, sequence := o.volumeSetSize, o.volumeSequence; (size != 0 || sequence != 0) && (sequence == 0 || sequence > size) {
+		return fmt.Errorf("volume sequence number %d is not within the volume set size %d", sequence, size)
+	}
+	if len(o.systemAreaData) > int(systemAreaSize) {
+		return fmt.Errorf("system area of %d bytes exceeds %d bytes", len(o.systemAreaData), systemAreaSize)
+	}
+	if len(o.mbrBootCode) > mbrBootCodeSize {
+		return fmt.Errorf("MBR boot code of %d bytes exceeds %d bytes", len(o.mbrBootCode), mbrBootCodeSize)
+	}
+	if o.sessionStart != 0 {
+		if o.hybridMBR || o.hybridGPT || len(o.apmPaths) > 0 {
+			return fmt.Errorf("a session starting at sector %d can't have a hybrid partition table", o.sessionStart)
+		} else if o.verify {
+			return fmt.Errorf("a session starting at sector %d can't be verified on its own", o.sessionStart)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// OutputMode selects how WriteToFile treats an existing destination file.
+type OutputMode int
+
+const (
+	// Exclusive fails if the destination already exists.
+	Exclusive OutputMode = iota
+	// Overwrite truncates and overwrites an existing destination.
+	Overwrite
+	// Atomic writes to a temporary file next to the destination and renames
+	// it into place once the image is complete, so readers never observe a
+	// partially written image.
+	Atomic
+)
+
+// WriteToFile creates the file at path according to mode and passes it to
+// write, which is expected to write an image with WriteFile, WriteFiles,
+// ImageWriter.Finalize or similar.  The file is opened for reading as well,
+// so that write may go on to call ImplantMD5.  If write fails, the partially
+// written file is removed.  A file replaced in Atomic mode keeps its
+// permissions; new files get those the umask leaves of 0666.
+func WriteToFile(path string, mode OutputMode, write func(outfh *os.File) error) error {
+	var outfh *os.File
+	var err error
+	var perm os.FileMode
+	keepPerm := false
+	switch mode {
+	case Exclusive:
+		outfh, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+	case Overwrite:
+		outfh, err = os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
+	case Atomic:
+		if fi, serr := os.Stat(path); serr == nil {
+			perm, keepPerm = fi.Mode().Perm(), true
+		}
+		outfh, err = createTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	default:
+		return fmt.Errorf("unknown output mode %d", mode)
+	}
+	if err != nil {
+		return fmt.Errorf("could not open output file %s for writing: %w", path, err)
+	}
+
+	err = write(outfh)
+	if err == nil && mode == Atomic {
+		err = outfh.Sync()
+		if err == nil && keepPerm {
+			err = outfh.Chmod(perm)
+		}
+	}
+	if cerr := outfh.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && mode == Atomic {
+		err = os.Rename(outfh.Name(), path)
+		if err == nil {
+			// the rename only lasts once the directory is on disk
+			if err = syncDir(filepath.Dir(path)); err != nil {
+				return fmt.Errorf("could not sync the directory of %s: %w", path, err)
+			}
+		}
+	}
+	if err != nil {
+		os.Remove(outfh.Name())
+		return err
+	}
+	return nil
+}
+
+// createTemp is like os.CreateTemp, but creates the file with mode 0666
+// before the umask, like os.Create, rather than 0600.
+func createTemp(dir, prefix string) (*os.File, error) {
+	for try := 0; ; try++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666)
+		if os.IsExist(err) && try < 10000 {
+			continue
+		}
+		return f, err
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package iso9660wrap
+
+// syncDir does nothing, since directories can not be synced on this system.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package iso9660wrap
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteToFile(t *testing.T) {
+	dir := t.TempDir()
+	writeData := func(data string) func(*os.File) error {
+		return func(outfh *os.File) error {
+			_, err := outfh.WriteString(data)
+			return err
+		}
+	}
+	check := func(path, want string, perm os.FileMode) {
+		t.Helper()
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err := ioutil.ReadFile(path); err != nil || string(b) != want {
+			t.Errorf("%s holds %q, want %q: %v", filepath.Base(path), b, want, err)
+		}
+		if fi.Mode().Perm() != perm {
+			t.Errorf("%s has mode %v, want %v", filepath.Base(path), fi.Mode().Perm(), perm)
+		}
+	}
+
+	// the mode the umask leaves of 0666
+	probe := filepath.Join(dir, "probe")
+	if err := ioutil.WriteFile(probe, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(probe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultPerm := fi.Mode().Perm()
+
+	for _, mode := range []OutputMode{Exclusive, Overwrite, Atomic} {
+		path := filepath.Join(dir, fmt.Sprintf("new%d", mode))
+		if err := WriteToFile(path, mode, writeData("new")); err != nil {
+			t.Fatal(err)
+		}
+		check(path, "new", defaultPerm)
+	}
+
+	path := filepath.Join(dir, "existing")
+	if err := ioutil.WriteFile(path, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteToFile(path, Exclusive, writeData("new")); !errors.Is(err, os.ErrExist) {
+		t.Errorf("Exclusive WriteToFile of an existing file returned %v", err)
+	}
+	if err := WriteToFile(path, Atomic, func(*os.File) error { return errors.New("failed") }); err == nil {
+		t.Error("WriteToFile succeeded when write failed")
+	}
+	check(path, "old", 0600)
+	// replacing a file keeps its mode
+	if err := WriteToFile(path, Atomic, writeData("replaced")); err != nil {
+		t.Fatal(err)
+	}
+	check(path, "replaced", 0600)
+
+	// no temporary files are left behind
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 {
+		for _, e := range entries {
+			t.Errorf("left %s", e.Name())
+		}
+	}
+}
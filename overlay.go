@@ -0,0 +1,104 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	pathpkg "path"
+	"strings"
+)
+
+// AddImage schedules every file and directory of the existing ISO9660 image
+// in r for inclusion in the image as the directory isoPath, which is "/" to
+// merge it into the root directory.  Files of the existing image replace
+// files of the same name added before it, and are replaced by files added
+// after it, which lets configuration be layered onto a vendor image:
+//
+//	iw.AddImage(vendor, "/")
+//	iw.AddFileAs("ks.cfg", "ks.cfg")
+//
+// Entries are filtered according to WithExclude and WithIncludeOnly, whose
+// patterns are matched against the identifiers of the existing image, and
+// the hidden and associated flags and recording dates of the existing image
+// are kept.  Only the ISO9660 identifiers of the existing image are read,
+// not its Rock Ridge attributes or boot catalog.  A file holding the boot
+// catalog is left out, as are TRANS.TBL files if WithTransTable generates
+// new ones; Rebuild carries over the boot catalog as well.  The data of
+// files is read from r during Finalize, so r must stay open until then.
+func (iw *ImageWriter) AddImage(r io.ReaderAt, isoPath string) error {
+	ir, err := NewReader(r, UseNames(PrimaryNames))
+	if err != nil {
+		return err
+	}
+	return iw.addImage(ir, isoPath, false)
+}
+
+// addImage adds the entries of the image ir as the directory isoPath.  If
+// prior is set, ir is the previous session of the image being written,
+// whose data is kept where it is.
+func (iw *ImageWriter) addImage(ir *Reader, isoPath string, prior bool) error {
+	if err := iw.checkPatterns(); err != nil {
+		return err
+	}
+	catalog, bootable, err := ir.bootCatalogSector()
+	if err != nil {
+		return err
+	}
+	prefix := strings.Join(splitPath(isoPath), "/")
+	if _, err := iw.mkdirAll(splitPath(prefix)); err != nil {
+		return err
+	}
+	// Walk visits the contents of a directory right after it, so they
+	// are skipped along with the last excluded directory
+	skipped := ""
+	return ir.Walk(func(info ISOFileInfo) error {
+		if skipped != "" && strings.HasPrefix(info.Path, skipped+"/") {
+			return nil
+		}
+		if bootable && !info.IsDir() && info.LBA == catalog {
+			// a boot catalog recorded as a file would be out of date
+			return nil
+		}
+		if iw.excluded(info.Path, info.IsDir()) {
+			if info.IsDir() {
+				skipped = info.Path
+			}
+			return nil
+		}
+		return iw.addImageEntry(ir, prefix, info, prior)
+	})
+}
+
+// addImageEntry adds the entry info of the image ir under the directory
+// prefix.
+func (iw *ImageWriter) addImageEntry(ir *Reader, prefix string, info ISOFileInfo, prior bool) error {
+	name := pathpkg.Join(prefix, info.Path)
+	if info.IsDir() {
+		if !iw.included(info.Path) {
+			return nil
+		}
+		dir, err := iw.mkdirAll(splitPath(name))
+		if err != nil {
+			return err
+		}
+		dir.modTime = info.ModTime
+		return nil
+	}
+	if iw.transTable && info.Name() == transTableName {
+		return nil
+	}
+	if prior && !info.contiguous() {
+		return fmt.Errorf("file %s of the previous session is recorded in extents that are not contiguous", info.Path)
+	}
+	return iw.add(name, info.Size, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(ir.open(&info)), nil
+	}, func(f *FileEntry) {
+		f.srcModTime = info.ModTime
+		f.flags |= info.Flags & (fileFlagHidden | fileFlagAssociated)
+		f.overlay = true
+		if prior {
+			f.prior = true
+			f.sector = info.LBA
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestAddImage(t *testing.T) {
+	vendorTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	vendor := NewImageWriter(WithTimestamp(vendorTime))
+	for name, data := range map[string]string{
+		"README.TXT":            "vendor readme",
+		"KS.CFG":                "vendor kickstart",
+		"ISOLINUX/ISOLINUX.BIN": "loader",
+		"ISOLINUX/ISOLINUX.CFG": "config",
+	} {
+		if err := vendor.AddBytes(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := vendor.AddBytes("HIDDEN.TXT", []byte("hidden"), Hidden()); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, vendor)
+
+	iw := NewImageWriter(WithExclude("*.BIN"))
+	// files of the image replace those added before it, and files added
+	// after it replace those of the image
+	if err := iw.AddBytes("README.TXT", []byte("replaced by the image")); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddImage(bytes.NewReader(img), "/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("KS.CFG", []byte("local kickstart")); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddImage(bytes.NewReader(img), "VENDOR/COPY"); err != nil {
+		t.Fatal(err)
+	}
+	ir, err := ReadImage(writeImage(t, iw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"README.TXT":                        "vendor readme",
+		"KS.CFG":                            "local kickstart",
+		"HIDDEN.TXT":                        "hidden",
+		"ISOLINUX/":                         "",
+		"ISOLINUX/ISOLINUX.CFG":             "config",
+		"VENDOR/":                           "",
+		"VENDOR/COPY/":                      "",
+		"VENDOR/COPY/README.TXT":            "vendor readme",
+		"VENDOR/COPY/KS.CFG":                "vendor kickstart",
+		"VENDOR/COPY/HIDDEN.TXT":            "hidden",
+		"VENDOR/COPY/ISOLINUX/":             "",
+		"VENDOR/COPY/ISOLINUX/ISOLINUX.CFG": "config",
+	}
+	compareTrees(t, "ReadImage", readTree(t, ir), want)
+
+	for path, vendorDate := range map[string]bool{"README.TXT": true, "VENDOR/COPY/ISOLINUX": true, "KS.CFG": false} {
+		info, err := ir.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.ModTime.Equal(vendorTime); got != vendorDate {
+			t.Errorf("%s is recorded at %v, want the date of the existing image: %t", path, info.ModTime, vendorDate)
+		}
+	}
+	if info, err := ir.Stat("HIDDEN.TXT"); err != nil || info.Flags&fileFlagHidden == 0 {
+		t.Errorf("HIDDEN.TXT has flags %#x: %v", info.Flags, err)
+	}
+}
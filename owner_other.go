@@ -0,0 +1,18 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package iso9660wrap
+
+import "os"
+
+// fileOwner returns root as the owner of every file, since files have no
+// Unix owner on this system.
+func fileOwner(fi os.FileInfo) (uid, gid uint32) {
+	return 0, 0
+}
+
+// sourceFileID returns nil, since hard links are not detected on this
+// system.
+func sourceFileID(fi os.FileInfo) *fileID {
+	return nil
+}
@@ -0,0 +1,26 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package iso9660wrap
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileOwner returns the user and group ID owning the file described by fi.
+func fileOwner(fi os.FileInfo) (uid, gid uint32) {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint32(st.Uid), uint32(st.Gid)
+	}
+	return 0, 0
+}
+
+// sourceFileID returns the identity of the file described by fi if other
+// hard links to it may exist.
+func sourceFileID(fi os.FileInfo) *fileID {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && st.Nlink > 1 {
+		return &fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package iso9660wrap
+
+// DefaultPadding is the number of sectors of zeros mkisofs -pad and
+// genisoimage append to an image, 300 KiB, which keeps some CD drives and
+// drivers that read ahead past the data from failing at the end of small
+// images.
+const DefaultPadding = 150
+
+// WithPadding appends sectors of zeros after the data of the image, which
+// the volume space size of the primary volume descriptor counts, as mkisofs
+// -pad does with DefaultPadding.  The backup GPT of WithHybridGPT follows the
+// padding, since it must end the image.
+func WithPadding(sectors uint32) Option {
+	return func(o *options) {
+		o.padding = sectors
+	}
+}
@@ -0,0 +1,179 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxPathLength is the longest path ECMA-119 6.8.2.1 permits, counting the
+// identifiers from the root directory on and the separators between them.
+const maxPathLength = 255
+
+// Plan describes the image Finalize would write with the entries scheduled
+// so far, as laid out before anything is written.
+type Plan struct {
+	// Size is the size of the image in bytes, and Sectors the number of
+	// its sectors, as Result reports them.
+	Size    int64
+	Sectors uint32
+
+	// PathTableSize is the size in bytes of each of the two path tables,
+	// which take up PathTableSectors sectors each.
+	PathTableSize    uint32
+	PathTableSectors uint32
+
+	// Directories describes the directories of the primary volume in path
+	// table order, starting with the root directory.
+	Directories []DirectoryPlan
+
+	// Level is the lowest interchange level every identifier and file size
+	// of the image conforms to, or 0 if some conform to none, as relaxed
+	// names and names whose case is preserved may not.
+	Level int
+
+	// Violations lists the directories nested deeper than 8 levels, the
+	// paths longer than 255 characters and the entries that exceed the
+	// level set with WithInterchangeLevel, or level 3 without it.  Many
+	// readers accept such images, but strictly conforming ones may not.
+	Violations []Finding
+}
+
+// DirectoryPlan describes where a directory is placed in an image.
+type DirectoryPlan struct {
+	// Path is the path of the directory in the image, made of the
+	// identifiers recorded in the directories, with a trailing slash.
+	Path string
+
+	// Sector is the first sector of the extent of the directory, and
+	// Sectors the number of sectors it takes up.
+	Sector  uint32
+	Sectors uint32
+
+	// Depth is the level of the directory in the hierarchy, counting the
+	// root directory as the first.
+	Depth int
+}
+
+// Plan lays out the image Finalize would write with the entries scheduled
+// so far and reports what it would look like, so that an image that is too
+// large or strays from ISO9660 can be caught before a long write starts.
+// Nothing is written, but files are read if WithDeduplication or
+// WithContentVolumeID is given, as Finalize reads them.  Plan returns the
+// error Finalize would return for images that can't be laid out at all.
+func (iw *ImageWriter) Plan() (*Plan, error) {
+	if err := iw.options.validate(); err != nil {
+		return nil, err
+	}
+	l, err := iw.layout()
+	if err != nil {
+		return nil, err
+	}
+	p := &Plan{
+		Size:             int64(l.numSectors-l.sessionStart) * int64(SectorSize),
+		Sectors:          l.numSectors - l.sessionStart,
+		PathTableSize:    l.pathTableSize,
+		PathTableSectors: uint32(numDataSectors(int64(l.pathTableSize))),
+		Level:            1,
+	}
+	limit := iw.level
+	if limit == 0 {
+		limit = 3
+	}
+	conforming := true
+	check := func(d *directoryEntry, level int, format string, a ...interface{}) {
+		if level == 0 {
+			conforming = false
+		} else if level > p.Level {
+			p.Level = level
+		}
+		if level == 0 || level > limit {
+			p.addf(d, format, a...)
+		}
+	}
+	depths := map[*directoryEntry]int{}
+	for _, d := range l.dirs {
+		depth := 1
+		if d != iw.root {
+			depth = depths[d.isoParent()] + 1
+		}
+		depths[d] = depth
+		p.Directories = append(p.Directories, DirectoryPlan{Path: d.isoPath() + "/", Sector: d.sector, Sectors: d.size / SectorSize, Depth: depth})
+
+		if depth > maxDirectoryDepth {
+			p.addf(d, "directory is nested %d levels deep, more than the %d levels ISO9660 permits", depth, maxDirectoryDepth)
+		}
+		if d != iw.root {
+			name := d.isoName()
+			if n := len(d.isoPath()) - 1; n > maxPathLength {
+				p.addf(d, "path is %d characters long, more than %d characters", n, maxPathLength)
+			}
+			level := identifierLevel(name, true)
+			check(d, level, "directory identifier %q %s", name, levelViolation(level, limit))
+		}
+		for _, f := range d.files {
+			id := f.Name
+			if iw.fileVersions {
+				id += ";1"
+			}
+			if n := len(d.isoPath() + "/" + id); n-1 > maxPathLength {
+				p.addf(d, "path of %s is %d characters long, more than %d characters", id, n-1, maxPathLength)
+			}
+			level := identifierLevel(f.Name, false)
+			check(d, level, "file identifier %q %s", f.Name, levelViolation(level, limit))
+			if f.Size > maxExtentSize {
+				check(d, 3, "file %s of %d bytes needs several extents, which require interchange level 3", f.Name, f.Size)
+			}
+		}
+	}
+	if !conforming {
+		p.Level = 0
+	}
+	return p, nil
+}
+
+func (p *Plan) addf(d *directoryEntry, format string, a ...interface{}) {
+	p.Violations = append(p.Violations, Finding{Sector: d.sector, Path: d.isoPath() + "/", Message: fmt.Sprintf(format, a...)})
+}
+
+// levelViolation describes an identifier conforming to level at most that
+// exceeds limit.
+func levelViolation(level, limit int) string {
+	if level == 0 {
+		return "conforms to no interchange level"
+	}
+	return fmt.Sprintf("exceeds interchange level %d", limit)
+}
+
+// identifierLevel returns the lowest interchange level the directory or file
+// identifier id, without a version, conforms to, or 0 if it conforms to none.
+func identifierLevel(id string, dir bool) int {
+	if dir {
+		switch {
+		case !dirnameSatisfiesISOConstraints(id) || len(id) > maxDirIdentifierLength:
+			return 0
+		case len(id) > 8:
+			return 2
+		}
+		return 1
+	}
+	n := len(id)
+	if strings.Contains(id, ".") {
+		n-- // the separator between name and extension doesn't count
+	}
+	if !filenameSatisfiesISOConstraints(id) || strings.Count(id, ".") > 1 || n > maxFileIdentifierLength {
+		return 0
+	}
+	if name, ext, _ := splitIdentifier(id); len(name) > 8 || len(ext) > 3 {
+		return 2
+	}
+	return 1
+}
+
+// isoPath returns the slash-separated path of d as it is recorded, which
+// differs from its path for directories relocated to RR_MOVED.
+func (d *directoryEntry) isoPath() string {
+	if d.parent == nil {
+		return ""
+	}
+	return d.isoParent().isoPath() + "/" + d.isoName()
+}
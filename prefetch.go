@@ -0,0 +1,207 @@
+package iso9660wrap
+
+import (
+	"io"
+	"sync"
+)
+
+// prefetchChunkSize is the size of the buffers inputs are read ahead into.
+const prefetchChunkSize = 256 << 10
+
+// WithPrefetch has Finalize read inputs up to size bytes ahead of the data
+// it writes, on a separate goroutine, so that reading the next file
+// overlaps writing the current one.  This cuts the time to build images of
+// many large files when reading and writing each take a while, such as
+// from one disk to another.  Files whose contents are held in memory are
+// not read ahead.
+func WithPrefetch(size int) Option {
+	return func(o *options) {
+		o.prefetch = size
+	}
+}
+
+// prefetcher reads the inputs of an image ahead of their writing, in the
+// order they are written.
+type prefetcher struct {
+	files chan *prefetchedFile
+	// free holds the buffers that are not filled, which bounds how far
+	// the prefetcher reads ahead
+	free chan *[prefetchChunkSize]byte
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// prefetchedFile is the data of an input read ahead.
+type prefetchedFile struct {
+	f      *FileEntry
+	chunks chan prefetchChunk
+	// abort is closed when the rest of the data is not needed
+	abort chan struct{}
+}
+
+// prefetchChunk is a buffer filled with the data of an input, or holding
+// the error that ended it.
+type prefetchChunk struct {
+	buf *[prefetchChunkSize]byte
+	b   []byte
+	err error
+}
+
+// prefetchable reports whether the data of f is read ahead.
+func prefetchable(f *FileEntry) bool {
+	return f.shares == nil && !f.prior && f.contents == nil
+}
+
+// startPrefetch starts reading ahead the inputs of the layout l, reading at
+// most size bytes ahead.
+func startPrefetch(l *imageLayout, size int) *prefetcher {
+	buffers := (size + prefetchChunkSize - 1) / prefetchChunkSize
+	pf := &prefetcher{
+		files: make(chan *prefetchedFile, buffers),
+		free:  make(chan *[prefetchChunkSize]byte, buffers),
+		stop:  make(chan struct{}),
+	}
+	for i := 0; i < buffers; i++ {
+		pf.free <- chunkPool.Get().(*[prefetchChunkSize]byte)
+	}
+	pf.wg.Add(1)
+	go func() {
+		defer pf.wg.Done()
+		defer close(pf.files)
+		for _, d := range l.dirs {
+			for _, f := range d.files {
+				if !prefetchable(f) {
+					continue
+				}
+				file := &prefetchedFile{f: f, chunks: make(chan prefetchChunk, buffers), abort: make(chan struct{})}
+				select {
+				case pf.files <- file:
+				case <-pf.stop:
+					return
+				}
+				if !pf.read(file) {
+					return
+				}
+			}
+		}
+	}()
+	return pf
+}
+
+// read reads the input of file into chunks, reporting whether the
+// prefetcher should carry on.
+func (pf *prefetcher) read(file *prefetchedFile) bool {
+	defer close(file.chunks)
+	r, err := file.f.reader()
+	if err != nil {
+		select {
+		case file.chunks <- prefetchChunk{err: err}:
+		case <-pf.stop:
+			return false
+		}
+		return true
+	}
+	defer r.Close()
+	for {
+		var buf *[prefetchChunkSize]byte
+		select {
+		case buf = <-pf.free:
+		case <-file.abort:
+			return true
+		case <-pf.stop:
+			return false
+		}
+		n, err := io.ReadFull(r, buf[:])
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		// the chunks channel holds as many chunks as there are buffers,
+		// so this doesn't block
+		file.chunks <- prefetchChunk{buf: buf, b: buf[:n], err: err}
+		if err != nil {
+			return true
+		}
+	}
+}
+
+// close stops reading ahead, waiting until the inputs opened are closed,
+// and returns the buffers that are not in use to the pool.
+func (pf *prefetcher) close() {
+	close(pf.stop)
+	pf.wg.Wait()
+	for {
+		select {
+		case buf := <-pf.free:
+			chunkPool.Put(buf)
+		default:
+			return
+		}
+	}
+}
+
+// reader returns the data of f, which must be the next file written if
+// its data is read ahead.  pf may be nil if nothing is read ahead.
+func (pf *prefetcher) reader(f *FileEntry) (io.ReadCloser, error) {
+	if pf == nil || !prefetchable(f) {
+		return f.reader()
+	}
+	file, ok := <-pf.files
+	if !ok || file.f != f {
+		return nil, internalErrorf("file read ahead out of order")
+	}
+	return &prefetchReader{pf: pf, file: file}, nil
+}
+
+// prefetchReader reads the chunks of a file read ahead, returning each
+// buffer to the prefetcher once it is consumed.
+type prefetchReader struct {
+	pf   *prefetcher
+	file *prefetchedFile
+	cur  prefetchChunk
+	off  int
+	done bool
+}
+
+func (r *prefetchReader) Read(p []byte) (int, error) {
+	for r.off == len(r.cur.b) {
+		if r.cur.err != nil {
+			return 0, r.cur.err
+		}
+		r.release()
+		c, ok := <-r.file.chunks
+		if !ok {
+			// the prefetcher stopped before the end of the file
+			r.done = true
+			return 0, io.ErrUnexpectedEOF
+		}
+		r.cur, r.off = c, 0
+	}
+	n := copy(p, r.cur.b[r.off:])
+	r.off += n
+	return n, nil
+}
+
+// release returns the buffer of the current chunk to the prefetcher.
+func (r *prefetchReader) release() {
+	if r.cur.buf != nil {
+		r.pf.free <- r.cur.buf
+		r.cur.buf, r.cur.b = nil, nil
+		r.off = 0
+	}
+}
+
+// Close stops reading the file ahead and returns the buffers of the chunks
+// that were not read, so that the prefetcher moves on to the next file.
+func (r *prefetchReader) Close() error {
+	r.release()
+	if !r.done {
+		close(r.file.abort)
+		for c := range r.file.chunks {
+			if c.buf != nil {
+				r.pf.free <- c.buf
+			}
+		}
+		r.done = true
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPrefetch(t *testing.T) {
+	src := t.TempDir()
+	sizes := []int{0, 1, prefetchChunkSize - 1, prefetchChunkSize, prefetchChunkSize + 1, 3*prefetchChunkSize + 17}
+	for i, size := range sizes {
+		data := bytes.Repeat([]byte{byte('a' + i)}, size)
+		if err := ioutil.WriteFile(filepath.Join(src, fmt.Sprintf("FILE%d.BIN", i)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	build := func(opts ...Option) *ImageWriter {
+		t.Helper()
+		iw := NewImageWriter(append(opts, WithDeduplication(), WithTimestamp(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))...)
+		for i := range sizes {
+			if err := iw.AddFileAs(filepath.Join(src, fmt.Sprintf("FILE%d.BIN", i)), fmt.Sprintf("DISK/FILE%d.BIN", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// files held in memory and files sharing the data of another are
+		// not read ahead, but are written between those that are
+		big := bytes.Repeat([]byte("r"), 2*prefetchChunkSize+5)
+		if err := iw.AddReader("READER.BIN", int64(len(big)), bytes.NewReader(big)); err != nil {
+			t.Fatal(err)
+		}
+		if err := iw.AddBytes("MEMORY.TXT", []byte("memory")); err != nil {
+			t.Fatal(err)
+		}
+		if err := iw.AddFileAs(filepath.Join(src, "FILE5.BIN"), "COPY.BIN"); err != nil {
+			t.Fatal(err)
+		}
+		return iw
+	}
+	var want bytes.Buffer
+	if err := build().Finalize(&want); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, bytes.NewReader(want.Bytes()))
+	for _, size := range []int{1, prefetchChunkSize, 4 * prefetchChunkSize, 64 << 20} {
+		var got bytes.Buffer
+		if err := build(WithPrefetch(size)).Finalize(&got); err != nil {
+			t.Fatalf("prefetching %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("prefetching %d bytes changes the image", size)
+		}
+	}
+}
+
+// failingReader returns err once n bytes are read.
+type failingReader struct {
+	n   int
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, r.err
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestPrefetchErrors(t *testing.T) {
+	broken := errors.New("broken pipe")
+	iw := NewImageWriter(WithPrefetch(prefetchChunkSize))
+	if err := iw.AddBytes("A.TXT", []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddReader("B.BIN", 4*prefetchChunkSize, &failingReader{n: prefetchChunkSize + 3, err: broken}); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddReader("C.BIN", 4*prefetchChunkSize, io.LimitReader(zeroReader{}, 4*prefetchChunkSize)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- iw.Finalize(ioutil.Discard) }()
+	select {
+	case err := <-done:
+		var ie *InputError
+		if !errors.As(err, &ie) || ie.Path != "/B.BIN" || !errors.Is(err, broken) {
+			t.Errorf("Finalize returned %v, want the error reading B.BIN", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Finalize hangs after an input fails")
+	}
+}
@@ -0,0 +1,49 @@
+package iso9660wrap
+
+// Progress describes how much of an image has been written so far.
+type Progress struct {
+	// File is the path within the image of the file whose data is being
+	// written, or empty while the volume descriptors, path tables and
+	// directories are written.
+	File string
+
+	SectorsWritten uint32
+	TotalSectors   uint32
+	BytesWritten   int64
+}
+
+// progressInterval is the number of file data sectors written between two
+// progress reports for the same file.
+const progressInterval = 256
+
+// WithProgress sets a function that is called periodically while the image
+// is being written.  It is called from the goroutine writing the image, so it
+// should return quickly.
+func WithProgress(fn func(Progress)) Option {
+	return func(o *options) {
+		o.progress = fn
+	}
+}
+
+type progressReporter struct {
+	fn func(Progress)
+	w  *ISO9660Writer
+	// start is the first sector of the session written, which sectors
+	// are counted from
+	start uint32
+	total uint32
+}
+
+func (p *progressReporter) report(file string) {
+	if p.fn == nil {
+		return
+	}
+	// sectors are numbered from zero, and the reserved area counts
+	n := p.w.CurrentSector() + 1 - p.start
+	p.fn(Progress{
+		File:           file,
+		SectorsWritten: n,
+		TotalSectors:   p.total,
+		BytesWritten:   int64(n) * int64(SectorSize),
+	})
+}
@@ -0,0 +1,542 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	pathpkg "path"
+	"strings"
+	"time"
+)
+
+// ISOFileInfo describes a file or directory recorded in an ISO9660 image.
+type ISOFileInfo struct {
+	// Path is the slash-separated path of the entry within the image,
+	// without a leading slash.
+	Path string
+	// Size is the size of a file in bytes, summed over all its extents,
+	// or the size of the extent of a directory.
+	Size int64
+	// LBA is the sector the data of the entry starts at.
+	LBA uint32
+	// Flags are the file flags of the directory record.
+	Flags   byte
+	ModTime time.Time
+
+	// extents of the file, in order
+	extents []extent
+	// the Rock Ridge permissions, if hasPerm is set, and the target of a
+	// symbolic link, which a Reader exposing Rock Ridge names records
+	perm    os.FileMode
+	hasPerm bool
+	symlink string
+}
+
+// IsDir reports whether the entry is a directory.
+func (fi *ISOFileInfo) IsDir() bool {
+	return fi.Flags&fileFlagDirectory != 0
+}
+
+// Name returns the last element of the path of the entry.
+func (fi *ISOFileInfo) Name() string {
+	return pathpkg.Base(fi.Path)
+}
+
+// extent is a contiguous range of data of a file.
+type extent struct {
+	sector uint32
+	size   uint32
+}
+
+// Reader reads the directory tree and file contents of an ISO9660 image.
+type Reader struct {
+	r        io.ReaderAt
+	size     int64
+	volumeID string
+	root     ISOFileInfo
+	// session is the first sector of the session read
+	session uint32
+	// names are the names exposed
+	names NameSource
+	// suspSkip is the number of bytes to skip at the start of System Use
+	// fields
+	suspSkip int
+
+	maxDepth    int
+	memoryLimit int64
+}
+
+// ReaderOption is an option of NewReader.
+type ReaderOption func(*readerOptions)
+
+type readerOptions struct {
+	names       NameSource
+	maxDepth    int
+	memoryLimit int64
+}
+
+// NewReader returns a Reader for the image in r, which it reads the volume
+// descriptors of.  Unless opts say otherwise, the Reader exposes the Rock
+// Ridge or Joliet names of an image that records them.
+func NewReader(r io.ReaderAt, opts ...ReaderOption) (*Reader, error) {
+	return NewSessionReader(r, 0, opts...)
+}
+
+// NewSessionReader returns a Reader for the session of the multisession
+// image in r that starts at sector session, such as one written with
+// WithSessionStart.  NewReader reads the first session.
+func NewSessionReader(r io.ReaderAt, session uint32, opts ...ReaderOption) (*Reader, error) {
+	o := readerOptions{maxDepth: defaultMaxReadDepth, memoryLimit: defaultMemoryLimit}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	pvd, size, err := readSessionPVDInfo(r, session)
+	if err != nil {
+		return nil, err
+	}
+	sector := make([]byte, SectorSize)
+	if _, err := r.ReadAt(sector, pvd); err != nil {
+		return nil, err
+	}
+	if size < pvd+int64(SectorSize) {
+		return nil, fmt.Errorf("volume space of %d bytes ends before the primary volume descriptor", size)
+	} else if _, err := r.ReadAt(sector[:1], size-1); err != nil {
+		return nil, fmt.Errorf("image is shorter than its volume space of %d bytes: %w", size, err)
+	}
+	root, err := parseDirectoryRecord(sector[156:156+34], size)
+	if err != nil {
+		return nil, fmt.Errorf("root directory record: %w", err)
+	}
+	root.Path = ""
+	ir := &Reader{
+		r:        r,
+		size:     size,
+		volumeID: strings.TrimRight(string(sector[40:72]), " "),
+		root:     root,
+		session:  session,
+
+		maxDepth:    o.maxDepth,
+		memoryLimit: o.memoryLimit,
+	}
+	if err := ir.checkExtents(&ir.root); err != nil {
+		return nil, err
+	}
+	if err := ir.selectNames(o.names); err != nil {
+		return nil, err
+	}
+	return ir, nil
+}
+
+// selectNames sets up ir to expose the names of source.
+func (ir *Reader) selectNames(source NameSource) error {
+	switch source {
+	case BestNames, RockRidgeNames:
+		rr, err := ir.detectRockRidge()
+		if err != nil {
+			return err
+		} else if rr {
+			ir.names = RockRidgeNames
+			return nil
+		} else if source == RockRidgeNames {
+			return fmt.Errorf("image has no Rock Ridge names")
+		}
+		fallthrough
+	case JolietNames:
+		root, ok, err := ir.jolietRoot()
+		if err != nil {
+			return err
+		} else if ok {
+			if err := ir.checkExtents(&root); err != nil {
+				return err
+			}
+			ir.root, ir.names = root, JolietNames
+			return nil
+		} else if source == JolietNames {
+			return fmt.Errorf("image has no Joliet names")
+		}
+		ir.names = PrimaryNames
+	case PrimaryNames:
+		ir.names = PrimaryNames
+	default:
+		return fmt.Errorf("unknown name source %v", source)
+	}
+	return nil
+}
+
+// ReadImage returns a Reader for the image held in b, such as one already
+// in memory or an input of a fuzzer.
+func ReadImage(b []byte, opts ...ReaderOption) (*Reader, error) {
+	return NewReader(bytes.NewReader(b), opts...)
+}
+
+// List returns every file and directory of the image in r, in the order
+// Walk visits them, without reading the data of any file.  It is NewReader
+// followed by Walk for tools that just need to look at what an image holds.
+func List(r io.ReaderAt) ([]ISOFileInfo, error) {
+	ir, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	var entries []ISOFileInfo
+	err = ir.Walk(func(info ISOFileInfo) error {
+		entries = append(entries, info)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// VolumeID returns the volume identifier of the image.
+func (ir *Reader) VolumeID() string {
+	return ir.volumeID
+}
+
+// Walk calls fn for every file and directory in the image, visiting a
+// directory before its contents and the entries of a directory in the order
+// they are recorded.  The root directory itself is not visited.  Walk stops
+// at the first error fn returns, except that, as with fs.WalkDir, returning
+// fs.SkipDir for a directory skips its contents, and for a file skips the
+// remaining entries of its directory.
+func (ir *Reader) Walk(fn func(info ISOFileInfo) error) error {
+	err := ir.walk(&ir.root, "", fn, &walkState{visited: map[uint32]bool{}})
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// WalkISO calls fn with the path and description of every file and
+// directory in the image in r, like Reader.Walk.
+func WalkISO(r io.ReaderAt, fn func(path string, info ISOFileInfo) error) error {
+	ir, err := NewReader(r)
+	if err != nil {
+		return err
+	}
+	return ir.Walk(func(info ISOFileInfo) error {
+		return fn(info.Path, info)
+	})
+}
+
+// walkState tracks a Walk, so that a hostile image can't make it loop,
+// recurse without bounds or exhaust memory.
+type walkState struct {
+	// visited are the sectors of the directories read so far
+	visited map[uint32]bool
+	// depth is the number of levels of directories being read, and held
+	// the size of the directories whose entries are held
+	depth int
+	held  int64
+}
+
+func (ir *Reader) walk(dir *ISOFileInfo, prefix string, fn func(info ISOFileInfo) error, st *walkState) error {
+	if st.visited[dir.LBA] {
+		return fmt.Errorf("directory /%s at sector %d is recorded more than once", prefix, dir.LBA)
+	} else if st.depth == ir.maxDepth {
+		return fmt.Errorf("%w: directory /%s is nested deeper than %d levels", ErrLimitExceeded, prefix, ir.maxDepth)
+	}
+	entries, err := ir.readDir(dir, prefix, st.held)
+	if err != nil {
+		return err
+	}
+	st.visited[dir.LBA] = true
+	st.depth++
+	st.held += dir.Size
+	defer func() {
+		st.depth--
+		st.held -= dir.Size
+	}()
+	for i := range entries {
+		e := &entries[i]
+		if err := fn(*e); err == fs.SkipDir {
+			if e.IsDir() {
+				continue
+			}
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if e.IsDir() {
+			if err := ir.walk(e, e.Path, fn, st); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stat returns the entry at path, a slash-separated path within the image.
+// Names are matched the way the Reader exposes them: ISO9660 identifiers
+// without the version and the dot that ends names without an extension, or
+// the names of the extension Names returns.
+func (ir *Reader) Stat(path string) (ISOFileInfo, error) {
+	info := ir.root
+	for _, c := range splitPath(path) {
+		if !info.IsDir() {
+			return ISOFileInfo{}, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+		}
+		entries, err := ir.readDir(&info, info.Path, 0)
+		if err != nil {
+			return ISOFileInfo{}, err
+		}
+		found := false
+		for _, e := range entries {
+			if e.Name() == c && e.Flags&fileFlagAssociated == 0 {
+				info, found = e, true
+				break
+			}
+		}
+		if !found {
+			return ISOFileInfo{}, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+		}
+	}
+	return info, nil
+}
+
+// Open returns the contents of the file at path.
+func (ir *Reader) Open(path string) (*io.SectionReader, error) {
+	info, err := ir.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: path, Err: fmt.Errorf("is a directory")}
+	}
+	return ir.open(&info), nil
+}
+
+// OpenFile returns the contents of the file at path in the image in r,
+// reading them from r only as they are read, so that a file of any size can
+// be streamed out of an image without extracting it first.  The result also
+// implements io.ReaderAt.
+func OpenFile(r io.ReaderAt, path string) (io.ReadSeeker, error) {
+	ir, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return ir.Open(path)
+}
+
+func (ir *Reader) open(info *ISOFileInfo) *io.SectionReader {
+	return io.NewSectionReader(&extentReader{r: ir.r, extents: info.extents}, 0, info.Size)
+}
+
+// readDir returns the entries of the directory dir, whose path is prefix.
+// The records of a file recorded in several extents are combined into one
+// entry, and names are those of the extension the Reader exposes.  held is
+// the size of the directories whose entries are already held, which counts
+// against the memory limit.
+func (ir *Reader) readDir(dir *ISOFileInfo, prefix string, held int64) ([]ISOFileInfo, error) {
+	if dir.Size > ir.memoryLimit-held {
+		return nil, fmt.Errorf("%w: directory /%s of %d bytes exceeds the memory limit of %d bytes", ErrLimitExceeded, prefix, dir.Size, ir.memoryLimit)
+	}
+	data := make([]byte, dir.Size)
+	if _, err := ir.r.ReadAt(data, int64(dir.LBA)*int64(SectorSize)); err != nil {
+		return nil, fmt.Errorf("reading directory /%s: %w", prefix, err)
+	}
+	var entries []ISOFileInfo
+	continued := false
+	for p := 0; p < len(data); {
+		length := int(data[p])
+		if length == 0 {
+			// records don't cross sector boundaries
+			p = (p/int(SectorSize) + 1) * int(SectorSize)
+			continue
+		}
+		if p+length > len(data) {
+			return nil, fmt.Errorf("directory /%s: record at offset %d exceeds the directory", prefix, p)
+		}
+		b := data[p : p+length]
+		rec, err := parseDirectoryRecord(b, ir.size)
+		if err != nil {
+			return nil, fmt.Errorf("directory /%s: %w", prefix, err)
+		}
+		p += length
+		if rec.Path == "\x00" || rec.Path == "\x01" {
+			continue
+		}
+		var child uint32
+		switch ir.names {
+		case JolietNames:
+			rec.Path = decodeJoliet(string(b[33:33+int(b[32])]), rec.IsDir())
+		case RockRidgeNames:
+			rr, err := ir.rockRidge(b)
+			if err != nil {
+				return nil, fmt.Errorf("directory /%s: %w", prefix, err)
+			}
+			if rr.relocated {
+				continue
+			}
+			if rr.name != "" {
+				rec.Path = rr.name
+			}
+			child = rr.child
+			rec.perm, rec.hasPerm, rec.symlink = rr.perm, rr.hasPerm, rr.symlink
+		}
+		if rec.Path == "" || rec.Path == "." || rec.Path == ".." || strings.ContainsRune(rec.Path, '/') {
+			return nil, fmt.Errorf("directory /%s: invalid identifier %q", prefix, rec.Path)
+		}
+		if child != 0 {
+			rec.Path = pathpkg.Join(prefix, rec.Path)
+			perm, hasPerm := rec.perm, rec.hasPerm
+			if rec, err = ir.relocatedDir(rec, child); err != nil {
+				return nil, err
+			}
+			// the placeholder records the attributes of the directory
+			rec.perm, rec.hasPerm = perm, hasPerm
+			if err := ir.checkExtents(&rec); err != nil {
+				return nil, err
+			}
+			entries = append(entries, rec)
+			continue
+		}
+		if err := ir.checkExtents(&rec); err != nil {
+			return nil, err
+		}
+		if continued {
+			last := &entries[len(entries)-1]
+			last.extents = append(last.extents, rec.extents...)
+			last.Size += rec.Size
+			last.Flags = rec.Flags
+		} else {
+			rec.Path = pathpkg.Join(prefix, rec.Path)
+			entries = append(entries, rec)
+		}
+		continued = rec.Flags&fileFlagMultiExtent != 0
+	}
+	if continued {
+		return nil, fmt.Errorf("directory /%s: last extent of a file is missing", prefix)
+	}
+	return entries, nil
+}
+
+// checkExtents checks that the extents of info lie within the image.
+func (ir *Reader) checkExtents(info *ISOFileInfo) error {
+	for _, e := range info.extents {
+		if int64(e.sector)*int64(SectorSize)+int64(e.size) > ir.size {
+			return fmt.Errorf("extent of /%s at sector %d exceeds the image", info.Path, e.sector)
+		}
+	}
+	return nil
+}
+
+// parseDirectoryRecord parses the directory record b of an image of
+// imageSize bytes.  The Path of the result is the recorded identifier, with
+// the version and the dot ending a name without extension removed, or
+// "\x00" or "\x01" for the "." and ".." records.
+func parseDirectoryRecord(b []byte, imageSize int64) (ISOFileInfo, error) {
+	if len(b) < 34 || int(b[0]) > len(b) || 33+int(b[32]) > int(b[0]) {
+		return ISOFileInfo{}, fmt.Errorf("invalid directory record")
+	}
+	xarSectors := uint32(b[1])
+	sector := binary.LittleEndian.Uint32(b[2:])
+	size := binary.LittleEndian.Uint32(b[10:])
+	flags := b[25]
+	unitSize, gapSize := uint32(b[26]), uint32(b[27])
+	start := int64(sector) + int64(xarSectors)
+	if start*int64(SectorSize) > imageSize {
+		return ISOFileInfo{}, fmt.Errorf("extent at sector %d exceeds the image", start)
+	}
+	if unitSize != 0 && gapSize != 0 && size > 0 {
+		// the last file unit must start within the image, which bounds the
+		// number of extents of the file units
+		unit := int64(unitSize) * int64(SectorSize)
+		units := (int64(size) + unit - 1) / unit
+		if last := start + (units-1)*int64(unitSize+gapSize); last*int64(SectorSize) >= imageSize {
+			return ISOFileInfo{}, fmt.Errorf("interleaved extent at sector %d exceeds the image", start)
+		}
+	}
+	identifier := string(b[33 : 33+int(b[32])])
+	if identifier != "\x00" && identifier != "\x01" && flags&fileFlagDirectory == 0 {
+		if i := strings.LastIndexByte(identifier, ';'); i >= 0 {
+			identifier = identifier[:i]
+		}
+		identifier = strings.TrimSuffix(identifier, ".")
+	}
+	return ISOFileInfo{
+		Path:    identifier,
+		Size:    int64(size),
+		LBA:     sector + xarSectors,
+		Flags:   flags,
+		ModTime: parseRecordingTime(b[18:25]),
+		extents: interleavedExtents(sector+xarSectors, size, unitSize, gapSize),
+	}, nil
+}
+
+// interleavedExtents returns the extents of size bytes of data at sector,
+// which is recorded in file units of unitSize sectors separated by gaps of
+// gapSize sectors if both are set.
+func interleavedExtents(sector, size, unitSize, gapSize uint32) []extent {
+	if unitSize == 0 || gapSize == 0 {
+		return []extent{{sector: sector, size: size}}
+	}
+	var extents []extent
+	for unit := unitSize * SectorSize; ; sector += unitSize + gapSize {
+		if size <= unit {
+			return append(extents, extent{sector: sector, size: size})
+		}
+		extents = append(extents, extent{sector: sector, size: unit})
+		size -= unit
+	}
+}
+
+// parseRecordingTime parses the recording date and time of a directory
+// record.
+func parseRecordingTime(b []byte) time.Time {
+	loc := time.UTC
+	if offset := int(int8(b[6])); offset != 0 {
+		loc = time.FixedZone("", offset*15*60)
+	}
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, loc)
+}
+
+// extentReader reads the data of a file from its extents.
+type extentReader struct {
+	r       io.ReaderAt
+	extents []extent
+}
+
+func (er *extentReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, e := range er.extents {
+		if len(p) == 0 {
+			break
+		}
+		if off >= int64(e.size) {
+			off -= int64(e.size)
+			continue
+		}
+		chunk := p
+		if int64(len(chunk)) > int64(e.size)-off {
+			chunk = chunk[:int64(e.size)-off]
+		}
+		m, err := er.r.ReadAt(chunk, int64(e.sector)*int64(SectorSize)+off)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[m:]
+		off = 0
+	}
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// contiguous reports whether the extents of fi follow each other on the
+// image, each but the last filling whole sectors, so that they can be
+// recorded again as a single run of sectors.
+func (fi *ISOFileInfo) contiguous() bool {
+	for i := 1; i < len(fi.extents); i++ {
+		prev := fi.extents[i-1]
+		if prev.size%SectorSize != 0 || fi.extents[i].sector != prev.sector+prev.size/SectorSize {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,290 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// NameSource selects which of the names recorded in an image a Reader
+// exposes.
+type NameSource int
+
+const (
+	// BestNames uses Rock Ridge names if the image has them, Joliet names
+	// if it has those instead, and the ISO9660 identifiers otherwise.
+	BestNames NameSource = iota
+	// PrimaryNames uses the ISO9660 identifiers of the primary volume
+	// descriptor, such as 8.3 names, even if extensions record others.
+	PrimaryNames
+	// JolietNames uses the names of the Joliet supplementary volume
+	// descriptor.
+	JolietNames
+	// RockRidgeNames uses the names of the Rock Ridge NM entries, and shows
+	// relocated directories at their original place.
+	RockRidgeNames
+)
+
+var nameSourceNames = map[NameSource]string{
+	BestNames:      "best",
+	PrimaryNames:   "primary",
+	JolietNames:    "Joliet",
+	RockRidgeNames: "Rock Ridge",
+}
+
+func (s NameSource) String() string {
+	if name, ok := nameSourceNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("NameSource(%d)", int(s))
+}
+
+// UseNames makes the Reader expose the names of source.  By default it
+// exposes the best names the image has, as BestNames describes; asking for
+// Joliet or Rock Ridge names of an image that doesn't have them is an error.
+func UseNames(source NameSource) ReaderOption {
+	return func(o *readerOptions) {
+		o.names = source
+	}
+}
+
+// Names returns the names the Reader exposes, which is never BestNames.
+func (ir *Reader) Names() NameSource {
+	return ir.names
+}
+
+// jolietEscapes are the escape sequences of a supplementary volume descriptor
+// that mark it as Joliet, for UCS-2 levels 1 to 3.
+var jolietEscapes = []string{"%/@", "%/C", "%/E"}
+
+// jolietRoot returns the root directory record of the Joliet supplementary
+// volume descriptor, and whether the image has one.
+func (ir *Reader) jolietRoot() (ISOFileInfo, bool, error) {
+	sector := make([]byte, SectorSize)
+	for n := int64(ir.session) + int64(primaryVolumeSectorNum); ; n++ {
+		if _, err := ir.r.ReadAt(sector, n*int64(SectorSize)); err != nil {
+			return ISOFileInfo{}, false, fmt.Errorf("reading volume descriptor %d: %w", n, err)
+		}
+		if string(sector[1:6]) != standardIdentifier || sector[0] == 255 {
+			return ISOFileInfo{}, false, nil
+		}
+		if sector[0] != 2 {
+			continue
+		}
+		escapes := strings.TrimRight(string(sector[88:120]), "\x00")
+		for _, e := range jolietEscapes {
+			if escapes == e {
+				root, err := parseDirectoryRecord(sector[156:156+34], ir.size)
+				if err != nil {
+					return ISOFileInfo{}, false, fmt.Errorf("Joliet root directory record: %w", err)
+				}
+				root.Path = ""
+				return root, true, nil
+			}
+		}
+	}
+}
+
+// decodeJoliet decodes the UCS-2 identifier of a Joliet directory record,
+// dropping the version of a file name.
+func decodeJoliet(identifier string, dir bool) string {
+	b := []byte(identifier)
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	name := string(utf16.Decode(u))
+	if !dir {
+		if i := strings.LastIndexByte(name, ';'); i >= 0 {
+			name = name[:i]
+		}
+	}
+	return name
+}
+
+// systemUse returns the System Use field of the directory record b, less
+// the bytes SUSP says to skip.
+func (ir *Reader) systemUse(b []byte) []byte {
+	start := 33 + int(b[32])
+	if b[32]%2 == 0 {
+		start++
+	}
+	start += ir.suspSkip
+	if start >= len(b) {
+		return nil
+	}
+	return b[start:]
+}
+
+// maxContinuationAreas bounds the number of continuation areas followed
+// for a single directory record.
+const maxContinuationAreas = 16
+
+// suspEntries calls fn with the signature and data of every System Use
+// entry in su, following CE entries into continuation areas.
+func (ir *Reader) suspEntries(su []byte, fn func(signature string, data []byte)) error {
+	for areas := 0; ; areas++ {
+		var ce []byte
+		for len(su) >= 4 {
+			length := int(su[2])
+			if length < 4 || length > len(su) {
+				break
+			}
+			signature, data := string(su[:2]), su[4:length]
+			if signature == "ST" {
+				break
+			} else if signature == "CE" && len(data) >= 24 {
+				ce = data
+			} else {
+				fn(signature, data)
+			}
+			su = su[length:]
+		}
+		if ce == nil {
+			return nil
+		} else if areas == maxContinuationAreas {
+			return fmt.Errorf("too many System Use continuation areas")
+		}
+		sector := binary.LittleEndian.Uint32(ce)
+		offset := binary.LittleEndian.Uint32(ce[8:])
+		length := binary.LittleEndian.Uint32(ce[16:])
+		if offset >= SectorSize || length > SectorSize-offset {
+			return fmt.Errorf("invalid System Use continuation area at sector %d", sector)
+		}
+		su = make([]byte, length)
+		if _, err := ir.r.ReadAt(su, int64(sector)*int64(SectorSize)+int64(offset)); err != nil {
+			return fmt.Errorf("reading System Use continuation area at sector %d: %w", sector, err)
+		}
+	}
+}
+
+// detectRockRidge reports whether the "." record of the root directory
+// starts with an SP entry, and records the number of bytes it says to skip.
+func (ir *Reader) detectRockRidge() (bool, error) {
+	b := make([]byte, 255)
+	if _, err := ir.r.ReadAt(b, int64(ir.root.LBA)*int64(SectorSize)); err != nil {
+		return false, fmt.Errorf("reading the root directory: %w", err)
+	}
+	if int(b[0]) < 34 || 33+int(b[32]) > int(b[0]) {
+		return false, nil
+	}
+	su := ir.systemUse(b[:b[0]])
+	if len(su) < 7 || string(su[:2]) != "SP" || su[4] != 0xBE || su[5] != 0xEF {
+		return false, nil
+	}
+	ir.suspSkip = int(su[6])
+	return true, nil
+}
+
+// rockRidgeEntry holds what the Rock Ridge entries of a directory record say
+// about its name and place.
+type rockRidgeEntry struct {
+	name string
+	// relocated is set for a directory moved to RR_MOVED, which is shown
+	// at its original place instead.
+	relocated bool
+	// child is the sector of the relocated directory a placeholder file
+	// stands for, or 0.
+	child uint32
+	// perm holds the permission bits of the PX entry, if hasPerm is set.
+	perm    os.FileMode
+	hasPerm bool
+	// symlink is the target of a symbolic link.
+	symlink string
+}
+
+// rockRidge returns the Rock Ridge entries of directory record b.
+func (ir *Reader) rockRidge(b []byte) (rockRidgeEntry, error) {
+	var rr rockRidgeEntry
+	var name, link strings.Builder
+	hasName, continued := false, true
+	// a component of the link continues in the next one unless sep is
+	// set, and the link in the next SL entry unless linkDone is
+	sep, linkDone := false, false
+	err := ir.suspEntries(ir.systemUse(b), func(signature string, data []byte) {
+		switch signature {
+		case "NM":
+			if len(data) < 1 || !continued {
+				return
+			}
+			// current and parent flags stand for "." and ".."
+			if data[0]&0x06 == 0 {
+				name.Write(data[1:])
+				hasName = true
+			}
+			continued = data[0]&0x01 != 0
+		case "PX":
+			if len(data) >= 4 {
+				rr.perm, rr.hasPerm = posixPerm(binary.LittleEndian.Uint32(data)), true
+			}
+		case "SL":
+			if len(data) < 1 || linkDone {
+				return
+			}
+			for c := data[1:]; len(c) >= 2 && 2+int(c[1]) <= len(c); c = c[2+int(c[1]):] {
+				if c[0]&slRoot != 0 {
+					link.WriteByte('/')
+					sep = false
+					continue
+				}
+				if sep {
+					link.WriteByte('/')
+				}
+				switch {
+				case c[0]&slCurrent != 0:
+					link.WriteString(".")
+				case c[0]&slParent != 0:
+					link.WriteString("..")
+				default:
+					link.Write(c[2 : 2+int(c[1])])
+				}
+				sep = c[0]&0x01 == 0
+			}
+			linkDone = data[0]&0x01 == 0
+		case "RE":
+			rr.relocated = true
+		case "CL":
+			if len(data) >= 4 {
+				rr.child = binary.LittleEndian.Uint32(data)
+			}
+		}
+	})
+	if hasName {
+		rr.name = name.String()
+	}
+	rr.symlink = link.String()
+	return rr, err
+}
+
+// posixPerm returns the permission bits of the POSIX file mode m, along
+// with the setuid, setgid and sticky bits.
+func posixPerm(m uint32) os.FileMode {
+	perm := os.FileMode(m & 0777)
+	if m&04000 != 0 {
+		perm |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		perm |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		perm |= os.ModeSticky
+	}
+	return perm
+}
+
+// relocatedDir returns the entry for the relocated directory at sector,
+// which a placeholder file rec stands for.
+func (ir *Reader) relocatedDir(rec ISOFileInfo, sector uint32) (ISOFileInfo, error) {
+	b := make([]byte, 255)
+	if _, err := ir.r.ReadAt(b, int64(sector)*int64(SectorSize)); err != nil {
+		return ISOFileInfo{}, fmt.Errorf("reading relocated directory %s: %w", rec.Path, err)
+	}
+	dot, err := parseDirectoryRecord(b[:b[0]], ir.size)
+	if err != nil || dot.Path != "\x00" || dot.LBA != sector {
+		return ISOFileInfo{}, fmt.Errorf("relocated directory %s at sector %d has no valid \".\" record", rec.Path, sector)
+	}
+	dot.Path = rec.Path
+	return dot, nil
+}
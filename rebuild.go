@@ -0,0 +1,135 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Rebuild writes to w a new image holding the contents of the existing
+// ISO9660 image in r, with the changes patch makes to the ImageWriter it is
+// passed.  Files that patch adds replace those of the existing image, as
+// with AddImage.  The volume identifiers and the boot catalog of the
+// existing image are carried over; opts are applied on top of the
+// identifiers, so they can still be changed.  The system area, such as a
+// hybrid MBR, is not carried over and must be requested again with opts.
+// Boot images must be files of the existing image, and those holding a boot
+// info table get a fresh one.
+func Rebuild(w io.Writer, r io.ReaderAt, patch func(iw *ImageWriter) error, opts ...Option) error {
+	volumeOpts, err := readVolumeOptions(r)
+	if err != nil {
+		return err
+	}
+	iw := NewImageWriter(append(volumeOpts, opts...)...)
+	if err := iw.AddImage(r, "/"); err != nil {
+		return err
+	}
+	if err := iw.addImageBoot(r); err != nil {
+		return err
+	}
+	if patch != nil {
+		if err := patch(iw); err != nil {
+			return err
+		}
+	}
+	return iw.Finalize(w)
+}
+
+// InjectFile writes to w a copy of the existing image in r in which the
+// local file at localPath is added as isoPath, replacing the file there if
+// there is one, such as to drop a kickstart file into installer media.  It
+// is Rebuild with a patch calling AddFileAs.
+func InjectFile(w io.Writer, r io.ReaderAt, localPath, isoPath string, opts ...Option) error {
+	return Rebuild(w, r, func(iw *ImageWriter) error {
+		return iw.AddFileAs(localPath, isoPath)
+	}, opts...)
+}
+
+// readVolumeOptions returns the options setting the identifiers recorded in
+// the primary volume descriptor of the image in r.
+func readVolumeOptions(r io.ReaderAt) ([]Option, error) {
+	pvd, _, err := readPVDInfo(r)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, SectorSize)
+	if _, err := r.ReadAt(b, pvd); err != nil {
+		return nil, err
+	}
+	field := func(offset, length int) string {
+		return strings.TrimRight(string(b[offset:offset+length]), " \x00")
+	}
+	return []Option{
+		WithSystemID(field(8, 32)),
+		WithVolumeID(field(40, 32)),
+		WithVolumeSetID(field(190, 128)),
+		WithPublisherID(field(318, 128)),
+		WithDataPreparerID(field(446, 128)),
+		WithApplicationID(field(574, 128)),
+		WithCopyrightFileID(field(702, 37)),
+		WithAbstractFileID(field(739, 37)),
+		WithBibliographicFileID(field(776, 37)),
+	}, nil
+}
+
+// addImageBoot adds the boot images of the boot catalog of the image in r,
+// which AddImage has added the files of to the root directory.
+func (iw *ImageWriter) addImageBoot(r io.ReaderAt) error {
+	ir, err := NewReader(r, UseNames(PrimaryNames))
+	if err != nil {
+		return err
+	}
+	images, err := ir.BootImages()
+	if err != nil || len(images) == 0 {
+		return err
+	}
+	files := map[uint32]ISOFileInfo{}
+	err = ir.Walk(func(info ISOFileInfo) error {
+		if _, ok := files[info.LBA]; !ok && !info.IsDir() && info.Size > 0 {
+			files[info.LBA] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, b := range images {
+		info, ok := files[b.LBA]
+		if !ok {
+			return fmt.Errorf("boot image at sector %d is not a file of the image", b.LBA)
+		}
+		opts := []BootOption{Platform(b.Platform), Emulate(b.Media)}
+		if b.LoadSegment != 0 {
+			opts = append(opts, LoadSegment(b.LoadSegment))
+		}
+		if b.Media == NoEmulation && b.LoadSize != 0 {
+			opts = append(opts, LoadSize(b.LoadSize))
+		}
+		table, err := hasBootInfoTable(ir, &info)
+		if err != nil {
+			return err
+		} else if table {
+			opts = append(opts, BootInfoTable())
+		}
+		if err := iw.AddBootImage(info.Path, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasBootInfoTable reports whether the boot image info holds a boot info
+// table describing it.
+func hasBootInfoTable(ir *Reader, info *ISOFileInfo) (bool, error) {
+	if info.Size < bootInfoTableEnd {
+		return false, nil
+	}
+	table := make([]byte, 12)
+	if _, err := ir.open(info).ReadAt(table, 8); err != nil {
+		return false, fmt.Errorf("reading boot image %s: %w", info.Path, err)
+	}
+	return binary.LittleEndian.Uint32(table) == primaryVolumeSectorNum &&
+		binary.LittleEndian.Uint32(table[4:]) == info.LBA &&
+		binary.LittleEndian.Uint32(table[8:]) == uint32(info.Size), nil
+}
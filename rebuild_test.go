@@ -0,0 +1,127 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// vendorImage returns a bootable image with a boot info table, standing in
+// for installer media.
+func vendorImage(t *testing.T) []byte {
+	t.Helper()
+	iw := NewImageWriter(WithVolumeID("VENDOR_DVD"), WithPublisherID("VENDOR"))
+	for name, data := range map[string]string{
+		"ISOLINUX/ISOLINUX.BIN": strings.Repeat("isolinux", 1000),
+		"README.TXT":            "vendor readme",
+		"KS.CFG":                "vendor kickstart",
+	} {
+		if err := iw.AddBytes(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := iw.AddBootImage("ISOLINUX/ISOLINUX.BIN", LoadSize(4), BootInfoTable()); err != nil {
+		t.Fatal(err)
+	}
+	return writeImage(t, iw)
+}
+
+func TestRebuild(t *testing.T) {
+	vendor := vendorImage(t)
+	var buf bytes.Buffer
+	err := Rebuild(&buf, bytes.NewReader(vendor), func(iw *ImageWriter) error {
+		// the big file moves the boot image
+		if err := iw.AddBytes("AAA/BIG.BIN", make([]byte, 1<<20)); err != nil {
+			return err
+		}
+		return iw.AddBytes("README.TXT", []byte("patched readme"))
+	}, WithApplicationID("REBUILT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img := buf.Bytes()
+	checkValid(t, bytes.NewReader(img))
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := readTree(t, ir)
+	if tree["README.TXT"] != "patched readme" || tree["KS.CFG"] != "vendor kickstart" || len(tree["AAA/BIG.BIN"]) != 1<<20 {
+		t.Errorf("rebuilt image holds README.TXT %q, KS.CFG %q and %d bytes of AAA/BIG.BIN", tree["README.TXT"], tree["KS.CFG"], len(tree["AAA/BIG.BIN"]))
+	}
+
+	// the identifiers are carried over, with opts applied on top
+	pvd := img[primaryVolumeSectorNum*SectorSize:]
+	for _, f := range []struct {
+		offset, length int
+		want           string
+	}{
+		{40, 32, "VENDOR_DVD"},
+		{318, 128, "VENDOR"},
+		{574, 128, "REBUILT"},
+	} {
+		if got := strings.TrimRight(string(pvd[f.offset:f.offset+f.length]), " "); got != f.want {
+			t.Errorf("field at offset %d is %q, want %q", f.offset, got, f.want)
+		}
+	}
+
+	// the boot image gets a fresh boot info table at its new sector
+	info, err := ir.Stat("ISOLINUX/ISOLINUX.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := ReadImage(vendor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldInfo, err := old.Stat("ISOLINUX/ISOLINUX.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.LBA == oldInfo.LBA {
+		t.Fatalf("boot image stayed at sector %d", info.LBA)
+	}
+	images, err := ir.BootImages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 1 || images[0].LBA != info.LBA || images[0].LoadSize != 4 {
+		t.Errorf("boot catalog holds %+v, want the boot image at sector %d", images, info.LBA)
+	}
+	if got := binary.LittleEndian.Uint32([]byte(tree["ISOLINUX/ISOLINUX.BIN"])[12:]); got != info.LBA {
+		t.Errorf("boot info table gives sector %d, want %d", got, info.LBA)
+	}
+}
+
+func TestInjectFile(t *testing.T) {
+	vendor := vendorImage(t)
+	ks := filepath.Join(t.TempDir(), "ks.cfg")
+	if err := ioutil.WriteFile(ks, []byte("local kickstart"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := InjectFile(&buf, bytes.NewReader(vendor), ks, "KS.CFG"); err != nil {
+		t.Fatal(err)
+	}
+	checkValid(t, bytes.NewReader(buf.Bytes()))
+	if err := InjectFile(ioutil.Discard, bytes.NewReader(vendor), ks+".missing", "KS.CFG"); err == nil {
+		t.Error("InjectFile of a missing file succeeded")
+	}
+	ir, err := ReadImage(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := readTree(t, mustReadImage(t, vendor))
+	want["KS.CFG"] = "local kickstart"
+	got := readTree(t, ir)
+	// the boot info table of the copy describes the copy
+	delete(got, "ISOLINUX/ISOLINUX.BIN")
+	delete(want, "ISOLINUX/ISOLINUX.BIN")
+	compareTrees(t, "ReadImage", got, want)
+	if images, err := ir.BootImages(); err != nil || len(images) != 1 {
+		t.Errorf("boot catalog of the copy holds %v: %v", images, err)
+	}
+}
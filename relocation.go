@@ -0,0 +1,125 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// maxDirectoryDepth is the number of levels ISO9660 permits in the directory
+// hierarchy, counting the root directory as the first.
+const maxDirectoryDepth = 8
+
+const (
+	rrMovedIdentifier = "RR_MOVED"
+	rrMovedName       = "rr_moved"
+)
+
+// relocate moves directories nested deeper than ISO9660 permits into a
+// RR_MOVED directory in the root, as RRIP 4.1.5 specifies, and undoes the
+// relocation of a previous layout first.  Readers that support Rock Ridge
+// show relocated directories at their original place; others find them in
+// RR_MOVED.  Without Rock Ridge, deep directories are recorded where they
+// are, which many readers tolerate.
+func (iw *ImageWriter) relocate() error {
+	root := iw.root
+	if moved := root.rrMoved; moved != nil {
+		for _, sub := range moved.subdirs {
+			sub.movedTo = nil
+		}
+		for i, sub := range root.subdirs {
+			if sub == moved {
+				root.subdirs = append(root.subdirs[:i], root.subdirs[i+1:]...)
+				break
+			}
+		}
+		root.rrMoved = nil
+	}
+	if !iw.rockRidge {
+		return nil
+	}
+
+	var moved []*directoryEntry
+	var walk func(d *directoryEntry, depth int)
+	walk = func(d *directoryEntry, depth int) {
+		for _, sub := range d.subdirs {
+			subDepth := depth + 1
+			if subDepth > maxDirectoryDepth {
+				moved = append(moved, sub)
+				subDepth = 3 // root, RR_MOVED and sub
+			}
+			walk(sub, subDepth)
+		}
+	}
+	walk(root, 1)
+	if len(moved) == 0 {
+		return nil
+	}
+
+	if root.lookup(rrMovedIdentifier) {
+		return fmt.Errorf("/%s already exists in the image, but deep directories need to be relocated to it", rrMovedIdentifier)
+	}
+	rrMoved := &directoryEntry{name: rrMovedIdentifier, origName: rrMovedName, parent: root}
+	for i, sub := range moved {
+		sub.movedTo = rrMoved
+		sub.movedName = strconv.Itoa(i + 1)
+	}
+	rrMoved.subdirs = moved
+	root.subdirs = append(root.subdirs, rrMoved)
+	root.rrMoved = rrMoved
+	return nil
+}
+
+// isoParent returns the directory d is recorded in, which is its parent
+// unless d was relocated.  The root directory is its own parent.
+func (d *directoryEntry) isoParent() *directoryEntry {
+	if d.movedTo != nil {
+		return d.movedTo
+	} else if d.parent == nil {
+		return d
+	}
+	return d.parent
+}
+
+// isoName returns the identifier d is recorded under in its ISO9660 parent.
+func (d *directoryEntry) isoName() string {
+	if d.movedTo != nil {
+		return d.movedName
+	}
+	return d.name
+}
+
+// childName returns the identifier of the subdirectory sub within d.
+func (d *directoryEntry) childName(sub *directoryEntry) string {
+	if sub.movedTo == d {
+		return sub.movedName
+	}
+	return sub.name
+}
+
+// isoSubdirs returns the subdirectories recorded in d, which exclude those
+// relocated to RR_MOVED.
+func (d *directoryEntry) isoSubdirs() []*directoryEntry {
+	var subdirs []*directoryEntry
+	for _, sub := range d.subdirs {
+		if sub.movedTo == nil || sub.movedTo == d {
+			subdirs = append(subdirs, sub)
+		}
+	}
+	return subdirs
+}
+
+// rrCL returns a CL entry pointing at the relocated directory at sector.
+func rrCL(sector uint32) []byte {
+	return suspEntry("CL", bothEndianDWord(sector))
+}
+
+// rrPL returns a PL entry pointing at the original parent directory at
+// sector.
+func rrPL(sector uint32) []byte {
+	return suspEntry("PL", bothEndianDWord(sector))
+}
+
+// rrRE returns the RE entry that marks a relocated directory.
+func rrRE() []byte {
+	return suspEntry("RE")
+}
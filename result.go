@@ -0,0 +1,116 @@
+package iso9660wrap
+
+import (
+	"crypto/sha256"
+	"hash"
+	"io"
+)
+
+// Result describes an image once it has been written.
+type Result struct {
+	// Size is the size of the image in bytes.
+	Size int64
+
+	// SHA256 is the SHA-256 digest of the image if WithSHA256 was given,
+	// and nil otherwise.
+	SHA256 []byte
+
+	// VolumeID is the volume identifier recorded in the image, such as one
+	// derived with WithContentVolumeID.
+	VolumeID string
+
+	// Sectors is the number of sectors of the image, which for a session
+	// set with WithSessionStart counts that session alone.
+	Sectors uint32
+
+	// Padding is the number of bytes of zeros that fill up the last
+	// sectors of files and the interleave gaps between their file units.
+	Padding int64
+
+	// Files describes where the data of every file was placed, directory
+	// by directory in path table order.
+	Files []FileResult
+}
+
+// FileResult describes where the data of a file was placed in an image.
+type FileResult struct {
+	// Path is the path of the file in the image, made of the identifiers
+	// recorded in the directories.
+	Path string
+
+	// LBA is the first sector of the data, and Size its length in bytes.
+	// Files larger than an extent are recorded in several extents, which
+	// follow each other.
+	LBA  uint32
+	Size int64
+
+	// Shared is set if the data is that of another file, or of the
+	// previous session, so that it takes up no sectors of its own.
+	Shared bool
+}
+
+// WithResult sets a Result to fill in once the image has been written
+// successfully.  It lets the package level functions such as WriteFiles
+// report on the image they wrote.
+func WithResult(r *Result) Option {
+	return func(o *options) {
+		o.result = r
+	}
+}
+
+// WithSHA256 computes the SHA-256 digest of the image as it is written and
+// records it in the Result set with WithResult, which saves reading a large
+// image back to checksum it.
+func WithSHA256() Option {
+	return func(o *options) {
+		o.sha256 = true
+	}
+}
+
+// resultWriter counts and optionally hashes the bytes written to w.
+type resultWriter struct {
+	w    io.Writer
+	n    int64
+	hash hash.Hash
+}
+
+func newResultWriter(w io.Writer, o *options) *resultWriter {
+	rw := &resultWriter{w: w}
+	if o.sha256 {
+		rw.hash = sha256.New()
+	}
+	return rw
+}
+
+func (rw *resultWriter) Write(p []byte) (int, error) {
+	n, err := rw.w.Write(p)
+	rw.n += int64(n)
+	if rw.hash != nil {
+		rw.hash.Write(p[:n])
+	}
+	return n, err
+}
+
+// fill records the outcome of the write of the image laid out as l in the
+// Result set with WithResult.
+func (rw *resultWriter) fill(o *options, l *imageLayout) {
+	if o.result == nil {
+		return
+	}
+	r := Result{Size: rw.n, VolumeID: l.volumeID, Sectors: l.numSectors - l.sessionStart}
+	if rw.hash != nil {
+		r.SHA256 = rw.hash.Sum(nil)
+	}
+	for _, d := range l.dirs {
+		for _, f := range d.files {
+			fr := FileResult{Path: d.path() + "/" + f.Name, LBA: f.sector + f.xarSectors(), Size: f.Size}
+			if f.shares != nil || f.prior {
+				fr.Shared = true
+			} else {
+				r.Padding += f.dataSectors()*int64(SectorSize) - f.Size
+			}
+			r.Files = append(r.Files, fr)
+		}
+	}
+	*o.result = r
+}
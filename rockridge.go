@@ -0,0 +1,186 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+)
+
+// Rock Ridge is recorded as RRIP 1.10 ("RRIP_1991A") on top of SUSP 1.10,
+// using System Use entries appended to the directory records.
+
+const (
+	rrDefaultFileMode uint32 = 0100444 // regular file, r--r--r--
+	rrDefaultDirMode  uint32 = 040555  // directory, r-xr-xr-x
+	rrSymlinkMode     uint32 = 0120777 // symbolic link, rwxrwxrwx
+)
+
+const (
+	rrExtensionID         = "RRIP_1991A"
+	rrExtensionDescriptor = "THE ROCK RIDGE INTERCHANGE PROTOCOL PROVIDES SUPPORT FOR POSIX FILE SYSTEM SEMANTICS"
+)
+
+// WithRockRidge records Rock Ridge extensions in every directory record, so
+// that systems supporting them see each file and directory under its name
+// exactly as it was given, regardless of the ISO9660 identifier it was
+// recorded as, along with POSIX file modes.
+func WithRockRidge() Option {
+	return func(o *options) {
+		o.rockRidge = true
+	}
+}
+
+// suspEntry returns a System Use entry with the given signature and data.
+func suspEntry(signature string, data ...[]byte) []byte {
+	length := 4
+	for _, d := range data {
+		length += len(d)
+	}
+	e := make([]byte, 0, length)
+	e = append(e, signature[0], signature[1], byte(length), 1)
+	for _, d := range data {
+		e = append(e, d...)
+	}
+	return e
+}
+
+// suspSP returns the SP entry that marks the use of SUSP, telling readers
+// to skip the first skip bytes of every System Use field.  It must be the
+// first entry of the "." record of the root directory.
+func suspSP(skip byte) []byte {
+	return suspEntry("SP", []byte{0xBE, 0xEF, skip})
+}
+
+// suspER returns the ER entry identifying the Rock Ridge extensions.
+func suspER() []byte {
+	return suspEntry("ER",
+		[]byte{byte(len(rrExtensionID)), byte(len(rrExtensionDescriptor)), 0, 1},
+		[]byte(rrExtensionID),
+		[]byte(rrExtensionDescriptor))
+}
+
+// rrPX returns a PX entry holding POSIX file attributes.
+func rrPX(mode, nlink, uid, gid uint32) []byte {
+	return suspEntry("PX", bothEndianDWord(mode), bothEndianDWord(nlink),
+		bothEndianDWord(uid), bothEndianDWord(gid))
+}
+
+// rrNM returns an NM entry holding the alternate name of a file.
+func rrNM(name string) []byte {
+	return suspEntry("NM", []byte{0}, []byte(name))
+}
+
+func bothEndianDWord(v uint32) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, v)
+	binary.BigEndian.PutUint32(b[4:], v)
+	return b
+}
+
+// posixAttributes holds the attributes recorded in a PX entry, other than
+// the number of links.
+type posixAttributes struct {
+	mode     os.FileMode
+	uid, gid uint32
+}
+
+// POSIXAttributes sets the mode, owner and group that Rock Ridge records for
+// the file.  Only the permission bits of mode, along with the setuid, setgid
+// and sticky bits, are used.
+func POSIXAttributes(mode os.FileMode, uid, gid uint32) FileOption {
+	return func(f *FileEntry) {
+		f.posix = &posixAttributes{mode, uid, gid}
+	}
+}
+
+// WithSourcePermissions makes AddFile, AddFileAs and AddFS record the
+// permission bits of their sources in Rock Ridge PX entries, along with the
+// owner and group on Unix systems, instead of read-only permissions owned
+// by root.  It has no effect without WithRockRidge.
+func WithSourcePermissions() Option {
+	return func(o *options) {
+		o.sourcePermissions = true
+	}
+}
+
+// sourceAttributes returns the POSIX attributes of the source described by
+// fi, if they are to be recorded.
+func (o *options) sourceAttributes(fi os.FileInfo) *posixAttributes {
+	if !o.sourcePermissions {
+		return nil
+	}
+	uid, gid := fileOwner(fi)
+	return &posixAttributes{fi.Mode(), uid, gid}
+}
+
+// px returns the PX entry for a file of type typ with attributes a.
+func (a *posixAttributes) px(typ uint32, nlink uint32) []byte {
+	mode := typ | uint32(a.mode.Perm())
+	if a.mode&os.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if a.mode&os.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if a.mode&os.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return rrPX(mode, nlink, a.uid, a.gid)
+}
+
+// rrDirAttributes returns the PX entry of directory d.
+func (d *directoryEntry) rrDirAttributes() []byte {
+	nlink := uint32(2 + len(d.subdirs))
+	if d.posix != nil {
+		return d.posix.px(0040000, nlink)
+	}
+	return rrPX(rrDefaultDirMode, nlink, 0, 0)
+}
+
+// rrAttributes returns the PX entry of file f, followed by an SL entry if f
+// is a symbolic link.
+func (f *FileEntry) rrAttributes() []byte {
+	if f.symlink != "" {
+		return append(rrPX(rrSymlinkMode, 1, 0, 0), rrSL(f.symlink)...)
+	}
+	if f.posix != nil {
+		return f.posix.px(0100000, 1)
+	}
+	return rrPX(rrDefaultFileMode, 1, 0, 0)
+}
+
+// SL component flags.
+const (
+	slCurrent = 1 << 1
+	slParent  = 1 << 2
+	slRoot    = 1 << 3
+)
+
+// rrSL returns an SL entry holding the slash-separated symbolic link
+// target.
+func rrSL(target string) []byte {
+	var components []byte
+	if strings.HasPrefix(target, "/") {
+		components = append(components, slRoot, 0)
+	}
+	for _, c := range strings.Split(target, "/") {
+		switch c {
+		case "":
+			continue
+		case ".":
+			components = append(components, slCurrent, 0)
+		case "..":
+			components = append(components, slParent, 0)
+		default:
+			components = append(components, 0, byte(len(c)))
+			components = append(components, c...)
+		}
+	}
+	return suspEntry("SL", []byte{0}, components)
+}
+
+// rrSystemUse returns the Rock Ridge entries of the record for a file or
+// directory called name, with POSIX attributes px.
+func rrSystemUse(name string, px []byte) []byte {
+	return append(rrNM(name), px...)
+}
@@ -0,0 +1,56 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// seedFile is a file of a configuration seed image.
+type seedFile struct {
+	path string
+	data []byte
+	// optional files are left out when data is nil
+	optional bool
+	json     bool
+}
+
+// writeSeed writes a configuration seed image labelled volumeID and holding
+// files to w.
+func writeSeed(w io.Writer, kind, volumeID string, files []seedFile, opts []Option) error {
+	iw, err := newSeed(kind, volumeID, files, opts)
+	if err != nil {
+		return err
+	}
+	return iw.Finalize(w)
+}
+
+// newSeed returns an ImageWriter for a configuration seed image labelled
+// volumeID and holding files.  The consumers of such images look for exact
+// lower-case file names, so Rock Ridge records the names for Linux, and the
+// ISO9660 names are kept as close to them as readers without Rock Ridge
+// support allow.  opts apply on top of these settings.
+func newSeed(kind, volumeID string, files []seedFile, opts []Option) (*ImageWriter, error) {
+	iw := NewImageWriter(append([]Option{
+		WithVolumeID(volumeID),
+		WithPreserveCase(),
+		WithRelaxedNames(),
+		WithRockRidge(),
+	}, opts...)...)
+	for _, f := range files {
+		if f.data == nil && f.optional {
+			continue
+		}
+		if len(bytes.TrimSpace(f.data)) == 0 {
+			return nil, fmt.Errorf("%s %s is empty", kind, f.path)
+		}
+		if f.json && !json.Valid(f.data) {
+			return nil, fmt.Errorf("%s %s is not valid JSON", kind, f.path)
+		}
+		if err := iw.AddBytes(f.path, f.data); err != nil {
+			return nil, err
+		}
+	}
+	return iw, nil
+}
@@ -0,0 +1,44 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"io"
+)
+
+// WithSessionStart writes the image as a session of a multisession medium
+// that starts at sector start, as mkisofs -C does.  Every sector number
+// recorded in the image counts from the start of the medium, and the volume
+// space covers the earlier sessions as well, but only the new session is
+// written: its first byte belongs at byte offset start*SectorSize of the
+// medium.  Combine it with AddPreviousSession to keep the files of the
+// earlier sessions.  A session can't have a hybrid partition table, since
+// the system area of the medium belongs to the first session, and can't be
+// checked with WithVerify on its own.
+func WithSessionStart(start uint32) Option {
+	return func(o *options) {
+		o.sessionStart = start
+	}
+}
+
+// AddPreviousSession schedules the files and directories of the session
+// starting at sector start of the multisession medium in r for inclusion in
+// the new session set with WithSessionStart, as mkisofs -M does.  The
+// directory records of the new session point at the data of these files
+// where the previous session recorded it, so it is not written again.
+// Files added to the new session replace those of the previous session, and
+// like with AddImage entries can be left out with WithExclude, which removes
+// them from the new session.  Of the data of the previous session, only the
+// master boot record of a boot image emulating a hard disk is read.
+func (iw *ImageWriter) AddPreviousSession(r io.ReaderAt, start uint32) error {
+	ir, err := NewSessionReader(r, start, UseNames(PrimaryNames))
+	if err != nil {
+		return fmt.Errorf("previous session at sector %d: %w", start, err)
+	}
+	if err := iw.addImage(ir, "/", true); err != nil {
+		return err
+	}
+	if end := uint32(ir.size / int64(SectorSize)); end > iw.previousEnd {
+		iw.previousEnd = end
+	}
+	return nil
+}
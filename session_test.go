@@ -0,0 +1,72 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMultisession(t *testing.T) {
+	first := NewImageWriter()
+	for name, data := range map[string]string{
+		"A.TXT":     "first a",
+		"DIR/B.TXT": "first b",
+		"OLD.TXT":   "old",
+	} {
+		if err := first.AddBytes(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	medium := writeImage(t, first)
+	// the new session starts after a gap, as it does on recordable media
+	next := uint32(len(medium))/SectorSize + 150
+
+	second := NewImageWriter(WithSessionStart(next), WithExclude("OLD.TXT"))
+	if err := second.AddPreviousSession(bytes.NewReader(medium), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.AddBytes("A.TXT", []byte("second a")); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.AddBytes("C.TXT", []byte("second c")); err != nil {
+		t.Fatal(err)
+	}
+	var session bytes.Buffer
+	if err := second.Finalize(&session); err != nil {
+		t.Fatal(err)
+	}
+	medium = append(append(medium, make([]byte, int(next)*int(SectorSize)-len(medium))...), session.Bytes()...)
+
+	ir, err := NewSessionReader(bytes.NewReader(medium), next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTrees(t, "second session", readTree(t, ir), map[string]string{
+		"A.TXT":     "second a",
+		"C.TXT":     "second c",
+		"DIR/":      "",
+		"DIR/B.TXT": "first b",
+	})
+	// the data of the first session is not written again
+	if info, err := ir.Stat("DIR/B.TXT"); err != nil || info.LBA >= next {
+		t.Errorf("DIR/B.TXT of the second session is at sector %d, want it in the first session: %v", info.LBA, err)
+	}
+	if info, err := ir.Stat("C.TXT"); err != nil || info.LBA < next {
+		t.Errorf("C.TXT of the second session is at sector %d, want it in the second session: %v", info.LBA, err)
+	}
+	// the first session is unchanged
+	ir, err = NewReader(bytes.NewReader(medium))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTrees(t, "first session", readTree(t, ir), map[string]string{
+		"A.TXT":     "first a",
+		"DIR/":      "",
+		"DIR/B.TXT": "first b",
+		"OLD.TXT":   "old",
+	})
+
+	if err := NewImageWriter(WithSessionStart(next)).AddPreviousSession(bytes.NewReader(medium), 20); err == nil || !strings.HasPrefix(err.Error(), "previous session at sector 20: ") {
+		t.Errorf("AddPreviousSession of a session that isn't there returned %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// WithSparse has Finalize seek over sectors holding nothing but zeros
+// instead of writing them, when the output is a regular *os.File, which
+// leaves holes in the file on file systems that support them.  Images of
+// padded or preallocated payloads then take up only the disk space of their
+// data.  Only sectors beyond the size the file has when Finalize starts are
+// skipped, so the previous contents of a file that is not truncated can't
+// show through.  Other outputs are written as usual.
+func WithSparse() Option {
+	return func(o *options) {
+		o.sparse = true
+	}
+}
+
+// sparseWriter writes to f, seeking over whole sectors of zeros past the
+// end of the file.
+type sparseWriter struct {
+	f *os.File
+	// off is the offset of the next byte written, and size the size of
+	// the file before writing started
+	off  int64
+	size int64
+	// skipped is set if the last sector written was skipped
+	skipped bool
+}
+
+// newSparseWriter returns a sparseWriter for f, or nil if f is not a
+// regular file.
+func newSparseWriter(f *os.File) (*sparseWriter, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	} else if !fi.Mode().IsRegular() {
+		return nil, nil
+	}
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	return &sparseWriter{f: f, off: off, size: fi.Size()}, nil
+}
+
+func (s *sparseWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// sectors are those of the file, to match its blocks
+		chunk := p
+		if rem := int64(SectorSize) - s.off%int64(SectorSize); int64(len(chunk)) > rem {
+			chunk = chunk[:rem]
+		}
+		if len(chunk) == int(SectorSize) && s.off >= s.size && bytes.Equal(chunk, zeroSector[:]) {
+			if _, err := s.f.Seek(int64(SectorSize), io.SeekCurrent); err != nil {
+				return n, err
+			}
+			s.skipped = true
+		} else {
+			m, err := s.f.Write(chunk)
+			n += m
+			s.off += int64(m)
+			if err != nil {
+				return n, err
+			}
+			s.skipped = false
+			p = p[m:]
+			continue
+		}
+		n += len(chunk)
+		s.off += int64(len(chunk))
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// finish extends the file over the sectors skipped at its end.
+func (s *sparseWriter) finish() error {
+	if s.skipped {
+		return s.f.Truncate(s.off)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package iso9660wrap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSparse(t *testing.T) {
+	const zeros = 16 << 20
+	build := func(opts ...Option) *ImageWriter {
+		iw := NewImageWriter(append(opts, WithTimestamp(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)))...)
+		if err := iw.AddReader("ZERO.BIN", zeros, io.LimitReader(zeroReader{}, zeros)); err != nil {
+			t.Fatal(err)
+		}
+		if err := iw.AddBytes("DATA.TXT", []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+		return iw
+	}
+	var want bytes.Buffer
+	if err := build().Finalize(&want); err != nil {
+		t.Fatal(err)
+	}
+
+	iso := filepath.Join(t.TempDir(), "image.iso")
+	f, err := os.Create(iso)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := build(WithSparse()).Finalize(f); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != int64(want.Len()) {
+		t.Fatalf("sparse image is %d bytes, want %d", fi.Size(), want.Len())
+	}
+	if used := fi.Sys().(*syscall.Stat_t).Blocks * 512; used > zeros/2 {
+		t.Errorf("sparse image of %d bytes takes up %d bytes", fi.Size(), used)
+	}
+	if got, err := ioutil.ReadFile(iso); err != nil || !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("sparse image differs from the image written to a buffer: %v", err)
+	}
+	checkValid(t, f)
+
+	// the sectors of zeros within a file that is not truncated overwrite
+	// what it held
+	dirty := filepath.Join(t.TempDir(), "dirty.iso")
+	if err := ioutil.WriteFile(dirty, bytes.Repeat([]byte{0xFF}, want.Len()+int(SectorSize)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err = os.OpenFile(dirty, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := build(WithSparse()).Finalize(f); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(dirty); err != nil || !bytes.Equal(got[:want.Len()], want.Bytes()) {
+		t.Errorf("image written over an old file differs from the image written to a buffer: %v", err)
+	}
+
+	// other outputs are written as usual
+	var buf bytes.Buffer
+	if err := build(WithSparse()).Finalize(&buf); err != nil || !bytes.Equal(buf.Bytes(), want.Bytes()) {
+		t.Errorf("sparse image written to a buffer differs: %v", err)
+	}
+}
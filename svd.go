@@ -0,0 +1,332 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// SupplementaryVolume describes a supplementary volume descriptor, which
+// records a second directory hierarchy of the same files under names of a
+// character set of its own, the way Joliet records UCS-2 names.  The writer
+// places the descriptor after the primary volume descriptor and the boot
+// record, and its path tables and directories after those of the primary
+// volume; file data is shared by both hierarchies.
+type SupplementaryVolume struct {
+	// EscapeSequences identify the character set of the descriptor to
+	// readers, such as "%/E" for Joliet UCS-2 level 3, in up to 32 bytes.
+	EscapeSequences string
+
+	// Flags is the volume flags field, whose bit 0 is set if the escape
+	// sequences are not registered according to ISO 2375.
+	Flags byte
+
+	// EncodeName returns the identifier recorded for an entry added under
+	// name, such as "Résumé.txt", including the version of a file if
+	// readers expect one.  dir is set for directories.
+	EncodeName func(name string, dir bool) (string, error)
+
+	// EncodeID, if set, returns the length bytes of a field of the
+	// descriptor, such as the volume identifier, that hold id.  Otherwise
+	// fields are recorded as in the primary volume descriptor.
+	EncodeID func(id string, length int) []byte
+
+	// enhanced makes the descriptor an enhanced volume descriptor.
+	enhanced bool
+}
+
+// WithSupplementaryVolume adds a supplementary volume descriptor described
+// by v to the image.  It may be given several times, and the descriptors
+// are recorded in that order.
+func WithSupplementaryVolume(v SupplementaryVolume) Option {
+	return func(o *options) {
+		o.svds = append(o.svds, v)
+	}
+}
+
+// svdLayout describes where the hierarchy of a supplementary volume is
+// placed.
+type svdLayout struct {
+	v      *SupplementaryVolume
+	sector uint32
+	// dirs holds every directory in path table order, starting with the
+	// root directory.
+	dirs []*svdDir
+
+	pathTableSize    uint32
+	lPathTableSector uint32
+	mPathTableSector uint32
+}
+
+// svdDir is a directory of the hierarchy of a supplementary volume.
+type svdDir struct {
+	d      *directoryEntry
+	name   string
+	parent *svdDir
+	// subdirs are sorted by their identifiers
+	subdirs []*svdDir
+	number  uint16
+	sector  uint32
+	size    uint32
+}
+
+// layoutSupplementaryVolumes builds the directory hierarchies of the
+// supplementary volumes, whose descriptors follow the last volume
+// descriptor of l so far.
+func (iw *ImageWriter) layoutSupplementaryVolumes(l *imageLayout) error {
+	l.svds = nil
+	for i := range iw.svds {
+		v := &svdLayout{v: &iw.svds[i], sector: l.terminatorSector}
+		l.terminatorSector++
+		if v.v.EncodeName == nil {
+			return fmt.Errorf("supplementary volume %d has no name encoding", i+1)
+		} else if len(v.v.EscapeSequences) > 32 {
+			return fmt.Errorf("escape sequences %q of supplementary volume %d are longer than 32 bytes", v.v.EscapeSequences, i+1)
+		}
+		v.dirs = []*svdDir{{d: iw.root, name: "\x00"}}
+		for j := 0; j < len(v.dirs); j++ {
+			if j >= math.MaxUint16 {
+				return fmt.Errorf("image has more than %d directories", math.MaxUint16)
+			}
+			dir := v.dirs[j]
+			dir.number = uint16(j + 1)
+			for _, sub := range dir.d.subdirs {
+				if sub == iw.root.rrMoved {
+					// relocated directories are recorded at their place
+					continue
+				}
+				name, err := v.v.EncodeName(sub.origName, true)
+				if err != nil {
+					return fmt.Errorf("directory %s: %w", sub.path(), err)
+				}
+				dir.subdirs = append(dir.subdirs, &svdDir{d: sub, name: name, parent: dir})
+			}
+			sort.SliceStable(dir.subdirs, func(a, b int) bool {
+				return dir.subdirs[a].name < dir.subdirs[b].name
+			})
+			v.dirs = append(v.dirs, dir.subdirs...)
+		}
+		l.svds = append(l.svds, v)
+	}
+	return nil
+}
+
+// placePathTables places the path tables of v from sector on, returning
+// the sector following them.
+func (v *svdLayout) placePathTables(sector int64) int64 {
+	v.pathTableSize = 0
+	for _, d := range v.dirs {
+		v.pathTableSize += 8 + uint32(len(d.name)+len(d.name)%2)
+	}
+	n := numDataSectors(int64(v.pathTableSize))
+	v.lPathTableSector = uint32(sector)
+	v.mPathTableSector = uint32(sector + n)
+	return sector + 2*n
+}
+
+// placeDirs places the directories of v from sector on, returning the
+// sector following them.
+func (v *svdLayout) placeDirs(sector int64, o *options) (int64, error) {
+	for _, d := range v.dirs {
+		recs, err := d.records(o, v.v)
+		if err != nil {
+			return 0, err
+		}
+		for _, r := range recs {
+			if r.length() > 255 {
+				return 0, fmt.Errorf("directory record for %q in %s is too long for the supplementary volume", r.identifier, d.d.path()+"/")
+			}
+		}
+		d.size = directoryExtentSize(recs)
+		d.sector = uint32(sector)
+		sector += int64(d.size / SectorSize)
+	}
+	return sector, nil
+}
+
+// record returns a record pointing at d's extent under identifier.
+func (d *svdDir) record(identifier string) directoryRecord {
+	return directoryRecord{identifier: identifier, sector: d.sector, size: d.size, flags: fileFlagDirectory}
+}
+
+// records returns the records of d's directory extent, sorted by their
+// identifiers after the "." and ".." entries.
+func (d *svdDir) records(o *options, v *SupplementaryVolume) ([]directoryRecord, error) {
+	parent := d.parent
+	if parent == nil {
+		parent = d
+	}
+	dot, dotdot := d.record("\x00"), parent.record("\x01")
+	dot.recorded = o.inZone(o.entryTime(d.d.modTime))
+	dotdot.recorded = o.inZone(o.entryTime(parent.d.modTime))
+
+	var recs []directoryRecord
+	for _, sub := range d.subdirs {
+		r := sub.record(sub.name)
+		r.recorded = o.inZone(o.entryTime(sub.d.modTime))
+		recs = append(recs, r)
+	}
+	for _, f := range d.d.files {
+		name, err := v.EncodeName(f.origName, false)
+		if err != nil {
+			return nil, fmt.Errorf("file %s/%s: %w", d.d.path(), f.origName, err)
+		}
+		for _, r := range f.records(o) {
+			r.identifier = name
+			recs = append(recs, r)
+		}
+	}
+	// the records of a file in several extents stay in order
+	sort.SliceStable(recs, func(i, j int) bool {
+		return recs[i].identifier < recs[j].identifier
+	})
+	for i := 1; i < len(recs); i++ {
+		if recs[i].identifier == recs[i-1].identifier && recs[i-1].flags&fileFlagMultiExtent == 0 {
+			return nil, fmt.Errorf("directory %s/ has several entries with the identifier %q in the supplementary volume", d.d.path(), recs[i].identifier)
+		}
+	}
+	return append([]directoryRecord{dot, dotdot}, recs...), nil
+}
+
+// pathTable returns the path table of v.
+func (v *svdLayout) pathTable(bo binary.ByteOrder) []byte {
+	var buf bytes.Buffer
+	b := make([]byte, 4)
+	for _, d := range v.dirs {
+		parent := d.parent
+		if parent == nil {
+			parent = d
+		}
+		buf.WriteByte(byte(len(d.name)))
+		buf.WriteByte(0) // number of sectors in extended attribute record
+		bo.PutUint32(b, d.sector)
+		buf.Write(b)
+		bo.PutUint16(b, parent.number)
+		buf.Write(b[:2])
+		buf.WriteString(d.name)
+		if len(d.name)%2 == 1 {
+			buf.WriteByte(0) // padding
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeSupplementaryVolumeDescriptor writes the descriptor of v, whose
+// fields follow those of the primary volume descriptor.
+func writeSupplementaryVolumeDescriptor(w *ISO9660Writer, o *options, l *imageLayout, v *svdLayout, now time.Time) error {
+	sw := w.NextSector()
+	if w.CurrentSector() != v.sector {
+		return internalErrorf("unexpected supplementary volume sector %d (expected %d)", w.CurrentSector(), v.sector)
+	}
+	field := func(id string, length int) {
+		if v.v.EncodeID != nil {
+			b := make([]byte, length)
+			copy(b, v.v.EncodeID(id, length))
+			sw.Write(b)
+		} else {
+			sw.WritePaddedString(id, uint32(length))
+		}
+	}
+
+	// enhanced volume descriptors and their file structure are of version 2
+	version := byte(1)
+	if v.v.enhanced {
+		version = 2
+	}
+
+	sw.WriteByte('\x02')
+	sw.WriteString(standardIdentifier)
+	sw.WriteByte(version)
+	sw.WriteByte(v.v.Flags)
+
+	field(o.systemID, 32)
+	field(l.volumeID, 32)
+
+	sw.WriteZeros(8)
+	sw.WriteBothEndianDWord(l.numSectors)
+	sw.Write([]byte(v.v.EscapeSequences))
+	sw.WriteZeros(32 - len(v.v.EscapeSequences))
+
+	size, sequence := o.volumeSet()
+	sw.WriteBothEndianWord(size)
+	sw.WriteBothEndianWord(sequence)
+	sw.WriteBothEndianWord(uint16(SectorSize))
+	sw.WriteBothEndianDWord(v.pathTableSize)
+
+	sw.WriteLittleEndianDWord(v.lPathTableSector)
+	sw.WriteLittleEndianDWord(0) // no secondary path tables
+	sw.WriteBigEndianDWord(v.mPathTableSector)
+	sw.WriteBigEndianDWord(0) // no secondary path tables
+
+	rootRecord := v.dirs[0].record("\x00")
+	rootRecord.volume = sequence
+	rootRecord.write(sw, now)
+
+	field(o.volumeSetID, 128)
+	field(o.publisherID, 128)
+	field(o.dataPreparerID, 128)
+	field(o.applicationID, 128)
+
+	field(l.copyrightFileID, 37)
+	field(l.abstractFileID, 37)
+	field(l.bibliographicFileID, 37)
+
+	sw.WriteDateTime(now)         // volume creation
+	sw.WriteDateTime(now)         // most recent modification
+	sw.WriteUnspecifiedDateTime() // expires
+	sw.WriteUnspecifiedDateTime() // is effective (?)
+
+	sw.WriteByte(version) // file structure version
+	sw.WriteByte('\x00')  // reserved
+
+	sw.PadWithZeros()
+	return nil
+}
+
+// writeSupplementaryPathTables writes the path tables of the supplementary
+// volumes of l.
+func writeSupplementaryPathTables(w *ISO9660Writer, l *imageLayout) error {
+	for _, v := range l.svds {
+		if w.CurrentSector()+1 != v.lPathTableSector {
+			return internalErrorf("unexpected path table sector %d (expected %d)", w.CurrentSector()+1, v.lPathTableSector)
+		}
+		writeBytes(w, v.pathTable(binary.LittleEndian))
+		if w.CurrentSector()+1 != v.mPathTableSector {
+			return internalErrorf("unexpected path table sector %d (expected %d)", w.CurrentSector()+1, v.mPathTableSector)
+		}
+		writeBytes(w, v.pathTable(binary.BigEndian))
+	}
+	return nil
+}
+
+// writeSupplementaryDirectories writes the directories of the
+// supplementary volumes of l.
+func writeSupplementaryDirectories(w *ISO9660Writer, o *options, l *imageLayout, now time.Time) error {
+	_, volume := o.volumeSet()
+	for _, v := range l.svds {
+		for _, d := range v.dirs {
+			sw := w.NextSector()
+			if w.CurrentSector() != d.sector {
+				return internalErrorf("unexpected directory sector %d (expected %d)", w.CurrentSector(), d.sector)
+			}
+			recs, err := d.records(o, v.v)
+			if err != nil {
+				return err
+			}
+			for _, r := range recs {
+				if r.length() > sw.RemainingSpace() {
+					sw = w.NextSector()
+				}
+				r.volume = volume
+				r.write(sw, now)
+			}
+			if last := d.sector + d.size/SectorSize - 1; w.CurrentSector() != last {
+				return internalErrorf("unexpected last directory sector %d (expected %d)", w.CurrentSector(), last)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// maxSymlinkDepth is the number of nested symbolic links to directories
+// followed before AddFS gives up, like the ELOOP limit of Linux.
+const maxSymlinkDepth = 40
+
+// SymlinkPolicy selects what AddFS does with symbolic links.
+type SymlinkPolicy int
+
+const (
+	// SymlinkFollow adds the file or directory a link points to in place
+	// of the link.
+	SymlinkFollow SymlinkPolicy = iota
+	// SymlinkRecord records links as Rock Ridge symbolic links, which
+	// requires WithRockRidge.
+	SymlinkRecord
+	// SymlinkSkip leaves links out of the image, reporting each to the
+	// function set with WithSymlinkWarning.
+	SymlinkSkip
+	// SymlinkError fails on the first link.
+	SymlinkError
+)
+
+// WithSymlinkPolicy sets what AddFS, AddTree and AddFileList do with
+// symbolic links.  The default is SymlinkFollow.  Recording links requires a
+// file system that can read them, such as the result of os.DirFS since Go
+// 1.25; AddTree always can.
+func WithSymlinkPolicy(p SymlinkPolicy) Option {
+	return func(o *options) {
+		o.symlinks = p
+	}
+}
+
+// WithSymlinkWarning sets a function that is called with the path in the
+// image and the target of every symbolic link that SymlinkSkip leaves out.
+// Skipped links are also reported to the Logger set with WithLogger.
+func WithSymlinkWarning(fn func(name, target string)) Option {
+	return func(o *options) {
+		o.symlinkWarning = fn
+	}
+}
+
+// applySymlinkPolicy applies the symlink policy to the link that would
+// become name in the image, whose target readTarget returns.  It reports
+// whether it dealt with the link, or whether the link should be followed.
+func (iw *ImageWriter) applySymlinkPolicy(name string, readTarget func() (string, error)) (bool, error) {
+	switch iw.symlinks {
+	case SymlinkSkip:
+		target, err := readTarget()
+		if err != nil {
+			// an unreadable target is merely missing from the report
+			target = ""
+		}
+		iw.logf("skipping symbolic link %s -> %s", name, target)
+		if iw.symlinkWarning != nil {
+			iw.symlinkWarning(name, target)
+		}
+		return true, nil
+	case SymlinkError:
+		return true, fmt.Errorf("%s is a symbolic link", name)
+	case SymlinkRecord:
+		target, err := readTarget()
+		if err != nil {
+			return true, err
+		}
+		return true, iw.AddSymlink(name, target)
+	}
+	return false, nil
+}
+
+// AddSymlink records a symbolic link called name that points at target.
+// Symbolic links are only visible through Rock Ridge, which must be enabled
+// with WithRockRidge; other readers see an empty file.
+func (iw *ImageWriter) AddSymlink(name, target string) error {
+	if !iw.rockRidge {
+		return fmt.Errorf("symbolic link %s requires Rock Ridge", name)
+	}
+	if target == "" {
+		return fmt.Errorf("symbolic link %s has an empty target", name)
+	}
+	return iw.add(name, 0, func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(nil)), nil
+	}, func(f *FileEntry) {
+		f.symlink = target
+	})
+}
+
+// readLink returns the target of the symbolic link name in fsys.
+func readLink(fsys fs.FS, name string) (string, error) {
+	rfs, ok := fsys.(interface {
+		ReadLink(name string) (string, error)
+	})
+	if !ok {
+		return "", fmt.Errorf("can not read symbolic link %s: file system does not support it", name)
+	}
+	target, err := rfs.ReadLink(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(target), nil
+}
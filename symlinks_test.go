@@ -0,0 +1,119 @@
+package iso9660wrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// symlinkTree returns a local directory with links to a file, to a
+// directory and to itself.
+func symlinkTree(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.Mkdir(filepath.Join(src, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"file.txt": "file", "dir/inner.txt": "inner"} {
+		if err := ioutil.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range map[string]string{"tofile": "file.txt", "todir": "dir", "dir/up": ".."} {
+		if err := os.Symlink(target, filepath.Join(src, filepath.FromSlash(name))); err != nil {
+			t.Skip(err)
+		}
+	}
+	return src
+}
+
+func TestSymlinkPolicies(t *testing.T) {
+	src := symlinkTree(t)
+
+	t.Run("record", func(t *testing.T) {
+		iw := NewImageWriter(WithRockRidge(), WithSymlinkPolicy(SymlinkRecord))
+		if err := iw.AddTree(src, "/"); err != nil {
+			t.Fatal(err)
+		}
+		ir, err := ReadImage(writeImage(t, iw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir := extractDir(t)
+		if err := ir.Extract(dir, 0); err != nil {
+			t.Fatal(err)
+		}
+		for name, want := range map[string]string{"tofile": "file.txt", "todir": "dir", "dir/up": ".."} {
+			if got, err := os.Readlink(filepath.Join(dir, filepath.FromSlash(name))); err != nil || filepath.ToSlash(got) != want {
+				t.Errorf("%s links to %q: %v", name, got, err)
+			}
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(dir, "todir", "inner.txt")); err != nil || string(b) != "inner" {
+			t.Errorf("todir/inner.txt holds %q: %v", b, err)
+		}
+
+		if err := NewImageWriter(WithSymlinkPolicy(SymlinkRecord)).AddTree(src, "/"); err == nil || !strings.Contains(err.Error(), "requires Rock Ridge") {
+			t.Errorf("recording links without Rock Ridge returned %v", err)
+		}
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		skipped := map[string]string{}
+		iw := NewImageWriter(WithRockRidge(), WithSymlinkPolicy(SymlinkSkip), WithSymlinkWarning(func(name, target string) {
+			skipped[strings.TrimPrefix(name, "/")] = target
+		}))
+		if err := iw.AddTree(src, "/"); err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]string{"tofile": "file.txt", "todir": "dir", "dir/up": ".."}; !reflect.DeepEqual(skipped, want) {
+			t.Errorf("skipped %v, want %v", skipped, want)
+		}
+		ir, err := ReadImage(writeImage(t, iw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareTrees(t, "skip", readTree(t, ir), map[string]string{
+			"dir/":          "",
+			"dir/inner.txt": "inner",
+			"file.txt":      "file",
+		})
+	})
+
+	t.Run("error", func(t *testing.T) {
+		iw := NewImageWriter(WithSymlinkPolicy(SymlinkError))
+		if err := iw.AddTree(src, "/"); err == nil || !strings.Contains(err.Error(), "is a symbolic link") {
+			t.Errorf("AddTree with links returned %v", err)
+		}
+	})
+
+	t.Run("follow", func(t *testing.T) {
+		// dir/up loops back to the top, so following it gives up after
+		// maxSymlinkDepth links
+		iw := NewImageWriter(WithRockRidge())
+		if err := iw.AddTree(src, "/"); err == nil || !strings.Contains(err.Error(), "too many levels of symbolic links") {
+			t.Errorf("AddTree of a looping tree returned %v", err)
+		}
+		if err := os.Remove(filepath.Join(src, "dir", "up")); err != nil {
+			t.Fatal(err)
+		}
+		iw = NewImageWriter(WithRockRidge())
+		if err := iw.AddTree(src, "/"); err != nil {
+			t.Fatal(err)
+		}
+		ir, err := ReadImage(writeImage(t, iw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		compareTrees(t, "follow", readTree(t, ir), map[string]string{
+			"dir/":            "",
+			"dir/inner.txt":   "inner",
+			"file.txt":        "file",
+			"tofile":          "file",
+			"todir/":          "",
+			"todir/inner.txt": "inner",
+		})
+	})
+}
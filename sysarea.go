@@ -0,0 +1,103 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// systemAreaSize is the size of the system area, the 16 sectors at the
+// start of the image that ISO9660 leaves unused.
+const systemAreaSize = 16 * SectorSize
+
+// mbrBootCodeSize is the amount of boot code that fits in front of the
+// boot image address isohybrid boot code expects at offset 432.
+const mbrBootCodeSize = 432
+
+// hybridPartitionType is the type of the partition a hybrid MBR records
+// for the ISO9660 file system, as isohybrid writes it.
+const hybridPartitionType = 0x17
+
+// WithHybridMBR records a master boot record in the system area, so that
+// the image can also be written to a USB stick and booted from it, like
+// images processed with isohybrid.  The MBR holds a single bootable
+// partition that spans the whole image.  bootCode, such as syslinux'
+// isohdpfx.bin, may be up to 432 bytes long; it is followed by the address
+// of the first BIOS boot image in 512 byte blocks, which is where isohybrid
+// boot code looks for it.
+func WithHybridMBR(bootCode []byte) Option {
+	return func(o *options) {
+		o.hybridMBR = true
+		o.mbrBootCode = bootCode
+	}
+}
+
+// WithSystemArea writes data, of up to 32 KiB, to the start of the system
+// area instead of zeros, such as a vendor MBR or signature, as mkisofs -G
+// does.  The partition tables of WithHybridMBR, WithHybridGPT and WithAPM
+// are written over it.
+func WithSystemArea(data []byte) Option {
+	return func(o *options) {
+		o.systemAreaData = data
+	}
+}
+
+// systemArea returns the contents of the system area.
+func (iw *ImageWriter) systemArea(l *imageLayout, now time.Time) ([]byte, error) {
+	area := make([]byte, systemAreaSize)
+	copy(area, iw.systemAreaData)
+	if iw.hybridMBR {
+		copy(area, iw.mbrBootCode)
+		for _, b := range iw.boot {
+			if b.platform == PlatformBIOS {
+				binary.LittleEndian.PutUint64(area[432:], uint64(b.file.sector+b.file.xarSectors())*4)
+				break
+			}
+		}
+		writeMBRPartition(area, 0, 0x80, hybridPartitionType, 0, uint64(l.numSectors)*4)
+		area[510], area[511] = 0x55, 0xAA
+	}
+	if err := iw.writeAPM(area, l); err != nil {
+		return nil, err
+	}
+	if iw.hybridGPT {
+		if err := iw.writeGPT(area, l, now); err != nil {
+			return nil, err
+		}
+	}
+	return area, nil
+}
+
+// writeMBRPartition writes entry i of the partition table of the MBR in
+// area, for a partition of the given type of size 512 byte blocks starting
+// at block start.
+func writeMBRPartition(area []byte, i int, status, typ byte, start, size uint64) {
+	if start+size > 0xFFFFFFFF {
+		// as large as the entry can describe
+		size = 0xFFFFFFFF - start
+	}
+	e := area[446+16*i : 446+16*(i+1)]
+	e[0] = status
+	copy(e[1:4], chs(start))
+	e[4] = typ
+	end := start + size
+	if size > 0 {
+		end--
+	}
+	copy(e[5:8], chs(end))
+	binary.LittleEndian.PutUint32(e[8:], uint32(start))
+	binary.LittleEndian.PutUint32(e[12:], uint32(size))
+}
+
+// chs returns the cylinder, head and sector address of block lba in the
+// geometry of 64 heads and 32 sectors per track that isohybrid uses, or the
+// largest address if lba is beyond it.
+func chs(lba uint64) []byte {
+	const heads, sectors = 64, 32
+	c := lba / (heads * sectors)
+	if c > 1023 {
+		return []byte{0xFE, 0xFF, 0xFF}
+	}
+	h := (lba / sectors) % heads
+	s := lba%sectors + 1
+	return []byte{byte(h), byte(s) | byte(c>>8)<<6, byte(c)}
+}
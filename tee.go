@@ -0,0 +1,70 @@
+package iso9660wrap
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// FinalizeAll is like Finalize, but writes the image to every one of
+// outputs at once, such as a local file and a network stream, and returns
+// the size and the SHA-256 digest of what each of them took, so that copies
+// can be checked without reading them back.  The image is built only once,
+// and writing stops as soon as one of outputs fails.
+func (iw *ImageWriter) FinalizeAll(outputs ...io.Writer) ([]Result, error) {
+	return iw.FinalizeAllContext(context.Background(), outputs...)
+}
+
+// FinalizeAllContext is like FinalizeAll, but stops writing and returns
+// ctx's error once ctx is done.
+func (iw *ImageWriter) FinalizeAllContext(ctx context.Context, outputs ...io.Writer) ([]Result, error) {
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("no outputs to write the image to")
+	}
+	t := &teeWriter{}
+	for _, w := range outputs {
+		t.ws = append(t.ws, &resultWriter{w: w, hash: sha256.New()})
+	}
+	if err := iw.FinalizeContext(ctx, t); err != nil {
+		return nil, err
+	}
+	results := make([]Result, len(t.ws))
+	for i, rw := range t.ws {
+		results[i] = Result{Size: rw.n, SHA256: rw.hash.Sum(nil)}
+	}
+	return results, nil
+}
+
+// teeWriter writes to all of ws concurrently, so that each write takes as
+// long as the slowest output rather than all of them in turn.
+type teeWriter struct {
+	ws   []*resultWriter
+	errs []error
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	if t.errs == nil {
+		t.errs = make([]error, len(t.ws))
+	}
+	var wg sync.WaitGroup
+	for i, w := range t.ws {
+		wg.Add(1)
+		go func(i int, w *resultWriter) {
+			defer wg.Done()
+			n, err := w.Write(p)
+			if err == nil && n < len(p) {
+				err = io.ErrShortWrite
+			}
+			t.errs[i] = err
+		}(i, w)
+	}
+	wg.Wait()
+	for i, err := range t.errs {
+		if err != nil {
+			return 0, fmt.Errorf("output %d: %w", i, err)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,63 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// shortWriter fails once it has taken n bytes.
+type shortWriter struct {
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, errors.New("disk full")
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestFinalizeAll(t *testing.T) {
+	iw := lazyTestImage(t)
+	want := writeImage(t, iw)
+	sum := sha256.Sum256(want)
+
+	var a, b bytes.Buffer
+	results, err := iw.FinalizeAll(&a, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("FinalizeAll returned %d results, want 2", len(results))
+	}
+	for i, buf := range []*bytes.Buffer{&a, &b} {
+		if !bytes.Equal(buf.Bytes(), want) {
+			t.Errorf("output %d differs from the image Finalize writes", i)
+		}
+		if results[i].Size != int64(len(want)) || !bytes.Equal(results[i].SHA256, sum[:]) {
+			t.Errorf("output %d has size %d and digest %x, want %d and %x", i, results[i].Size, results[i].SHA256, len(want), sum)
+		}
+	}
+	ir, err := ReadImage(a.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareTrees(t, "FinalizeAll", readTree(t, ir), readTree(t, mustReadImage(t, want)))
+
+	if _, err := iw.FinalizeAll(&bytes.Buffer{}, &shortWriter{n: int(10 * SectorSize)}); err == nil || !strings.Contains(err.Error(), "output 1: disk full") {
+		t.Errorf("FinalizeAll with a failing output returned %v", err)
+	}
+	if _, err := iw.FinalizeAll(); err == nil {
+		t.Error("FinalizeAll without outputs succeeded")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := iw.FinalizeAllContext(ctx, &bytes.Buffer{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("FinalizeAllContext with a canceled context returned %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+const transTableName = "TRANS.TBL"
+
+// WithTransTable adds a TRANS.TBL file to every directory that isn't empty,
+// mapping the identifiers of its entries to the names they were added under,
+// in the format genisoimage -T writes.  This lets systems without Rock Ridge
+// support recover names that had to be mangled or upper-cased.
+func WithTransTable() Option {
+	return func(o *options) {
+		o.transTable = true
+	}
+}
+
+// addTransTable replaces d's TRANS.TBL with one describing its current
+// entries.
+func (d *directoryEntry) addTransTable(o *options) error {
+	for i, f := range d.files {
+		if f == d.transTable {
+			d.files = append(d.files[:i], d.files[i+1:]...)
+			break
+		}
+	}
+	d.transTable = nil
+	if d.lookup(transTableName) {
+		return fmt.Errorf("%s already exists in the image", d.path()+"/"+transTableName)
+	}
+
+	type line struct {
+		kind       byte
+		identifier string
+		name       string
+	}
+	var lines []line
+	for _, sub := range d.subdirs {
+		lines = append(lines, line{'D', d.childName(sub), sub.origName})
+	}
+	for _, f := range d.files {
+		identifier := f.Name
+		if o.fileVersions {
+			identifier += ";1"
+		}
+		lines = append(lines, line{'F', identifier, f.origName})
+	}
+	if len(lines) == 0 {
+		// empty directories stay empty
+		return nil
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		return compareIdentifiers(lines[i].identifier, lines[j].identifier) < 0
+	})
+	var buf bytes.Buffer
+	for _, l := range lines {
+		fmt.Fprintf(&buf, "%c %-34s%s\n", l.kind, l.identifier, l.name)
+	}
+
+	table := buf.Bytes()
+	d.transTable = &FileEntry{
+		Name:     transTableName,
+		Size:     int64(len(table)),
+		origName: transTableName,
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(table)), nil
+		},
+	}
+	d.files = append(d.files, d.transTable)
+	return nil
+}
@@ -0,0 +1,58 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AddTree schedules the local directory localDir and everything below it for
+// inclusion in the image as the directory isoPath, which is "/" to merge it
+// into the root directory.  Missing parent directories are created.  Like
+// AddFS, which it is built on, it applies WithSymlinkPolicy and the filters
+// of WithExclude and WithIncludeOnly, and opens no files until Finalize.
+func (iw *ImageWriter) AddTree(localDir, isoPath string) error {
+	fi, err := os.Stat(localDir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", localDir)
+	}
+	components := splitPath(isoPath)
+	dir, err := iw.mkdirAll(components)
+	if err != nil {
+		return err
+	}
+	if dir != iw.root {
+		dir.modTime = fi.ModTime()
+		dir.posix = iw.sourceAttributes(fi)
+	}
+	return iw.addFS(localFS{FS: os.DirFS(localDir), dir: localDir}, strings.Join(components, "/"), "", 0)
+}
+
+// localFS is the file system of a local directory.  Unlike os.DirFS before
+// Go 1.25, it can read symbolic links.
+type localFS struct {
+	fs.FS
+	dir string
+}
+
+func (l localFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(l.dir, filepath.FromSlash(name)))
+}
+
+// Sub keeps the ability to read links in subdirectories of l, which
+// followed links to directories are walked as.
+func (l localFS) Sub(dir string) (fs.FS, error) {
+	sub, err := fs.Sub(l.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+	return localFS{FS: sub, dir: filepath.Join(l.dir, filepath.FromSlash(dir))}, nil
+}
@@ -0,0 +1,83 @@
+package iso9660wrap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddTree(t *testing.T) {
+	src := t.TempDir()
+	for _, dir := range []string{"sub/deeper", "empty"} {
+		if err := os.MkdirAll(filepath.Join(src, filepath.FromSlash(dir)), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"a.txt":            "a",
+		"sub/b.txt":        "b",
+		"sub/deeper/c.txt": "c",
+		"sub/deeper/d.bin": strings.Repeat("d", 5000),
+	}
+	for name, data := range files {
+		if err := ioutil.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	subTime := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(filepath.Join(src, "sub"), subTime, subTime); err != nil {
+		t.Fatal(err)
+	}
+	srcTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(src, srcTime, srcTime); err != nil {
+		t.Fatal(err)
+	}
+
+	iw := NewImageWriter(WithRockRidge())
+	if err := iw.AddTree(src, "/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddTree(filepath.Join(src, "sub"), "vendor/tree/"); err != nil {
+		t.Fatal(err)
+	}
+	// files are read during Finalize, not when they are added
+	if err := ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("A"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ir, err := ReadImage(writeImage(t, iw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a.txt":                    "A",
+		"empty/":                   "",
+		"sub/":                     "",
+		"sub/b.txt":                "b",
+		"sub/deeper/":              "",
+		"sub/deeper/c.txt":         "c",
+		"sub/deeper/d.bin":         files["sub/deeper/d.bin"],
+		"vendor/":                  "",
+		"vendor/tree/":             "",
+		"vendor/tree/b.txt":        "b",
+		"vendor/tree/deeper/":      "",
+		"vendor/tree/deeper/c.txt": "c",
+		"vendor/tree/deeper/d.bin": files["sub/deeper/d.bin"],
+	}
+	compareTrees(t, "ReadImage", readTree(t, ir), want)
+	// the added directory takes the modification time of the local one
+	for path, mtime := range map[string]time.Time{"sub": subTime, "vendor/tree": subTime} {
+		if info, err := ir.Stat(path); err != nil || !info.ModTime.Equal(mtime) {
+			t.Errorf("%s is recorded at %v, want %v: %v", path, info.ModTime, mtime, err)
+		}
+	}
+
+	if err := iw.AddTree(filepath.Join(src, "a.txt"), "/"); err == nil || !strings.Contains(err.Error(), "is not a directory") {
+		t.Errorf("AddTree of a file returned %v", err)
+	}
+	if err := iw.AddTree(filepath.Join(src, "missing"), "/"); !os.IsNotExist(err) {
+		t.Errorf("AddTree of a missing directory returned %v", err)
+	}
+}
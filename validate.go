@@ -0,0 +1,407 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	pathpkg "path"
+)
+
+// Finding is a structural problem that Validate found in an image.
+type Finding struct {
+	// Sector is the sector the problem was found in.
+	Sector uint32
+	// Path is the directory the problem concerns, or empty for the volume
+	// descriptors and path tables.
+	Path    string
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.Path == "" {
+		return fmt.Sprintf("sector %d: %s", f.Sector, f.Message)
+	}
+	return fmt.Sprintf("sector %d: %s: %s", f.Sector, f.Path, f.Message)
+}
+
+// Validate checks the structure of the ISO9660 image in r: the fields of
+// the primary volume descriptor, that both-endian fields agree, that both
+// path tables agree with the directory records, that every extent lies
+// within the volume, that extended attribute records take up the sectors
+// their directory records give, and that directory records are ordered and
+// laid out as ECMA-119 requires.  Each problem is returned as a Finding; an
+// error is returned only if r is not an ISO9660 image or can't be read.
+// Directories and path tables too large for a Reader with the default
+// MemoryLimit are reported rather than read, so hostile images can be
+// validated.  Identifier character sets are not checked, so images written
+// with relaxed names validate.
+func Validate(r io.ReaderAt) ([]Finding, error) {
+	pvd, _, err := readPVDInfo(r)
+	if err != nil {
+		return nil, err
+	}
+	v := &validator{r: r, visited: map[uint32]bool{}}
+	if err := v.checkDescriptorSet(); err != nil {
+		return nil, err
+	}
+	b := make([]byte, SectorSize)
+	if _, err := r.ReadAt(b, pvd); err != nil {
+		return nil, err
+	}
+	sector := uint32(pvd / int64(SectorSize))
+	v.checkPVD(sector, b)
+	if err := v.checkDirectories(sector, b[156:156+34]); err != nil {
+		return nil, err
+	}
+	if err := v.checkPathTables(sector, b); err != nil {
+		return nil, err
+	}
+	return v.findings, nil
+}
+
+// validator collects the findings of Validate.
+type validator struct {
+	r          io.ReaderAt
+	numSectors uint32
+	findings   []Finding
+
+	// dirs are the directories in the order the path tables list them,
+	// and visited are the sectors of their extents.
+	dirs    []validatedDir
+	visited map[uint32]bool
+}
+
+// validatedDir is a directory found by walking the directory records.
+type validatedDir struct {
+	path       string
+	identifier string
+	sector     uint32
+	size       uint32
+	parent     int // index of the parent in dirs
+	depth      int
+}
+
+func (v *validator) addf(sector uint32, path, format string, a ...interface{}) {
+	v.findings = append(v.findings, Finding{Sector: sector, Path: path, Message: fmt.Sprintf(format, a...)})
+}
+
+// checkDescriptorSet checks that the volume descriptor set is terminated.
+func (v *validator) checkDescriptorSet() error {
+	b := make([]byte, SectorSize)
+	for n := primaryVolumeSectorNum; ; n++ {
+		if _, err := v.r.ReadAt(b, int64(n)*int64(SectorSize)); err != nil {
+			v.addf(n, "", "volume descriptor set is not terminated")
+			return nil
+		}
+		if string(b[1:6]) != standardIdentifier {
+			v.addf(n, "", "volume descriptor set is not terminated")
+			return nil
+		}
+		if b[0] == 255 {
+			return nil
+		}
+	}
+}
+
+// checkPVD checks the fields of the primary volume descriptor b, which was
+// read from sector.
+func (v *validator) checkPVD(sector uint32, b []byte) {
+	v.numSectors = v.bothEndian32(sector, "", b[80:], "volume space size")
+	if v.numSectors > 0 {
+		last := make([]byte, 1)
+		if _, err := v.r.ReadAt(last, int64(v.numSectors)*int64(SectorSize)-1); err != nil {
+			v.addf(sector, "", "image is shorter than its volume space of %d sectors", v.numSectors)
+		}
+	}
+	setSize := v.bothEndian16(sector, "", b[120:], "volume set size")
+	sequence := v.bothEndian16(sector, "", b[124:], "volume sequence number")
+	if setSize == 0 || sequence == 0 || sequence > setSize {
+		v.addf(sector, "", "volume sequence number %d is not within the volume set size %d", sequence, setSize)
+	}
+	if blockSize := v.bothEndian16(sector, "", b[128:], "logical block size"); blockSize != uint16(SectorSize) {
+		v.addf(sector, "", "logical block size is %d, not %d", blockSize, SectorSize)
+	}
+	v.bothEndian32(sector, "", b[132:], "path table size")
+	if b[881] != 1 {
+		v.addf(sector, "", "file structure version is %d, not 1", b[881])
+	}
+	for _, d := range []struct {
+		offset int
+		name   string
+	}{
+		{813, "creation"},
+		{830, "modification"},
+		{847, "expiration"},
+		{864, "effective"},
+	} {
+		if !validDateTime(b[d.offset : d.offset+17]) {
+			v.addf(sector, "", "invalid volume %s date and time %q", d.name, b[d.offset:d.offset+16])
+		}
+	}
+	root := b[156 : 156+34]
+	if root[0] != 34 || root[32] != 1 || root[33] != 0 {
+		v.addf(sector, "", "invalid root directory record")
+	}
+}
+
+// validDateTime reports whether b is a valid volume descriptor date and
+// time: sixteen digits followed by an offset from GMT in 15 minute
+// intervals.
+func validDateTime(b []byte) bool {
+	for _, c := range b[:16] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return int8(b[16]) >= -48 && int8(b[16]) <= 52
+}
+
+// bothEndian32 returns the little-endian half of the both-endian 32-bit
+// field at the start of b, adding a finding if the halves disagree.
+func (v *validator) bothEndian32(sector uint32, path string, b []byte, name string) uint32 {
+	le, be := binary.LittleEndian.Uint32(b), binary.BigEndian.Uint32(b[4:])
+	if le != be {
+		v.addf(sector, path, "both-endian %s disagrees: %d and %d", name, le, be)
+	}
+	return le
+}
+
+// bothEndian16 is bothEndian32 for 16-bit fields.
+func (v *validator) bothEndian16(sector uint32, path string, b []byte, name string) uint16 {
+	le, be := binary.LittleEndian.Uint16(b), binary.BigEndian.Uint16(b[2:])
+	if le != be {
+		v.addf(sector, path, "both-endian %s disagrees: %d and %d", name, le, be)
+	}
+	return le
+}
+
+// checkExtent reports whether the extent of size bytes at start lies within
+// the volume, adding a finding if it doesn't.
+func (v *validator) checkExtent(sector uint32, path string, start, size uint32, what string) bool {
+	end := int64(start) + numDataSectors(int64(size))
+	if start < primaryVolumeSectorNum+2 && size > 0 || end > int64(v.numSectors) {
+		v.addf(sector, path, "extent of %s at sector %d with %d bytes is not within the volume", what, start, size)
+		return false
+	}
+	return true
+}
+
+// checkExtendedAttributeRecord checks that the extended attribute record of
+// xar sectors at start, which the record of identifier read from sector
+// gives, lies within the volume and takes up as many sectors.
+func (v *validator) checkExtendedAttributeRecord(sector uint32, path, identifier string, start, xar uint32) {
+	if !v.checkExtent(sector, path, start, xar*SectorSize, fmt.Sprintf("the extended attribute record of %q", identifier)) {
+		return
+	}
+	b := make([]byte, xar*SectorSize)
+	if _, err := v.r.ReadAt(b, int64(start)*int64(SectorSize)); err != nil {
+		v.addf(sector, path, "extended attribute record of %q can't be read: %s", identifier, err)
+		return
+	}
+	if b[180] != 1 {
+		v.addf(start, path, "extended attribute record of %q has version %d, not 1", identifier, b[180])
+	}
+	// the application use and the escape sequences follow the fixed part
+	length := 250 + int64(v.bothEndian16(start, path, b[246:], "length of application use")) + int64(b[181])
+	if n := numDataSectors(length); n != int64(xar) {
+		v.addf(start, path, "extended attribute record of %q takes %d sectors, but its directory record gives %d", identifier, n, xar)
+	}
+}
+
+// checkDirectories walks the directory hierarchy from the root directory
+// record root, checking the records of every directory.  Directories are
+// visited breadth first, which is the order of the path tables.
+func (v *validator) checkDirectories(pvd uint32, root []byte) error {
+	sector := v.bothEndian32(pvd, "/", root[2:], "root directory extent location")
+	size := v.bothEndian32(pvd, "/", root[10:], "root directory data length")
+	if !v.checkExtent(pvd, "/", sector, size, "the root directory") {
+		return nil
+	}
+	v.dirs = append(v.dirs, validatedDir{path: "/", identifier: "\x00", sector: sector, size: size, depth: 1})
+	v.visited[sector] = true
+	for i := 0; i < len(v.dirs); i++ {
+		if err := v.checkDirectory(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDirectory checks the records of the directory dirs[i], queueing its
+// subdirectories.
+func (v *validator) checkDirectory(i int) error {
+	d := v.dirs[i]
+	if d.size%SectorSize != 0 {
+		v.addf(d.sector, d.path, "directory data length %d is not a multiple of the sector size", d.size)
+	}
+	if d.size > defaultMemoryLimit {
+		v.addf(d.sector, d.path, "directory of %d bytes is too large to check", d.size)
+		return nil
+	}
+	data := make([]byte, d.size)
+	if _, err := v.r.ReadAt(data, int64(d.sector)*int64(SectorSize)); err != nil {
+		return fmt.Errorf("reading directory %s: %w", d.path, err)
+	}
+	n := 0
+	var prev []byte
+	for p := 0; p < len(data); {
+		sector := d.sector + uint32(p)/SectorSize
+		length := int(data[p])
+		if length == 0 {
+			p = (p/int(SectorSize) + 1) * int(SectorSize)
+			continue
+		}
+		if length < 34 || p+length > len(data) || 33+int(data[p+32]) > length {
+			v.addf(sector, d.path, "invalid directory record at offset %d", p)
+			break
+		}
+		rec := data[p : p+length]
+		if p/int(SectorSize) != (p+length-1)/int(SectorSize) {
+			v.addf(sector, d.path, "directory record at offset %d crosses a sector boundary", p)
+		}
+		if length%2 != 0 {
+			v.addf(sector, d.path, "directory record at offset %d has odd length %d", p, length)
+		}
+		p += length
+		v.checkRecord(i, sector, n, rec, prev)
+		prev = rec
+		n++
+	}
+	if n < 2 {
+		v.addf(d.sector, d.path, "directory lacks the records for itself and its parent")
+	} else if prev[25]&fileFlagMultiExtent != 0 {
+		v.addf(d.sector, d.path, "last extent of %q is missing", prev[33:33+int(prev[32])])
+	}
+	return nil
+}
+
+// checkRecord checks rec, the nth record of the directory dirs[i], which
+// follows the record prev.
+func (v *validator) checkRecord(i int, sector uint32, n int, rec, prev []byte) {
+	d := v.dirs[i]
+	identifier := string(rec[33 : 33+int(rec[32])])
+	start := v.bothEndian32(sector, d.path, rec[2:], "extent location")
+	size := v.bothEndian32(sector, d.path, rec[10:], "data length")
+	v.bothEndian16(sector, d.path, rec[28:], "volume sequence number")
+	flags := rec[25]
+	isDir := flags&fileFlagDirectory != 0
+
+	switch n {
+	case 0:
+		if identifier != "\x00" {
+			v.addf(sector, d.path, "first record is not the record of the directory itself")
+		} else if start != d.sector || size != d.size {
+			v.addf(sector, d.path, "record of the directory itself gives sector %d and %d bytes, not sector %d and %d bytes", start, size, d.sector, d.size)
+		}
+		return
+	case 1:
+		parent := v.dirs[d.parent]
+		if identifier != "\x01" {
+			v.addf(sector, d.path, "second record is not the record of the parent directory")
+		} else if start != parent.sector {
+			v.addf(sector, d.path, "record of the parent directory gives sector %d, not sector %d", start, parent.sector)
+		}
+		return
+	}
+
+	name := pathpkg.Join(d.path, identifier)
+	switch {
+	case identifier == "\x00" || identifier == "\x01":
+		v.addf(sector, d.path, "record for the directory itself or its parent follows other records")
+		return
+	case n > 2:
+		prevIdentifier := string(prev[33 : 33+int(prev[32])])
+		c := compareIdentifiers(prevIdentifier, identifier)
+		multiExtent := prev[25]&fileFlagMultiExtent != 0
+		associated := prev[25]&fileFlagAssociated != 0 && flags&fileFlagAssociated == 0
+		if c > 0 || c == 0 && !multiExtent && !associated {
+			v.addf(sector, d.path, "record %q is not ordered after %q", identifier, prevIdentifier)
+		}
+	}
+	if xar := uint32(rec[1]); xar > 0 {
+		v.checkExtendedAttributeRecord(sector, d.path, identifier, start, xar)
+		start += xar
+	} else if flags&fileFlagProtection != 0 {
+		v.addf(sector, d.path, "record %q has the protection flag set but no extended attribute record", identifier)
+	}
+	if !v.checkExtent(sector, d.path, start, size, fmt.Sprintf("%q", identifier)) || !isDir {
+		return
+	}
+	if v.visited[start] {
+		v.addf(sector, d.path, "directory %q refers to the extent of another directory at sector %d", identifier, start)
+		return
+	}
+	v.visited[start] = true
+	if d.depth == maxDirectoryDepth {
+		v.addf(sector, d.path, "directory %q is nested deeper than %d levels", identifier, maxDirectoryDepth)
+	}
+	v.dirs = append(v.dirs, validatedDir{
+		path:       name,
+		identifier: identifier,
+		sector:     start,
+		size:       size,
+		parent:     i,
+		depth:      d.depth + 1,
+	})
+}
+
+// checkPathTables checks that the type L and type M path tables named by
+// the primary volume descriptor b, read from sector, list the directories
+// found by checkDirectories.
+func (v *validator) checkPathTables(sector uint32, b []byte) error {
+	size := binary.LittleEndian.Uint32(b[132:])
+	tables := []struct {
+		kind   string
+		offset int
+		bo     binary.ByteOrder
+	}{
+		{"L", 140, binary.LittleEndian},
+		{"M", 148, binary.BigEndian},
+	}
+	for _, t := range tables {
+		start := t.bo.Uint32(b[t.offset:])
+		if !v.checkExtent(sector, "", start, size, "the type "+t.kind+" path table") {
+			continue
+		} else if size > defaultMemoryLimit {
+			v.addf(start, "", "type %s path table of %d bytes is too large to check", t.kind, size)
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := v.r.ReadAt(data, int64(start)*int64(SectorSize)); err != nil {
+			return fmt.Errorf("reading type %s path table: %w", t.kind, err)
+		}
+		v.checkPathTable(start, t.kind, t.bo, data)
+	}
+	return nil
+}
+
+// checkPathTable compares the path table data, read from sector, with the
+// directories found by walking the directory records.
+func (v *validator) checkPathTable(sector uint32, kind string, bo binary.ByteOrder, data []byte) {
+	n := 0
+	for p := 0; p < len(data); n++ {
+		if p+8 > len(data) || p+8+int(data[p]) > len(data) || data[p] == 0 {
+			v.addf(sector, "", "invalid type %s path table record %d", kind, n+1)
+			return
+		}
+		length := int(data[p])
+		identifier := string(data[p+8 : p+8+length])
+		start := bo.Uint32(data[p+2:])
+		parent := bo.Uint16(data[p+6:])
+		p += 8 + length + length%2
+		if n >= len(v.dirs) {
+			v.addf(sector, "", "type %s path table lists more than the %d directories found", kind, len(v.dirs))
+			return
+		}
+		d := v.dirs[n]
+		if identifier != d.identifier || start != d.sector || int(parent) != d.parent+1 {
+			// the records that follow are most likely off as well
+			v.addf(sector, d.path, "type %s path table record %d gives %q at sector %d with parent %d, not %q at sector %d with parent %d",
+				kind, n+1, identifier, start, parent, d.identifier, d.sector, d.parent+1)
+			return
+		}
+	}
+	if n < len(v.dirs) {
+		v.addf(sector, "", "type %s path table lists %d of the %d directories found", kind, n, len(v.dirs))
+	}
+}
@@ -0,0 +1,64 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// WithVerify reads the image back once Finalize has written it and checks
+// that the size and contents of every file match what was read from its
+// input, which catches writes truncated or garbled by flaky storage before
+// the image is shipped.  The output must then also be an io.ReaderAt holding
+// the image from offset 0, such as an *os.File opened for reading and
+// writing, which WriteToFile provides.  A mismatch is reported as
+// ErrVerificationFailed.
+func WithVerify() Option {
+	return func(o *options) {
+		o.verify = true
+	}
+}
+
+// verifyImage reads the image l describes back from r, comparing every file
+// recorded in it to the digest writeFileData recorded.
+func (iw *ImageWriter) verifyImage(r io.ReaderAt, l *imageLayout) error {
+	ir, err := NewReader(r, UseNames(PrimaryNames))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	files := map[uint32]ISOFileInfo{}
+	err = ir.Walk(func(info ISOFileInfo) error {
+		if !info.IsDir() && info.Size > 0 {
+			files[info.LBA] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	for _, d := range l.dirs {
+		for _, f := range d.files {
+			if f.Size == 0 || f.shares != nil {
+				continue
+			}
+			path := d.path() + "/" + f.Name
+			sector := f.sector + f.xarSectors()
+			info, ok := files[sector]
+			if !ok {
+				return fmt.Errorf("%w: no file %s at sector %d", ErrVerificationFailed, path, sector)
+			} else if info.Size != f.Size {
+				return fmt.Errorf("%w: file %s holds %d bytes instead of %d", ErrVerificationFailed, path, info.Size, f.Size)
+			}
+			h := sha256.New()
+			if _, err := io.Copy(h, ir.open(&info)); err != nil {
+				return fmt.Errorf("%w: reading %s: %v", ErrVerificationFailed, path, err)
+			}
+			if f.written == nil || !bytes.Equal(h.Sum(nil), f.written[:]) {
+				return fmt.Errorf("%w: contents of %s differ", ErrVerificationFailed, path)
+			}
+			iw.logf("file %s verified", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// flakyStorage holds what is written to it in memory, flipping the byte
+// written at offset corrupt and losing the last lost bytes.
+type flakyStorage struct {
+	data    []byte
+	corrupt int64
+	lost    int64
+}
+
+func (s *flakyStorage) Write(p []byte) (int, error) {
+	start := int64(len(s.data))
+	s.data = append(s.data, p...)
+	if s.corrupt >= start && s.corrupt < int64(len(s.data)) {
+		s.data[s.corrupt] ^= 0xFF
+	}
+	return len(p), nil
+}
+
+func (s *flakyStorage) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(s.data[:int64(len(s.data))-s.lost]).ReadAt(p, off)
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "disk.txt")
+	if err := ioutil.WriteFile(src, bytes.Repeat([]byte("from disk\n"), 500), 0644); err != nil {
+		t.Fatal(err)
+	}
+	iw := NewImageWriter(WithRockRidge(), WithVerify())
+	if err := iw.AddFileAs(src, "DISK/DISK.TXT"); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("UNITS.BIN", bytes.Repeat([]byte("0123456789abcdef"), 1000), Interleave(2, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("LAST.BIN", bytes.Repeat([]byte("last"), 1000)); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "out.iso")
+	if err := WriteToFile(path, Exclusive, func(outfh *os.File) error { return iw.Finalize(outfh) }); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	checkValid(t, f)
+	ir, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := ir.Stat("DISK/DISK.TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := iw.Finalize(&flakyStorage{corrupt: -1}); err != nil {
+		t.Errorf("Finalize to sound storage returned %v", err)
+	}
+	err = iw.Finalize(&flakyStorage{corrupt: int64(info.LBA)*int64(SectorSize) + 10})
+	if !errors.Is(err, ErrVerificationFailed) || !strings.Contains(err.Error(), "contents of /DISK/DISK.TXT differ") {
+		t.Errorf("Finalize to storage garbling DISK.TXT returned %v", err)
+	}
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := end - int64(info.LBA)*int64(SectorSize) - 100
+	if err := iw.Finalize(&flakyStorage{corrupt: -1, lost: lost}); !errors.Is(err, ErrVerificationFailed) {
+		t.Errorf("Finalize to storage losing the last %d bytes returned %v", lost, err)
+	}
+
+	if err := iw.Finalize(&bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "requires an output that can be read back") {
+		t.Errorf("Finalize to a buffer returned %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package iso9660wrap
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// maxVolumeIDPrefixLength leaves at least 16 hexadecimal digits, or 64 bits
+// of the digest, to a volume identifier derived from the contents.
+const maxVolumeIDPrefixLength = 16
+
+// WithContentVolumeID derives the volume identifier from the contents of the
+// image: prefix followed by as many upper-case hexadecimal digits of the
+// SHA-256 digest of every path, size and file's data as fit in the 32
+// characters of the identifier.  Images of the same tree get the same
+// identifier whenever they are written, so it can serve as a cache key or a
+// stable label, while any change to the files changes it.  prefix may be up
+// to 16 characters long.  Files are read and hashed while the image is laid
+// out, so they are read twice and must not change until the image is
+// written, and readers added with AddReader that can be read only once
+// can't be part of such an image.
+func WithContentVolumeID(prefix string) Option {
+	return func(o *options) {
+		o.contentVolumeID = true
+		o.volumeIDPrefix = prefix
+	}
+}
+
+// layoutVolumeID sets the volume identifier of l, hashing the contents of
+// the image if WithContentVolumeID is given.
+func (iw *ImageWriter) layoutVolumeID(l *imageLayout) error {
+	l.volumeID = iw.volumeID
+	if !iw.contentVolumeID {
+		return nil
+	}
+	h := sha256.New()
+	b := make([]byte, 8)
+	record := func(kind byte, path string, size int64) {
+		h.Write([]byte{kind})
+		binary.BigEndian.PutUint64(b, uint64(len(path)))
+		h.Write(b)
+		h.Write([]byte(path))
+		binary.BigEndian.PutUint64(b, uint64(size))
+		h.Write(b)
+	}
+	for _, d := range l.dirs {
+		record('d', d.path(), 0)
+		for _, f := range d.files {
+			path := d.path() + "/" + f.Name
+			record('f', path, f.Size)
+			switch {
+			case f.symlink != "":
+				record('l', f.symlink, 0)
+			case f.oneShot && f.contents == nil:
+				return fmt.Errorf("%s can be read only once, but the volume identifier is derived from its contents", path)
+			case f.open != nil || f.contents != nil:
+				if err := f.hash(path); err != nil {
+					return err
+				}
+				h.Write(f.digest[:])
+			}
+		}
+	}
+	l.volumeID = iw.volumeIDPrefix + strings.ToUpper(hex.EncodeToString(h.Sum(nil)))[:32-len(iw.volumeIDPrefix)]
+	return nil
+}
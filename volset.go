@@ -0,0 +1,128 @@
+package iso9660wrap
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// WithVolumeSet records the image as volume sequence of a set of size
+// volumes, such as the discs of a multi-disc set, in its volume
+// descriptors and directory records.  Without this option, the image is
+// the only volume of its set.  The volumes of a set should share a volume
+// set identifier, given with WithVolumeSetID.
+func WithVolumeSet(size, sequence uint16) Option {
+	return func(o *options) {
+		o.volumeSetSize = size
+		o.volumeSequence = sequence
+	}
+}
+
+// volumeSet returns the volume set size and the volume sequence number of
+// the image.
+func (o *options) volumeSet() (size, sequence uint16) {
+	if o.volumeSetSize == 0 {
+		return 1, 1
+	}
+	return o.volumeSetSize, o.volumeSequence
+}
+
+// Split distributes the entries scheduled so far over images of at most
+// capacity bytes each, which form a volume set as WithVolumeSet describes.
+// Files are taken directory by directory in the order they were added, and
+// each volume holds as many as fit, along with the directories leading to
+// them, so every file is recorded whole on a single volume.  The images
+// share the options of iw, and are written with Finalize like any other;
+// iw itself is left as it is.  Images with boot images or a previous
+// session can't be split.
+func (iw *ImageWriter) Split(capacity int64) ([]*ImageWriter, error) {
+	if len(iw.boot) > 0 {
+		return nil, fmt.Errorf("an image with boot images can't be split into a volume set")
+	} else if iw.previousEnd != 0 {
+		return nil, fmt.Errorf("an image with a previous session can't be split into a volume set")
+	}
+	if err := iw.options.validate(); err != nil {
+		return nil, err
+	}
+	entries := iw.root.splitEntries(nil)
+
+	var volumes []*ImageWriter
+	for start := 0; start < len(entries); {
+		// find the most entries from start on that fit in a volume
+		n := sort.Search(len(entries)-start, func(n int) bool {
+			size, err := iw.volume(entries[start : start+n+1]).Size()
+			return err != nil || size > capacity
+		})
+		if n == 0 {
+			size, err := iw.volume(entries[start : start+1]).Size()
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s needs a volume of %d bytes, which exceeds the capacity of %d bytes", entries[start].path(), size, capacity)
+		}
+		volumes = append(volumes, iw.volume(entries[start:start+n]))
+		start += n
+	}
+	if len(volumes) > math.MaxUint16 {
+		return nil, fmt.Errorf("a volume set of %d volumes exceeds %d volumes", len(volumes), math.MaxUint16)
+	}
+	for i, v := range volumes {
+		v.volumeSetSize = uint16(len(volumes))
+		v.volumeSequence = uint16(i + 1)
+	}
+	return volumes, nil
+}
+
+// splitEntry is a directory, or a file if f is set, taken into a volume of
+// a volume set.
+type splitEntry struct {
+	dir *directoryEntry
+	f   *FileEntry
+	// components are the names of the directories leading to dir
+	components []string
+}
+
+func (e *splitEntry) path() string {
+	if e.f == nil {
+		return e.dir.path() + "/"
+	}
+	return e.dir.path() + "/" + e.f.origName
+}
+
+// splitEntries returns d, its files and its subdirectories, recursively, in
+// the order they were added.  components are the names leading to d.
+func (d *directoryEntry) splitEntries(components []string) []splitEntry {
+	entries := []splitEntry{{dir: d, components: components}}
+	for _, f := range d.files {
+		if f != d.transTable {
+			entries = append(entries, splitEntry{dir: d, f: f, components: components})
+		}
+	}
+	for _, sub := range d.subdirs {
+		if sub == d.rrMoved {
+			continue
+		}
+		path := append(append([]string(nil), components...), sub.origName)
+		entries = append(entries, sub.splitEntries(path)...)
+	}
+	return entries
+}
+
+// volume returns an image with the options of iw that holds entries.
+func (iw *ImageWriter) volume(entries []splitEntry) *ImageWriter {
+	v := &ImageWriter{root: &directoryEntry{name: "\x00"}, options: iw.options}
+	for _, e := range entries {
+		// the directories were accepted by iw, which holds every entry of
+		// the volume, so they can't fail to be created
+		dir, _ := v.mkdirAll(e.components)
+		for d, src := dir, e.dir; d != nil; d, src = d.parent, src.parent {
+			d.modTime, d.posix = src.modTime, src.posix
+		}
+		if e.f != nil {
+			f := *e.f
+			f.shares = nil
+			dir.files = append(dir.files, &f)
+		}
+	}
+	return v
+}
@@ -0,0 +1,44 @@
+package iso9660wrap
+
+import "encoding/binary"
+
+// xaSignature marks a volume as CD-ROM XA at offset 1024 of its primary
+// volume descriptor.
+const xaSignature = "CD-XA001"
+
+// xaSystemUseSize is the size of the CD-ROM XA System Use field of a
+// directory record.
+const xaSystemUseSize = 14
+
+// CD-ROM XA attributes: read and execute permission for owner, group and
+// world, mode 2 form 1 sectors, and the directory flag.
+const (
+	xaAttrPermissions = 0x0555
+	xaAttrMode2Form1  = 0x0800
+	xaAttrDirectory   = 0x8000
+)
+
+// WithXA marks the image as CD-ROM XA, recording the XA signature in the
+// primary volume descriptor and an XA System Use field in every directory
+// record, as mkisofs -XA does, which some embedded and console readers
+// require.  The data itself is still recorded in ordinary mode 1 sectors.
+// Combined with WithRockRidge, the XA fields precede the Rock Ridge entries,
+// which the SP entry tells readers to skip.
+func WithXA() Option {
+	return func(o *options) {
+		o.xa = true
+	}
+}
+
+// xaSystemUse returns the CD-ROM XA System Use field of a directory record,
+// with owner and group 0.
+func xaSystemUse(dir bool) []byte {
+	su := make([]byte, xaSystemUseSize)
+	attr := uint16(xaAttrPermissions | xaAttrMode2Form1)
+	if dir {
+		attr |= xaAttrDirectory
+	}
+	binary.BigEndian.PutUint16(su[4:], attr)
+	copy(su[6:], "XA")
+	return su
+}
@@ -0,0 +1,61 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestXARockRidge(t *testing.T) {
+	iw := NewImageWriter(WithXA(), WithRockRidge())
+	files := map[string]string{
+		"readme.txt":               "readme",
+		"Big.Data":                 strings.Repeat("big", 20000),
+		"a/b/c/d/e/f/g/h/i/deep.c": "deep",
+	}
+	for name, data := range files {
+		if err := iw.AddBytes(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := iw.AddSymlink("link", "readme.txt"); err != nil {
+		t.Fatal(err)
+	}
+	img := writeImage(t, iw)
+	ir := mustReadImage(t, img)
+
+	// the root "." record starts with the SP entry, which skips the XA
+	// field following it, while every other record starts with its XA field
+	root := int(ir.root.LBA) * int(SectorSize)
+	su := img[root+34:]
+	if string(su[:2]) != "SP" || su[6] != xaSystemUseSize || string(su[7+6:7+8]) != "XA" {
+		t.Errorf("root directory starts with System Use % x", su[:7+xaSystemUseSize])
+	}
+	rec := bytes.Index(img, []byte("README.TXT")) - 33
+	if rec < 0 || string(img[rec+33+10+1+6:][:2]) != "XA" {
+		t.Error("README.TXT has no XA field")
+	}
+
+	want := map[string]string{"link": "-> readme.txt"}
+	for name, data := range files {
+		want[name] = data
+		for dir := name; strings.Contains(dir, "/"); {
+			dir = dir[:strings.LastIndexByte(dir, '/')]
+			want[dir+"/"] = ""
+		}
+	}
+	// the Reader shows the emptied RR_MOVED as well
+	got := readTree(t, ir)
+	if _, ok := got["rr_moved/"]; !ok {
+		t.Error("Reader doesn't show RR_MOVED")
+	}
+	delete(got, "rr_moved/")
+	// and reads the link as the empty file standing in for it
+	if info, err := ir.Stat("link"); err != nil || info.symlink != "readme.txt" {
+		t.Errorf("link is %+v: %v", info, err)
+	} else {
+		got["link"] = "-> " + info.symlink
+	}
+	compareTrees(t, "ReadImage", got, want)
+	compareTrees(t, "bsdtar", bsdtarTree(t, img), want)
+}
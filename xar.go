@@ -0,0 +1,96 @@
+package iso9660wrap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+)
+
+// fileFlagProtection marks a file whose owner, group and permissions are
+// specified in its extended attribute record.
+const fileFlagProtection byte = 1 << 4
+
+// extendedAttributes holds the fields of an extended attribute record.
+type extendedAttributes struct {
+	owner, group uint16
+	perm         os.FileMode
+}
+
+// ExtendedAttributes records an extended attribute record in front of the
+// file's data, holding its owner and group ID and the read and execute
+// permissions of perm.  Few readers honor extended attribute records;
+// WithRockRidge is more widely supported.
+func ExtendedAttributes(owner, group uint16, perm os.FileMode) FileOption {
+	return func(f *FileEntry) {
+		f.xar = &extendedAttributes{owner, group, perm}
+		f.flags |= fileFlagProtection
+	}
+}
+
+// xarSectors returns the number of sectors of f's extended attribute record.
+func (f *FileEntry) xarSectors() uint32 {
+	if f.xar == nil {
+		return 0
+	}
+	return 1
+}
+
+// checkExtendedAttributes checks that the file f at path, if it has an
+// extended attribute record, fits in a single extent: the record precedes
+// the data of each extent it is recorded for, which the data of the
+// following extents doesn't leave room for.
+func (f *FileEntry) checkExtendedAttributes(path string) error {
+	if f.xar != nil && f.Size > maxExtentSize {
+		return fmt.Errorf("file %s of %d bytes can't have an extended attribute record, since it needs several extents", path, f.Size)
+	}
+	return nil
+}
+
+// permissions returns the permissions field of the record.  A set bit
+// denies an access, and every odd bit is set.
+func (x *extendedAttributes) permissions() uint16 {
+	p := uint16(0xaaaa)
+	deny := func(bit uint, allowed bool) {
+		if !allowed {
+			p |= 1 << bit
+		}
+	}
+	// the system class has the permissions of the owner
+	deny(0, x.perm&0400 != 0)
+	deny(2, x.perm&0100 != 0)
+	deny(4, x.perm&0400 != 0)
+	deny(6, x.perm&0100 != 0)
+	deny(8, x.perm&0040 != 0)
+	deny(10, x.perm&0010 != 0)
+	deny(12, x.perm&0004 != 0)
+	deny(14, x.perm&0001 != 0)
+	return p
+}
+
+func writeExtendedAttributeRecord(w *ISO9660Writer, f *FileEntry, path string, t time.Time) error {
+	sw := w.NextSector()
+	if w.Err() != nil {
+		return nil
+	}
+	if w.CurrentSector() != f.sector {
+		return internalErrorf("unexpected extended attribute record sector %d for file %s (expected %d)", w.CurrentSector(), path, f.sector)
+	}
+	sw.WriteBothEndianWord(f.xar.owner)
+	sw.WriteBothEndianWord(f.xar.group)
+	sw.WriteWord(binary.BigEndian, f.xar.permissions())
+	sw.WriteDateTime(t)           // file creation
+	sw.WriteDateTime(t)           // file modification
+	sw.WriteUnspecifiedDateTime() // file expiration
+	sw.WriteUnspecifiedDateTime() // file effective
+	sw.WriteByte(0)               // record format
+	sw.WriteByte(0)               // record attributes
+	sw.WriteBothEndianWord(0)     // record length
+	sw.WriteZeros(32)             // system identifier
+	sw.WriteZeros(64)             // system use
+	sw.WriteByte(1)               // extended attribute record version
+	sw.WriteByte(0)               // length of escape sequences
+	sw.WriteZeros(64)             // reserved
+	sw.WriteBothEndianWord(0)     // length of application use
+	return nil
+}
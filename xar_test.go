@@ -0,0 +1,123 @@
+package iso9660wrap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestExtendedAttributesRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789abcdef"), 400) // 6400 bytes, 4 sectors
+	iw := NewImageWriter()
+	if err := iw.AddBytes("XAR.BIN", data, ExtendedAttributes(1000, 100, 0640)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("EMPTY.BIN", nil, ExtendedAttributes(0, 0, 0600)); err != nil {
+		t.Fatal(err)
+	}
+	if err := iw.AddBytes("PLAIN.TXT", []byte("plain")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := iw.Finalize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	img := buf.Bytes()
+
+	findings, err := Validate(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		t.Errorf("finding: %s", f)
+	}
+
+	ir, err := ReadImage(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string][]byte{"XAR.BIN": data, "EMPTY.BIN": nil, "PLAIN.TXT": []byte("plain")} {
+		r, err := ir.Open(name)
+		if err != nil {
+			t.Fatalf("Open(%s): %v", name, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("reading %s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s holds %d bytes starting %q, want %d bytes starting %q", name, len(got), head(got), len(want), head(want))
+		}
+	}
+
+	info, err := ir.Stat("XAR.BIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := recordAt(t, img, "XAR.BIN")
+	if rec[1] != 1 {
+		t.Errorf("extended attribute record length is %d, want 1", rec[1])
+	}
+	if xar := littleEndian32(rec[2:]); info.LBA != xar+1 {
+		t.Errorf("data of XAR.BIN at sector %d, want %d following its extended attribute record", info.LBA, xar+1)
+	}
+
+	// bsdtar lists files with extended attribute records, but reads them
+	// from the start of their extents, record and all, as Linux doesn't
+	list := bsdtarList(t, tempImage(t, img))
+	for name, size := range map[string]int{"XAR.BIN": len(data), "EMPTY.BIN": 0, "PLAIN.TXT": 5} {
+		if got := list[name]; len(got) < 5 || got[4] != strconv.Itoa(size) {
+			t.Errorf("bsdtar lists %s as %q, want %d bytes", name, got, size)
+		}
+	}
+	if tree := bsdtarTree(t, img); tree["PLAIN.TXT"] != "plain" {
+		t.Errorf("bsdtar extracts PLAIN.TXT as %q", tree["PLAIN.TXT"])
+	}
+}
+
+func TestValidateExtendedAttributeLength(t *testing.T) {
+	iw := NewImageWriter()
+	if err := iw.AddBytes("XAR.BIN", []byte("data"), ExtendedAttributes(1, 1, 0644)); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := iw.Finalize(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		length byte
+		want   string
+	}{
+		{"missing", 0, "protection flag set but no extended attribute record"},
+		{"too long", 2, "takes 1 sectors, but its directory record gives 2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img := append([]byte(nil), buf.Bytes()...)
+			recordAt(t, img, "XAR.BIN")[1] = tc.length
+			findings, err := Validate(bytes.NewReader(img))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range findings {
+				if strings.Contains(f.Message, tc.want) {
+					return
+				}
+			}
+			t.Errorf("findings %v lack %q", findings, tc.want)
+		})
+	}
+}
+
+func TestExtendedAttributesMultiExtent(t *testing.T) {
+	iw := NewImageWriter()
+	if err := iw.add("BIG.BIN", maxExtentSize+1, nil, ExtendedAttributes(0, 0, 0644)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := iw.Size(); err == nil || !strings.Contains(err.Error(), "several extents") {
+		t.Errorf("Size() = %v, want an error about several extents", err)
+	}
+}
@@ -0,0 +1,428 @@
+package iso9660wrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlToJSON converts the YAML document b to JSON, so that manifests written
+// in YAML decode exactly like those written in JSON.  It understands the
+// part of YAML manifests need: block mappings and sequences, flow
+// collections on a single line, plain and quoted scalars and comments.
+// Plain scalars resolve as the YAML core schema resolves them, except that
+// infinities and NaN, which JSON can't hold, stay strings.  Anchors,
+// aliases, tags, complex keys, multi-line scalars and multiple documents are
+// rejected.
+func yamlToJSON(b []byte) ([]byte, error) {
+	p := &yamlParser{}
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || i == 0 && text == "---" {
+			continue
+		}
+		if text == "---" || text == "..." {
+			return nil, fmt.Errorf("line %d: only a single YAML document is supported", i+1)
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: YAML can't be indented with tabs", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{n: i + 1, indent: len(line) - len(text), text: text})
+	}
+	var v interface{} = map[string]interface{}{}
+	if len(p.lines) > 0 {
+		var err error
+		if v, err = p.block(p.lines[0].indent); err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.lines) {
+			return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].n)
+		}
+	}
+	return json.Marshal(v)
+}
+
+// stripYAMLComment removes the comment from line, if any.  A comment starts
+// with a # at the start of the line or after a space, outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' {
+				i++
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" [{,:", line[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return line[:i]
+			}
+		}
+	}
+	return line
+}
+
+// yamlLine is a line of a YAML document, without its indentation and
+// comment.
+type yamlLine struct {
+	n      int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// block parses the block node whose lines start at the current line, which
+// is indented by indent.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	l := p.lines[p.pos]
+	if l.indent != indent {
+		return nil, fmt.Errorf("line %d: unexpected indentation", l.n)
+	}
+	if isYAMLSequenceItem(l.text) {
+		return p.sequence(indent)
+	}
+	if _, _, ok, err := splitYAMLKey(l.text); err != nil {
+		return nil, fmt.Errorf("line %d: %w", l.n, err)
+	} else if ok {
+		return p.mapping(indent)
+	}
+	p.pos++
+	v, err := parseYAMLFlow(l.text)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", l.n, err)
+	}
+	return v, nil
+}
+
+// nested parses the block node that follows a sequence item or mapping key
+// without a value on the line at indent, which is null if there is none.
+// The items of a sequence may be indented as much as the key they follow.
+func (p *yamlParser) nested(indent int) (interface{}, error) {
+	if p.pos == len(p.lines) {
+		return nil, nil
+	}
+	next := p.lines[p.pos]
+	if next.indent > indent || next.indent == indent && isYAMLSequenceItem(next.text) {
+		return p.block(next.indent)
+	}
+	return nil, nil
+}
+
+func (p *yamlParser) sequence(indent int) ([]interface{}, error) {
+	list := []interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text) {
+		l := p.lines[p.pos]
+		rest := strings.TrimLeft(l.text[1:], " ")
+		var item interface{}
+		var err error
+		if rest == "" {
+			p.pos++
+			item, err = p.nested(indent + 1)
+		} else {
+			// the rest of the line is the first line of the item, such as
+			// the first key of a mapping whose other keys line up with it
+			p.lines[p.pos] = yamlLine{n: l.n, indent: indent + len(l.text) - len(rest), text: rest}
+			item, err = p.block(p.lines[p.pos].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	return list, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	for p.pos < len(p.lines) && p.lines[p.pos].indent == indent {
+		l := p.lines[p.pos]
+		key, rest, ok, err := splitYAMLKey(l.text)
+		if err == nil && !ok {
+			err = fmt.Errorf("expected a key followed by a colon")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.n, err)
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.n, key)
+		}
+		p.pos++
+		var v interface{}
+		if rest != "" {
+			if v, err = parseYAMLFlow(rest); err != nil {
+				return nil, fmt.Errorf("line %d: %w", l.n, err)
+			}
+		} else if v, err = p.nested(indent); err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits the line of a block mapping entry into its key and
+// the rest of the line, reporting whether text is such a line at all.
+func splitYAMLKey(text string) (key, rest string, ok bool, err error) {
+	if text[0] == '"' || text[0] == '\'' {
+		f := &yamlFlow{s: text}
+		v, err := f.quoted()
+		if err != nil {
+			return "", "", false, err
+		}
+		after := text[f.pos:]
+		if after != ":" && !strings.HasPrefix(after, ": ") {
+			return "", "", false, nil
+		}
+		return v, strings.TrimLeft(after[1:], " "), true, nil
+	}
+	if strings.IndexByte("[{", text[0]) >= 0 {
+		return "", "", false, nil
+	}
+	if isUnsupportedYAML(text) {
+		return "", "", false, fmt.Errorf("unsupported YAML %q", text)
+	}
+	i := strings.Index(text+" ", ": ")
+	if i < 0 {
+		return "", "", false, nil
+	}
+	key = strings.TrimRight(text[:i], " ")
+	if i+1 >= len(text) {
+		return key, "", true, nil
+	}
+	return key, strings.TrimLeft(text[i+1:], " "), true, nil
+}
+
+// parseYAMLFlow parses s as a single flow node: a scalar or a flow
+// collection.
+func parseYAMLFlow(s string) (interface{}, error) {
+	f := &yamlFlow{s: s}
+	v, err := f.node(false)
+	if err != nil {
+		return nil, err
+	}
+	if f.skipSpaces(); f.pos < len(s) {
+		return nil, fmt.Errorf("unexpected %q after value", s[f.pos:])
+	}
+	return v, nil
+}
+
+// yamlFlow parses flow nodes from s.
+type yamlFlow struct {
+	s   string
+	pos int
+}
+
+func (f *yamlFlow) skipSpaces() {
+	for f.pos < len(f.s) && f.s[f.pos] == ' ' {
+		f.pos++
+	}
+}
+
+// node parses a scalar or flow collection.  Plain scalars inside a flow
+// collection end at the characters that separate its entries.
+func (f *yamlFlow) node(inFlow bool) (interface{}, error) {
+	f.skipSpaces()
+	if f.pos == len(f.s) {
+		return nil, nil
+	}
+	switch f.s[f.pos] {
+	case '[':
+		return f.sequence()
+	case '{':
+		return f.mapping()
+	case '"', '\'':
+		return f.quoted()
+	}
+	if isUnsupportedYAML(f.s[f.pos:]) {
+		return nil, fmt.Errorf("unsupported YAML %q", f.s[f.pos:])
+	}
+	stop := ""
+	if inFlow {
+		stop = ",]}"
+	}
+	return yamlScalar(f.plain(stop)), nil
+}
+
+// isUnsupportedYAML reports whether s starts with an indicator of a block
+// scalar, anchor, alias, tag, directive, complex key or reserved character.
+func isUnsupportedYAML(s string) bool {
+	return strings.IndexByte("|>&*!%@`", s[0]) >= 0 || s[0] == '?' && (len(s) == 1 || s[1] == ' ')
+}
+
+// plain returns the plain scalar at the current position, which ends at any
+// of the bytes in stop.
+func (f *yamlFlow) plain(stop string) string {
+	start := f.pos
+	for f.pos < len(f.s) && strings.IndexByte(stop, f.s[f.pos]) < 0 {
+		if f.s[f.pos] == ':' && stop != "" && (f.pos+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.pos+1]) >= 0) {
+			break
+		}
+		f.pos++
+	}
+	return strings.TrimRight(f.s[start:f.pos], " ")
+}
+
+func (f *yamlFlow) sequence() ([]interface{}, error) {
+	f.pos++
+	list := []interface{}{}
+	if f.skipSpaces(); f.pos < len(f.s) && f.s[f.pos] == ']' {
+		f.pos++
+		return list, nil
+	}
+	for {
+		if f.skipSpaces(); f.pos < len(f.s) && f.s[f.pos] == ',' {
+			return nil, fmt.Errorf("unexpected %q in flow sequence", f.s[f.pos:])
+		}
+		v, err := f.node(true)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		if f.skipSpaces(); f.pos == len(f.s) {
+			return nil, fmt.Errorf("unterminated flow sequence")
+		}
+		switch f.s[f.pos] {
+		case ',':
+			// a trailing comma ends the sequence like the bracket does
+			f.pos++
+			if f.skipSpaces(); f.pos < len(f.s) && f.s[f.pos] == ']' {
+				f.pos++
+				return list, nil
+			}
+		case ']':
+			f.pos++
+			return list, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q in flow sequence", f.s[f.pos:])
+		}
+	}
+}
+
+func (f *yamlFlow) mapping() (map[string]interface{}, error) {
+	f.pos++
+	m := map[string]interface{}{}
+	if f.skipSpaces(); f.pos < len(f.s) && f.s[f.pos] == '}' {
+		f.pos++
+		return m, nil
+	}
+	for {
+		f.skipSpaces()
+		var key string
+		if f.pos < len(f.s) && (f.s[f.pos] == '"' || f.s[f.pos] == '\'') {
+			var err error
+			if key, err = f.quoted(); err != nil {
+				return nil, err
+			}
+		} else if f.pos < len(f.s) && isUnsupportedYAML(f.s[f.pos:]) {
+			return nil, fmt.Errorf("unsupported YAML %q", f.s[f.pos:])
+		} else {
+			key = f.plain(",]}")
+		}
+		if f.skipSpaces(); f.pos == len(f.s) || f.s[f.pos] != ':' {
+			return nil, fmt.Errorf("expected a colon after key %q in flow mapping", key)
+		}
+		f.pos++
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("duplicate key %q", key)
+		}
+		v, err := f.node(true)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+		if f.skipSpaces(); f.pos == len(f.s) {
+			return nil, fmt.Errorf("unterminated flow mapping")
+		}
+		switch f.s[f.pos] {
+		case ',':
+			f.pos++
+			if f.skipSpaces(); f.pos < len(f.s) && f.s[f.pos] == '}' {
+				f.pos++
+				return m, nil
+			}
+		case '}':
+			f.pos++
+			return m, nil
+		default:
+			return nil, fmt.Errorf("unexpected %q in flow mapping", f.s[f.pos:])
+		}
+	}
+}
+
+// quoted parses a single or double quoted scalar.  Double quoted scalars
+// take the escapes of Go string literals, which cover those of YAML that
+// manifests need.
+func (f *yamlFlow) quoted() (string, error) {
+	q := f.s[f.pos]
+	for i := f.pos + 1; i < len(f.s); i++ {
+		switch {
+		case q == '"' && f.s[i] == '\\':
+			i++
+		case f.s[i] == q && q == '\'' && i+1 < len(f.s) && f.s[i+1] == '\'':
+			i++
+		case f.s[i] == q:
+			raw := f.s[f.pos : i+1]
+			f.pos = i + 1
+			if q == '\'' {
+				return strings.ReplaceAll(raw[1:len(raw)-1], "''", "'"), nil
+			}
+			s, err := strconv.Unquote(raw)
+			if err != nil {
+				return "", fmt.Errorf("invalid double quoted scalar %s", raw)
+			}
+			return s, nil
+		}
+	}
+	return "", fmt.Errorf("unterminated quoted scalar %s", f.s[f.pos:])
+}
+
+// yamlScalar resolves a plain scalar to null, a boolean, a number or a
+// string, as the YAML core schema does.
+func yamlScalar(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+	if strings.HasPrefix(s, "0o") || strings.HasPrefix(s, "0x") {
+		base := 8
+		if s[1] == 'x' {
+			base = 16
+		}
+		// ParseInt would take a sign after the prefix
+		if c := s[2:]; c != "" && c[0] != '+' && c[0] != '-' {
+			if n, err := strconv.ParseInt(c, base, 64); err == nil {
+				return json.Number(strconv.FormatInt(n, 10))
+			}
+		}
+		return s
+	}
+	if strings.Trim(s, "+-.0123456789eE") != "" || strings.Trim(s, "+-.eE") == "" {
+		return s
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(n, 10))
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64))
+	}
+	return s
+}
@@ -0,0 +1,168 @@
+package iso9660wrap
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	for _, tc := range []struct {
+		desc, yaml, want string
+	}{
+		{"empty", "", `{}`},
+		{"comment only", "# nothing\n", `{}`},
+		{"scalars", "a: text\nb: 4\nc: -1.5\nd: true\ne: False\nf: null\ng: ~\nh:\n", `{"a":"text","b":4,"c":-1.5,"d":true,"e":false,"f":null,"g":null,"h":null}`},
+		{"quoted", `a: "2024"` + "\nb: 'it''s'\nc: \"tab\\there\"\n'd e': \"x # y\"\n", `{"a":"2024","b":"it's","c":"tab\there","d e":"x # y"}`},
+		{"comments", "---\na: b # comment\nc: d#e\n# line\n", `{"a":"b","c":"d#e"}`},
+		{"plain with colons", "source: C:\\build\\rootfs\nurl: http://x/y\n", `{"source":"C:\\build\\rootfs","url":"http://x/y"}`},
+		{"nested mapping", "a:\n  b:\n    c: 1\n  d: 2\ne: 3\n", `{"a":{"b":{"c":1},"d":2},"e":3}`},
+		{"sequence", "- 1\n- two\n-\n- [3]\n", `[1,"two",null,[3]]`},
+		{"sequence under key", "files:\n- path: a\n  hidden: true\n- path: b\nboot: []\n", `{"files":[{"path":"a","hidden":true},{"path":"b"}],"boot":[]}`},
+		{"indented sequence", "files:\n  - path: a\n    source: x\n  -\n    path: b\n", `{"files":[{"path":"a","source":"x"},{"path":"b"}]}`},
+		{"nested sequences", "- - a\n  - b\n- - c\n", `[["a","b"],["c"]]`},
+		{"flow", "a: [x, 'y z', {k: v, n: [1, 2]}, {}]\n", `{"a":["x","y z",{"k":"v","n":[1,2]},{}]}`},
+		{"flow mapping entry", "- {source: build/rootfs, path: /}\n", `[{"source":"build/rootfs","path":"/"}]`},
+		{"windows line ends", "a: b\r\nc: d\r\n", `{"a":"b","c":"d"}`},
+		{"quoted keys", `"k\"q": 1` + "\n'a: b': c\n\"#\": d\n'': e\n", `{"k\"q":1,"a: b":"c","#":"d","":"e"}`},
+		{"quoted flow keys", `a: {'x, y': 1, "a}": [2], "": 3}` + "\n", `{"a":{"x, y":1,"a}":[2],"":3}}`},
+		{"flow quotes", `a: ["x, y", 'z]', "{", '', "'"]` + "\n", `{"a":["x, y","z]","{","","'"]}`},
+		{"flow nesting", "a: [[], {}, [[1]], {k: {n: []}}]\n", `{"a":[[],{},[[1]],{"k":{"n":[]}}]}`},
+		{"flow trailing commas", "a: [1, 2, ]\nb: {k: v,}\n", `{"a":[1,2],"b":{"k":"v"}}`},
+		{"flow plain colons", "a: [C:\\x, http://y]\nb: {k:v: w}\n", `{"a":["C:\\x","http://y"],"b":{"k:v":"w"}}`},
+		{"comments in quotes", `a: 'x # y' # z` + "\n" + `b: "p # q" #r` + "\n" + `c: ['#', "d # e"] # f` + "\n", `{"a":"x # y","b":"p # q","c":["#","d # e"]}`},
+		{"hash without space", "a: x#y\nb: [c#d]\nc#d: e\n", `{"a":"x#y","b":["c#d"],"c#d":"e"}`},
+		{"quote inside plain", "a: it's # comment\nb: say \"hi\"\n", `{"a":"it's","b":"say \"hi\""}`},
+		{"comment after key", "a: # none\n  b: 1\n", `{"a":{"b":1}}`},
+		{"integers", "a: 0\nb: -7\nc: +7\nd: 007\ne: 0o17\nf: 0x1F\ng: 0xff\n", `{"a":0,"b":-7,"c":7,"d":7,"e":15,"f":31,"g":255}`},
+		{"floats", "a: 1.5\nb: .5\nc: -.5\nd: 5.\ne: 1e3\nf: +1.5E-2\n", `{"a":1.5,"b":0.5,"c":-0.5,"d":5,"e":1000,"f":0.015}`},
+		{"not numbers", "a: 1_000\nb: 2024-05-01\nc: 1.2.3\nd: 0x\ne: 0o8\nf: 0x-1\ng: .inf\nh: -\ni: e5\nj: 12abc\n", `{"a":"1_000","b":"2024-05-01","c":"1.2.3","d":"0x","e":"0o8","f":"0x-1","g":".inf","h":"-","i":"e5","j":"12abc"}`},
+		{"booleans and nulls", "a: [true, True, TRUE, false, null, Null, ~, '~', \"true\"]\n", `{"a":[true,true,true,false,null,null,null,"~","true"]}`},
+		{"YAML 1.1 booleans", "a: yes\nb: no\nc: on\nd: off\ne: tRUE\n", `{"a":"yes","b":"no","c":"on","d":"off","e":"tRUE"}`},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			b, err := yamlToJSON([]byte(tc.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, want interface{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatalf("invalid JSON %s: %v", b, err)
+			}
+			if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %s, want %s", b, tc.want)
+			}
+		})
+	}
+}
+
+func TestYAMLToJSONErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc, yaml, want string
+	}{
+		{"tab", "a:\n\tb: c\n", "line 2: YAML can't be indented with tabs"},
+		{"indentation", "a: b\n  c: d\n", "line 2: unexpected indentation"},
+		{"dedent", "a:\n    b: c\n  d: e\n", "line 3: unexpected indentation"},
+		{"duplicate", "a: 1\na: 2\n", `line 2: duplicate key "a"`},
+		{"not a key", "a: 1\nb\n", "line 2: expected a key"},
+		{"documents", "a: 1\n---\nb: 2\n", "line 2: only a single YAML document"},
+		{"anchor", "a: &x 1\n", "unsupported YAML"},
+		{"alias", "a: *x\n", "unsupported YAML"},
+		{"tag", "a: !!str 1\n", "unsupported YAML"},
+		{"local tag", "- !thing x\n", "unsupported YAML"},
+		{"anchor in flow", "a: [&x 1]\n", "unsupported YAML"},
+		{"alias in flow", "a: {k: *x}\n", "unsupported YAML"},
+		{"tag in flow", "a: [1, !!str 2]\n", "unsupported YAML"},
+		{"anchored key", "&x a: 1\n", "unsupported YAML"},
+		{"anchored flow key", "a: {&x k: v}\n", "unsupported YAML"},
+		{"complex key", "? a\n: b\n", "unsupported YAML"},
+		{"directive", "%YAML 1.2\n", "unsupported YAML"},
+		{"folded scalar", "a: >\n  text\n", "unsupported YAML"},
+		{"block scalar", "a: |\n  text\n", "unsupported YAML"},
+		{"unterminated flow", "a: [1, 2\n", "unterminated flow sequence"},
+		{"unterminated quote", "a: 'x\n", "unterminated quoted scalar"},
+		{"unterminated mapping", "a: {k: v\n", "unterminated flow mapping"},
+		{"empty flow entry", "a: [1, , 2]\n", "unexpected"},
+		{"flow key without value", "a: {k}\n", `expected a colon after key "k"`},
+		{"bad escape", `a: "\q"` + "\n", "invalid double quoted scalar"},
+		{"flow over lines", "a: [1,\n  2]\n", "unterminated flow sequence"},
+		{"trailing", "a: 'x' y\n", "after value"},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			b, err := yamlToJSON([]byte(tc.yaml))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("yamlToJSON returned %s, %v, want an error containing %q", b, err, tc.want)
+			}
+		})
+	}
+}
+
+func TestReadManifestYAML(t *testing.T) {
+	j, err := ReadManifest(strings.NewReader(`{
+		"volumeID": "INSTALLER",
+		"rockRidge": true,
+		"timestamp": "2024-05-01T12:00:00Z",
+		"exclude": ["*.tmp"],
+		"files": [
+			{"source": "build/rootfs", "path": "/"},
+			{"source": "isolinux.bin", "path": "isolinux/isolinux.bin"},
+			{"path": "empty"}
+		],
+		"boot": [
+			{"path": "isolinux/isolinux.bin", "loadSize": 4, "bootInfoTable": true}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	y, err := ReadManifest(strings.NewReader(`# the installer image
+volumeID: INSTALLER
+rockRidge: true
+timestamp: 2024-05-01T12:00:00Z
+exclude: ["*.tmp"]
+files:
+  - {source: build/rootfs, path: /}
+  - source: isolinux.bin
+    path: isolinux/isolinux.bin
+  - path: empty
+boot:
+  - path: isolinux/isolinux.bin
+    loadSize: 4
+    bootInfoTable: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(j, y) {
+		t.Errorf("YAML manifest is %+v, want %+v", y, j)
+	}
+
+	for _, manifest := range []string{"volumeID: INSTALLER\nrockRidges: true\n", "volumeID: 2024\n", "files: [\n", "volumeID: *name\n"} {
+		if _, err := ReadManifest(strings.NewReader(manifest)); err == nil || !strings.HasPrefix(err.Error(), "invalid manifest: ") {
+			t.Errorf("ReadManifest(%q) returned %v, want an invalid manifest", manifest, err)
+		}
+	}
+
+	// YAML reads unquoted numbers and booleans as such, even for fields
+	// that take strings, which the error points out
+	for _, manifest := range []string{"volumeID: 2024\n", "volumeID: true\n", "volumeID: 0x10\n"} {
+		if _, err := ReadManifest(strings.NewReader(manifest)); err == nil || !strings.Contains(err.Error(), "quote the value of volumeID") {
+			t.Errorf("ReadManifest(%q) returned %v, want advice to quote it", manifest, err)
+		}
+	}
+	for _, manifest := range []string{`volumeID: "2024"`, "volumeID: '2024'", `{"volumeID": "2024"}`} {
+		if m, err := ReadManifest(strings.NewReader(manifest)); err != nil || m.VolumeID != "2024" {
+			t.Errorf("ReadManifest(%q) returned %+v, %v", manifest, m, err)
+		}
+	}
+	if m, err := ReadManifest(strings.NewReader("interchangeLevel: 0o3\nrockRidge: True\njoliet: false\n")); err != nil || m.InterchangeLevel != 3 || !m.RockRidge || m.Joliet {
+		t.Errorf("ReadManifest of resolved scalars returned %+v, %v", m, err)
+	}
+	if _, err := ReadManifest(strings.NewReader(`{"volumeID": 2024}`)); err == nil || strings.Contains(err.Error(), "quote") {
+		t.Errorf("ReadManifest of a JSON number returned %v, want no YAML advice", err)
+	}
+}